@@ -0,0 +1,68 @@
+package bstream
+
+import (
+	"fmt"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// ToAny converts a block to its protobuf Any form. When `decoded` is true,
+// the chain specific payload is returned (decompressed), otherwise the whole
+// bstream Block is wrapped. The optional `interceptor` receives the message
+// about to be marshalled (the decoded payload or the `*pbbstream.Block`) and
+// returns the one to use instead; the block itself is never modified.
+func ToAny(blk *pbbstream.Block, decoded bool, interceptor func(interface{}) interface{}) (*anypb.Any, error) {
+	if !decoded {
+		if interceptor == nil {
+			return anypb.New(blk)
+		}
+		return interceptedAny(interceptor(proto.Clone(blk)))
+	}
+
+	payload, err := DecompressedPayload(blk)
+	if err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		return nil, fmt.Errorf("block %s has no payload", blk.AsRef())
+	}
+	if interceptor == nil {
+		return payload, nil
+	}
+
+	msg, err := payload.UnmarshalNew()
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling payload of block %s: %w", blk.AsRef(), err)
+	}
+	return interceptedAny(interceptor(msg))
+}
+
+func interceptedAny(obj interface{}) (*anypb.Any, error) {
+	msg, ok := obj.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("interceptor returned %T, expected a proto.Message", obj)
+	}
+	return anypb.New(msg)
+}
+
+// NewAnyStreamHandler returns a handler converting each block with `ToAny` and
+// forwarding it along with its cursor to `send`, typically a gRPC stream. The
+// cursor is nil if the object received by the handler is not `Cursorable`.
+// Errors from `send` are returned as is to the source.
+func NewAnyStreamHandler(decoded bool, interceptor func(interface{}) interface{}, send func(*anypb.Any, *Cursor) error) Handler {
+	return HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		out, err := ToAny(blk, decoded, interceptor)
+		if err != nil {
+			return fmt.Errorf("converting block %s to any: %w", blk.AsRef(), err)
+		}
+
+		var cursor *Cursor
+		if cursorable, ok := obj.(Cursorable); ok {
+			cursor = cursorable.Cursor()
+		}
+
+		return send(out, cursor)
+	})
+}
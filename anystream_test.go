@@ -0,0 +1,64 @@
+package bstream
+
+import (
+	"errors"
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestNewAnyStreamHandler(t *testing.T) {
+	blk := TestBlock("00000002a", "00000001a")
+	require.NoError(t, SetBlockPayload(blk, &pbbstream.BlockMeta{Id: "payload"}))
+	require.NoError(t, CompressBlockPayload(blk, PayloadCompressionGzip))
+	obj := testCursorObj(StepNew, "00000002a", "00000001a")
+
+	t.Run("decoded", func(t *testing.T) {
+		h := NewAnyStreamHandler(true, nil, func(out *anypb.Any, cursor *Cursor) error {
+			msg := &pbbstream.BlockMeta{}
+			require.NoError(t, out.UnmarshalTo(msg))
+			assert.Equal(t, "payload", msg.Id)
+			assert.Equal(t, "00000002a", cursor.Block.ID())
+			return nil
+		})
+		require.NoError(t, h.ProcessBlock(blk, obj))
+	})
+
+	t.Run("decoded with interceptor", func(t *testing.T) {
+		interceptor := func(in interface{}) interface{} {
+			in.(*pbbstream.BlockMeta).Id = "intercepted"
+			return in
+		}
+		h := NewAnyStreamHandler(true, interceptor, func(out *anypb.Any, cursor *Cursor) error {
+			msg := &pbbstream.BlockMeta{}
+			require.NoError(t, out.UnmarshalTo(msg))
+			assert.Equal(t, "intercepted", msg.Id)
+			return nil
+		})
+		require.NoError(t, h.ProcessBlock(blk, obj))
+		assert.Equal(t, "payload", ToProtocol[*pbbstream.BlockMeta](blk).Id, "block left untouched")
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		h := NewAnyStreamHandler(false, nil, func(out *anypb.Any, cursor *Cursor) error {
+			msg := &pbbstream.Block{}
+			require.NoError(t, out.UnmarshalTo(msg))
+			equal, err := BlocksEqual(blk, msg)
+			assert.True(t, equal, err)
+			return nil
+		})
+		require.NoError(t, h.ProcessBlock(blk, obj))
+	})
+
+	t.Run("send error", func(t *testing.T) {
+		failure := errors.New("failure")
+		h := NewAnyStreamHandler(true, nil, func(out *anypb.Any, cursor *Cursor) error {
+			assert.Nil(t, cursor)
+			return failure
+		})
+		assert.Equal(t, failure, h.ProcessBlock(blk, nil))
+	})
+}
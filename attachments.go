@@ -0,0 +1,64 @@
+package bstream
+
+// Attachments holds arbitrary user metadata (correlation IDs, ingestion
+// timestamps, etc.) that travels alongside a block through the pipeline
+// without being part of the block payload.
+//
+// Attachments are not safe for concurrent mutation: populate them before
+// pushing the block into the pipeline and treat them as read-only afterwards.
+// The same map is handed to every step emitted for a block (new, undo,
+// irreversible, ...), possibly from different goroutines when sources fan out,
+// so use `Clone()` if a handler needs to modify them.
+type Attachments map[string]interface{}
+
+// Clone returns a shallow copy of the attachments, values are not copied.
+func (a Attachments) Clone() Attachments {
+	if a == nil {
+		return nil
+	}
+
+	out := make(Attachments, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	return out
+}
+
+// AttachmentsCarrier is implemented by handler objects exposing the
+// attachments of the block they wrap, `forkable.ForkableObject` does.
+type AttachmentsCarrier interface {
+	Attachments() Attachments
+}
+
+// AttachedObject is the object a source pushes to its handler to attach
+// metadata to a block. The `Preprocessor` fills `Obj` when it's nil and the
+// forkable unwraps it, keeping `Attachments` on the `ForkableObject` it emits
+// while `WrappedObject()` returns `Obj` as usual.
+type AttachedObject struct {
+	Obj         interface{}
+	attachments Attachments
+}
+
+func NewAttachedObject(obj interface{}, attachments Attachments) *AttachedObject {
+	return &AttachedObject{
+		Obj:         obj,
+		attachments: attachments,
+	}
+}
+
+func (o *AttachedObject) Attachments() Attachments {
+	return o.attachments
+}
+
+func (o *AttachedObject) WrappedObject() interface{} {
+	return o.Obj
+}
+
+// AttachmentsFromObject extracts the attachments from a handler object, it
+// returns nil if the object does not carry any.
+func AttachmentsFromObject(obj interface{}) Attachments {
+	if carrier, ok := obj.(AttachmentsCarrier); ok {
+		return carrier.Attachments()
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package bstream
+
+import (
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachments_Clone(t *testing.T) {
+	var empty Attachments
+	assert.Nil(t, empty.Clone())
+
+	in := Attachments{"a": 1}
+	out := in.Clone()
+	out["b"] = 2
+
+	assert.Equal(t, Attachments{"a": 1}, in)
+	assert.Equal(t, Attachments{"a": 1, "b": 2}, out)
+}
+
+func TestPreprocessor_KeepsAttachments(t *testing.T) {
+	attachments := Attachments{"correlation_id": "abc"}
+
+	var received interface{}
+	pp := NewPreprocessor(func(blk *pbbstream.Block) (interface{}, error) {
+		return blk.Id, nil
+	}, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		received = obj
+		return nil
+	}))
+
+	require.NoError(t, pp.ProcessBlock(TestBlock("00000002a", "00000001a"), NewAttachedObject(nil, attachments)))
+
+	attached, ok := received.(*AttachedObject)
+	require.True(t, ok)
+	assert.Equal(t, "00000002a", attached.WrappedObject())
+	assert.Equal(t, attachments, AttachmentsFromObject(received))
+}
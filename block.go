@@ -1,6 +1,7 @@
 package bstream
 
 import (
+	"bytes"
 	"fmt"
 	"reflect"
 
@@ -8,11 +9,101 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+// ToProtocol decodes the payload of `blk` as a `B`, with the decoder
+// registered in `GetBlockDecoderByVersion` for the block `PayloadVersion`, if
+// any. It panics when the payload cannot be decoded.
 func ToProtocol[B proto.Message](blk *pbbstream.Block) B {
+	if decoded, found, err := decodeByVersion(blk); found {
+		if err != nil {
+			panic(err)
+		}
+		value, ok := decoded.(B)
+		if !ok {
+			panic(fmt.Errorf("block %s payload (version: %d) decoded as %T, expected %T", blk, blk.PayloadVersion, decoded, value))
+		}
+		return value
+	}
+
 	var b B
 	value := reflect.New(reflect.TypeOf(b).Elem()).Interface().(B)
-	if err := blk.Payload.UnmarshalTo(value); err != nil {
+	payload, err := DecompressedPayload(blk)
+	if err != nil {
+		panic(err)
+	}
+	if err := payload.UnmarshalTo(value); err != nil {
 		panic(fmt.Errorf("unable to unmarshal block %s payload (kind: %s): %w", blk, blk.Payload.TypeUrl, err))
 	}
 	return value
 }
+
+// decodeByVersion decodes the payload of `blk` with the decoder registered in
+// `GetBlockDecoderByVersion` for its `PayloadVersion`, `found` is false when
+// there is none. A compressed payload is decompressed first, the decoder gets
+// a copy of `blk` carrying it since blocks are shared.
+func decodeByVersion(blk *pbbstream.Block) (decoded interface{}, found bool, err error) {
+	decoder, found := GetBlockDecoderByVersion[blk.PayloadVersion]
+	if !found {
+		return nil, false, nil
+	}
+
+	payload, err := DecompressedPayload(blk)
+	if err != nil {
+		return nil, true, err
+	}
+	if payload != blk.Payload {
+		blk = proto.Clone(blk).(*pbbstream.Block)
+		blk.Payload = payload
+	}
+
+	decoded, err = decoder(blk)
+	if err != nil {
+		return nil, true, fmt.Errorf("unable to decode block %s payload (version: %d): %w", blk, blk.PayloadVersion, err)
+	}
+	return decoded, true, nil
+}
+
+// BlocksEqual compares the header fields and the payload (type and
+// decompressed bytes) of two blocks, deprecated payload fields are ignored.
+// When blocks differ, the returned error describes the first differing field.
+// Two nil blocks are equal, a nil block is never equal to a non-nil one.
+func BlocksEqual(a, b *pbbstream.Block) (bool, error) {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return true, nil
+		}
+		return false, fmt.Errorf("nil block: a is nil %t, b is nil %t", a == nil, b == nil)
+	}
+
+	switch {
+	case a.Number != b.Number:
+		return false, fmt.Errorf("number differs: %d != %d", a.Number, b.Number)
+	case a.Id != b.Id:
+		return false, fmt.Errorf("id differs: %q != %q", a.Id, b.Id)
+	case a.ParentId != b.ParentId:
+		return false, fmt.Errorf("parent id differs: %q != %q", a.ParentId, b.ParentId)
+	case a.ParentNum != b.ParentNum:
+		return false, fmt.Errorf("parent num differs: %d != %d", a.ParentNum, b.ParentNum)
+	case a.LibNum != b.LibNum:
+		return false, fmt.Errorf("lib num differs: %d != %d", a.LibNum, b.LibNum)
+	case !proto.Equal(a.Timestamp, b.Timestamp):
+		return false, fmt.Errorf("timestamp differs: %s != %s", a.Timestamp, b.Timestamp)
+	}
+
+	payloadA, err := DecompressedPayload(a)
+	if err != nil {
+		return false, err
+	}
+	payloadB, err := DecompressedPayload(b)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case payloadA.GetTypeUrl() != payloadB.GetTypeUrl():
+		return false, fmt.Errorf("payload type differs: %q != %q", payloadA.GetTypeUrl(), payloadB.GetTypeUrl())
+	case !bytes.Equal(payloadA.GetValue(), payloadB.GetValue()):
+		return false, fmt.Errorf("payload differs: %d bytes != %d bytes", len(payloadA.GetValue()), len(payloadB.GetValue()))
+	}
+
+	return true, nil
+}
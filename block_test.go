@@ -0,0 +1,106 @@
+package bstream
+
+import (
+	"testing"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocksEqual(t *testing.T) {
+	withPayload := func(blk *pbbstream.Block, id string, compression PayloadCompression) *pbbstream.Block {
+		require.NoError(t, SetBlockPayload(blk, &pbbstream.BlockMeta{Id: id}))
+		require.NoError(t, CompressBlockPayload(blk, compression))
+		return blk
+	}
+	base := func() *pbbstream.Block {
+		return withPayload(TestBlockWithTimestamp("00000002a", "00000001a", time.Unix(10, 0)), "payload", PayloadCompressionNone)
+	}
+
+	tests := []struct {
+		name          string
+		a             *pbbstream.Block
+		b             *pbbstream.Block
+		expectEqual   bool
+		expectMessage string
+	}{
+		{"both nil", nil, nil, true, ""},
+		{"one nil", base(), nil, false, "nil block"},
+		{"equal", base(), base(), true, ""},
+		{"compressed payload", base(), withPayload(base(), "payload", PayloadCompressionZstd), true, ""},
+		{"id", base(), func() *pbbstream.Block { b := base(); b.Id = "00000002b"; return b }(), false, "id differs"},
+		{"lib num", base(), func() *pbbstream.Block { b := base(); b.LibNum = 2; return b }(), false, "lib num differs"},
+		{"timestamp", base(), withPayload(TestBlockWithTimestamp("00000002a", "00000001a", time.Unix(11, 0)), "payload", PayloadCompressionNone), false, "timestamp differs"},
+		{"payload", base(), withPayload(base(), "other", PayloadCompressionNone), false, "payload differs"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			equal, err := BlocksEqual(test.a, test.b)
+			assert.Equal(t, test.expectEqual, equal)
+			if test.expectEqual {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectMessage)
+			}
+		})
+	}
+}
+
+func TestToProtocol_DecoderByVersion(t *testing.T) {
+	defer func(previous map[int32]BlockDecoderFunc) { GetBlockDecoderByVersion = previous }(GetBlockDecoderByVersion)
+	GetBlockDecoderByVersion = map[int32]BlockDecoderFunc{
+		1: func(blk *pbbstream.Block) (interface{}, error) {
+			ref := &pbbstream.BlockRef{}
+			if err := blk.Payload.UnmarshalTo(ref); err != nil {
+				return nil, err
+			}
+			return &pbbstream.BlockMeta{Id: ref.Id, Number: ref.Num}, nil
+		},
+	}
+
+	oldBlk := TestBlock("00000002a", "00000001a")
+	oldBlk.PayloadVersion = 1
+	require.NoError(t, SetBlockPayload(oldBlk, &pbbstream.BlockRef{Id: "old", Num: 2}))
+
+	newBlk := TestBlock("00000003a", "00000002a")
+	newBlk.PayloadVersion = 2
+	require.NoError(t, SetBlockPayload(newBlk, &pbbstream.BlockMeta{Id: "new", Number: 3}))
+
+	var decoded []string
+	for _, blk := range []*pbbstream.Block{oldBlk, newBlk} {
+		decoded = append(decoded, ToProtocol[*pbbstream.BlockMeta](blk).Id)
+	}
+	assert.Equal(t, []string{"old", "new"}, decoded)
+
+	assert.Panics(t, func() { ToProtocol[*pbbstream.BlockRef](oldBlk) }, "decoded type mismatch")
+}
+
+func TestToProtocol_DecoderByVersionCompressed(t *testing.T) {
+	defer func(previous map[int32]BlockDecoderFunc) { GetBlockDecoderByVersion = previous }(GetBlockDecoderByVersion)
+	GetBlockDecoderByVersion = map[int32]BlockDecoderFunc{
+		1: func(blk *pbbstream.Block) (interface{}, error) {
+			ref := &pbbstream.BlockRef{}
+			if err := blk.Payload.UnmarshalTo(ref); err != nil {
+				return nil, err
+			}
+			return &pbbstream.BlockMeta{Id: ref.Id, Number: ref.Num}, nil
+		},
+	}
+
+	for _, compression := range []PayloadCompression{PayloadCompressionGzip, PayloadCompressionZstd} {
+		t.Run(compression.String(), func(t *testing.T) {
+			blk := TestBlock("00000002a", "00000001a")
+			blk.PayloadVersion = 1
+			require.NoError(t, SetBlockPayload(blk, &pbbstream.BlockRef{Id: "old", Num: 2}))
+			require.NoError(t, CompressBlockPayload(blk, compression))
+			compressed := blk.Payload
+
+			assert.Equal(t, "old", ToProtocol[*pbbstream.BlockMeta](blk).Id)
+			assert.Same(t, compressed, blk.Payload, "shared block is left compressed")
+		})
+	}
+}
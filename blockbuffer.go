@@ -0,0 +1,140 @@
+package bstream
+
+import (
+	"container/heap"
+	"sync"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+)
+
+// BlockBuffer keeps pending blocks ordered by block number, giving cheap
+// access to the lowest one and lookup or removal by block ID. Blocks with the
+// same number are ordered by ID. It is safe for concurrent use.
+type BlockBuffer struct {
+	sync.Mutex
+
+	heap blockHeap
+	ids  map[string]*blockHeapItem
+}
+
+func NewBlockBuffer() *BlockBuffer {
+	return &BlockBuffer{
+		ids: make(map[string]*blockHeapItem),
+	}
+}
+
+// Push adds `blk` to the buffer, it returns false without adding it if a
+// block with the same ID is already buffered.
+func (b *BlockBuffer) Push(blk *pbbstream.Block) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, found := b.ids[blk.Id]; found {
+		return false
+	}
+
+	item := &blockHeapItem{blk: blk}
+	heap.Push(&b.heap, item)
+	b.ids[blk.Id] = item
+	return true
+}
+
+// PopLowest removes and returns the block with the lowest number, nil when
+// the buffer is empty.
+func (b *BlockBuffer) PopLowest() *pbbstream.Block {
+	b.Lock()
+	defer b.Unlock()
+
+	if len(b.heap) == 0 {
+		return nil
+	}
+
+	item := heap.Pop(&b.heap).(*blockHeapItem)
+	delete(b.ids, item.blk.Id)
+	return item.blk
+}
+
+// Peek returns the block with the lowest number without removing it, nil
+// when the buffer is empty.
+func (b *BlockBuffer) Peek() *pbbstream.Block {
+	b.Lock()
+	defer b.Unlock()
+
+	if len(b.heap) == 0 {
+		return nil
+	}
+	return b.heap[0].blk
+}
+
+// Get returns the buffered block with the given ID, nil if not found.
+func (b *BlockBuffer) Get(id string) *pbbstream.Block {
+	b.Lock()
+	defer b.Unlock()
+
+	if item, found := b.ids[id]; found {
+		return item.blk
+	}
+	return nil
+}
+
+// Remove removes and returns the buffered block with the given ID, nil if
+// not found.
+func (b *BlockBuffer) Remove(id string) *pbbstream.Block {
+	b.Lock()
+	defer b.Unlock()
+
+	item, found := b.ids[id]
+	if !found {
+		return nil
+	}
+
+	heap.Remove(&b.heap, item.index)
+	delete(b.ids, id)
+	return item.blk
+}
+
+func (b *BlockBuffer) Len() int {
+	b.Lock()
+	defer b.Unlock()
+
+	return len(b.heap)
+}
+
+type blockHeapItem struct {
+	blk   *pbbstream.Block
+	index int
+}
+
+// blockHeap implements `heap.Interface`, keeping each item index up to date
+// so that items can be removed from anywhere in the heap.
+type blockHeap []*blockHeapItem
+
+func (h blockHeap) Len() int { return len(h) }
+
+func (h blockHeap) Less(i, j int) bool {
+	if h[i].blk.Number != h[j].blk.Number {
+		return h[i].blk.Number < h[j].blk.Number
+	}
+	return h[i].blk.Id < h[j].blk.Id
+}
+
+func (h blockHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *blockHeap) Push(x any) {
+	item := x.(*blockHeapItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *blockHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
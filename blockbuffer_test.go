@@ -0,0 +1,78 @@
+package bstream
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockBuffer(t *testing.T) {
+	b := NewBlockBuffer()
+	assert.Nil(t, b.Peek())
+	assert.Nil(t, b.PopLowest())
+
+	assert.True(t, b.Push(TestBlock("00000005a", "00000004a")))
+	assert.True(t, b.Push(TestBlock("00000003a", "00000002a")))
+	assert.True(t, b.Push(TestBlock("00000004b", "00000003a")))
+	assert.True(t, b.Push(TestBlock("00000004a", "00000003a")))
+	assert.True(t, b.Push(TestBlock("00000006a", "00000005a")))
+	assert.False(t, b.Push(TestBlock("00000004a", "00000003a")), "duplicate id")
+	assert.Equal(t, 5, b.Len())
+
+	assert.Equal(t, "00000003a", b.Peek().Id)
+	assert.Equal(t, "00000004b", b.Get("00000004b").Id)
+	assert.Nil(t, b.Get("00000009a"))
+
+	assert.Equal(t, "00000005a", b.Remove("00000005a").Id)
+	assert.Nil(t, b.Remove("00000005a"))
+	assert.Equal(t, 4, b.Len())
+
+	var popped []string
+	for blk := b.PopLowest(); blk != nil; blk = b.PopLowest() {
+		popped = append(popped, blk.Id)
+	}
+	assert.Equal(t, []string{"00000003a", "00000004a", "00000004b", "00000006a"}, popped)
+	assert.Equal(t, 0, b.Len())
+}
+
+func benchmarkBlocks(count int) []*pbbstream.Block {
+	blocks := make([]*pbbstream.Block, count)
+	for i, n := range rand.New(rand.NewSource(1)).Perm(count) {
+		blocks[i] = TestBlock(fmt.Sprintf("%08xa", n+1), fmt.Sprintf("%08xa", n))
+	}
+	return blocks
+}
+
+func BenchmarkBlockBuffer_PushPopLowest(b *testing.B) {
+	blocks := benchmarkBlocks(1000)
+	buffer := NewBlockBuffer()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, blk := range blocks {
+			buffer.Push(blk)
+		}
+		for buffer.PopLowest() != nil {
+		}
+	}
+}
+
+func BenchmarkBlockBuffer_Remove(b *testing.B) {
+	blocks := benchmarkBlocks(1000)
+	buffer := NewBlockBuffer()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, blk := range blocks {
+			buffer.Push(blk)
+		}
+		for _, blk := range blocks {
+			buffer.Remove(blk.Id)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package bstream
+
+import (
+	"fmt"
+	"sync"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+)
+
+// BufferedAsyncHandler decouples a source from a slow handler: blocks are
+// queued, up to `bufferSize` of them, and processed in order by a worker
+// goroutine. ProcessBlock blocks while the queue is full, applying
+// backpressure on the source instead of growing memory.
+//
+// An error of the inner handler stops the worker, the blocks still queued are
+// dropped, and it is returned by the next ProcessBlock call, so the source
+// shuts down with it one block later than with a synchronous handler. Call
+// Close once the source terminated to wait for the queued blocks to be
+// processed and get an error that no ProcessBlock call returned.
+type BufferedAsyncHandler struct {
+	handler Handler
+	queue   chan *bufferedBlock
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	done      chan struct{}
+
+	errLock sync.Mutex
+	err     error
+}
+
+type bufferedBlock struct {
+	blk *pbbstream.Block
+	obj interface{}
+}
+
+func NewBufferedAsyncHandler(inner Handler, bufferSize int) *BufferedAsyncHandler {
+	return &BufferedAsyncHandler{
+		handler: inner,
+		queue:   make(chan *bufferedBlock, bufferSize),
+		done:    make(chan struct{}),
+	}
+}
+
+func (h *BufferedAsyncHandler) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
+	h.startOnce.Do(func() { go h.work() })
+
+	// checked first: with room in the queue, select would pick either case at random
+	select {
+	case <-h.done:
+		return h.closedErr(blk)
+	default:
+	}
+
+	select {
+	case <-h.done:
+		return h.closedErr(blk)
+	case h.queue <- &bufferedBlock{blk: blk, obj: obj}:
+		return nil
+	}
+}
+
+func (h *BufferedAsyncHandler) closedErr(blk *pbbstream.Block) error {
+	if err := h.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("buffered async handler closed, cannot process block %s", blk.AsRef())
+}
+
+// Close waits for the queued blocks to be processed and returns the error of
+// the inner handler, if any. ProcessBlock must not be called after Close.
+func (h *BufferedAsyncHandler) Close() error {
+	h.closeOnce.Do(func() {
+		h.startOnce.Do(func() { go h.work() })
+		close(h.queue)
+	})
+	<-h.done
+	return h.Err()
+}
+
+// Err returns the error of the inner handler, nil while it did not fail.
+func (h *BufferedAsyncHandler) Err() error {
+	h.errLock.Lock()
+	defer h.errLock.Unlock()
+	return h.err
+}
+
+func (h *BufferedAsyncHandler) work() {
+	defer close(h.done)
+
+	for item := range h.queue {
+		if err := h.handler.ProcessBlock(item.blk, item.obj); err != nil {
+			h.errLock.Lock()
+			h.err = err
+			h.errLock.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package bstream
+
+import (
+	"testing"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferedAsyncHandler(t *testing.T) {
+	release := make(chan struct{})
+	var processed []string
+	h := NewBufferedAsyncHandler(HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		<-release
+		processed = append(processed, blk.Id)
+		return nil
+	}), 2)
+
+	// the worker holds the first block, the next two fill the queue
+	require.NoError(t, h.ProcessBlock(TestBlock("00000002a", "00000001a"), nil))
+	require.NoError(t, h.ProcessBlock(TestBlock("00000003a", "00000002a"), nil))
+	require.NoError(t, h.ProcessBlock(TestBlock("00000004a", "00000003a"), nil))
+
+	queued := make(chan error)
+	go func() {
+		queued <- h.ProcessBlock(TestBlock("00000005a", "00000004a"), nil)
+	}()
+
+	select {
+	case <-queued:
+		t.Fatal("expected ProcessBlock to block while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-queued)
+	require.NoError(t, h.Close())
+	assert.Equal(t, []string{"00000002a", "00000003a", "00000004a", "00000005a"}, processed)
+}
+
+func TestBufferedAsyncHandler_Error(t *testing.T) {
+	h := NewBufferedAsyncHandler(HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		if blk.Number == 3 {
+			return errTestMock
+		}
+		return nil
+	}), 1)
+
+	require.NoError(t, h.ProcessBlock(TestBlock("00000002a", "00000001a"), nil))
+	require.NoError(t, h.ProcessBlock(TestBlock("00000003a", "00000002a"), nil))
+
+	var err error
+	for i := 4; err == nil && i < 100; i++ {
+		err = h.ProcessBlock(TestBlockWithNumbers(base(i), base(i-1), uint64(i), uint64(i-1)), nil)
+	}
+	assert.ErrorIs(t, err, errTestMock)
+	assert.ErrorIs(t, h.Close(), errTestMock)
+}
+
+func TestBufferedAsyncHandler_ErrorWithRoomInQueue(t *testing.T) {
+	h := NewBufferedAsyncHandler(HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		return errTestMock
+	}), 10)
+
+	require.NoError(t, h.ProcessBlock(TestBlock("00000002a", "00000001a"), nil))
+	<-h.done
+
+	for i := 3; i < 20; i++ {
+		assert.ErrorIs(t, h.ProcessBlock(TestBlockWithNumbers(base(i), base(i-1), uint64(i), uint64(i-1)), nil), errTestMock, "block %d queued after the worker stopped", i)
+	}
+}
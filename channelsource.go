@@ -0,0 +1,48 @@
+package bstream
+
+import (
+	"io"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/shutter"
+)
+
+// ChannelSource sends the blocks pushed to a channel by the caller's own
+// goroutine to its handler, with a nil object since nothing is known about
+// their finality. It shuts down with `io.EOF` once the channel is closed, or
+// when shut down by the caller. Blocks still in the channel at that point are
+// not drained.
+type ChannelSource struct {
+	*shutter.Shutter
+
+	blocks  <-chan *pbbstream.Block
+	handler Handler
+}
+
+func NewChannelSource(blocks <-chan *pbbstream.Block, handler Handler) *ChannelSource {
+	return &ChannelSource{
+		Shutter: shutter.New(),
+		blocks:  blocks,
+		handler: handler,
+	}
+}
+
+func (s *ChannelSource) Run() {
+	s.Shutdown(s.run())
+}
+
+func (s *ChannelSource) run() error {
+	for {
+		select {
+		case <-s.Terminating():
+			return nil
+		case blk, ok := <-s.blocks:
+			if !ok {
+				return io.EOF
+			}
+			if err := s.handler.ProcessBlock(blk, nil); err != nil {
+				return err
+			}
+		}
+	}
+}
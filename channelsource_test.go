@@ -0,0 +1,59 @@
+package bstream
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelSource(t *testing.T) {
+	t.Run("ends on closed channel", func(t *testing.T) {
+		blocks := make(chan *pbbstream.Block, 2)
+		blocks <- TestBlock("00000001a", "00000000a")
+		blocks <- TestBlock("00000002a", "00000001a")
+		close(blocks)
+
+		var received []string
+		src := NewChannelSource(blocks, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			received = append(received, blk.Id)
+			return nil
+		}))
+		src.Run()
+
+		assert.Equal(t, io.EOF, src.Err())
+		assert.Equal(t, []string{"00000001a", "00000002a"}, received)
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		blocks := make(chan *pbbstream.Block, 1)
+		blocks <- TestBlock("00000001a", "00000000a")
+
+		src := NewChannelSource(blocks, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			return fmt.Errorf("failed")
+		}))
+		src.Run()
+
+		require.Error(t, src.Err())
+		assert.Equal(t, "failed", src.Err().Error())
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		src := NewChannelSource(make(chan *pbbstream.Block), HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			return nil
+		}))
+		go src.Run()
+		src.Shutdown(nil)
+
+		select {
+		case <-src.Terminated():
+			assert.NoError(t, src.Err())
+		case <-time.After(time.Second):
+			t.Error("source did not terminate")
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package bstream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+)
+
+// DefaultCheckpointWriteTimeout bounds each write of a CheckpointingHandler
+// to its store, see `CheckpointingHandlerWithWriteTimeout`.
+const DefaultCheckpointWriteTimeout = 10 * time.Second
+
+type CheckpointingHandlerOption = func(h *CheckpointingHandler)
+
+// CheckpointingHandlerWithWriteTimeout sets the deadline of each write to the
+// store, so a slow store delays the blocks going through the handler by at
+// most `timeout`. A write timing out is retried on the next interval.
+// Defaults to DefaultCheckpointWriteTimeout.
+func CheckpointingHandlerWithWriteTimeout(timeout time.Duration) CheckpointingHandlerOption {
+	return func(h *CheckpointingHandler) {
+		h.writeTimeout = timeout
+	}
+}
+
+// CheckpointingHandler records the cursor of the blocks going through it and
+// persists the latest one to a store, at most once per interval and when
+// closed. Only cursors of New and Irreversible steps are recorded, a cursor
+// in the middle of an undo is never persisted. Use `LoadCheckpoint` on the
+// next start to resume from it.
+//
+// The store must allow overwriting since the same key is written over and
+// over again.
+type CheckpointingHandler struct {
+	sync.Mutex
+
+	handler      Handler
+	store        dstore.Store
+	key          string
+	every        time.Duration
+	writeTimeout time.Duration
+
+	lastCursor  *Cursor
+	lastFlushed *Cursor
+	lastFlush   time.Time
+}
+
+func NewCheckpointingHandler(inner Handler, store dstore.Store, key string, every time.Duration, opts ...CheckpointingHandlerOption) *CheckpointingHandler {
+	h := &CheckpointingHandler{
+		handler:      inner,
+		store:        store,
+		key:          key,
+		every:        every,
+		writeTimeout: DefaultCheckpointWriteTimeout,
+		lastFlush:    time.Now(),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *CheckpointingHandler) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
+	if err := h.handler.ProcessBlock(blk, obj); err != nil {
+		return err
+	}
+
+	cursorable, ok := obj.(Cursorable)
+	if !ok {
+		return nil
+	}
+
+	cursor := cursorable.Cursor()
+	if cursor == nil || !(cursor.Step.Matches(StepNew) || cursor.Step.Matches(StepIrreversible)) {
+		return nil
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.lastCursor = cursor
+	if time.Since(h.lastFlush) >= h.every {
+		if err := h.flush(context.Background()); err != nil {
+			zlog.Warn("cannot write cursor checkpoint, will retry on next interval", zap.String("key", h.key), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// Close persists the latest recorded cursor, call it when the source
+// terminates so that no progress is lost.
+func (h *CheckpointingHandler) Close() error {
+	h.Lock()
+	defer h.Unlock()
+
+	return h.flush(context.Background())
+}
+
+func (h *CheckpointingHandler) flush(ctx context.Context) error {
+	h.lastFlush = time.Now()
+	if h.lastCursor == nil || h.lastCursor == h.lastFlushed {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.writeTimeout)
+	defer cancel()
+	if err := h.store.WriteObject(ctx, h.key, strings.NewReader(h.lastCursor.ToOpaque())); err != nil {
+		return fmt.Errorf("writing cursor checkpoint %q: %w", h.key, err)
+	}
+	h.lastFlushed = h.lastCursor
+	return nil
+}
+
+// LoadCheckpoint reads back the cursor written by a CheckpointingHandler
+// under `key`, it returns a nil cursor if no checkpoint exists yet.
+func LoadCheckpoint(ctx context.Context, store dstore.Store, key string) (*Cursor, error) {
+	exists, err := store.FileExists(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("checking cursor checkpoint %q: %w", key, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	reader, err := store.OpenObject(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("opening cursor checkpoint %q: %w", key, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading cursor checkpoint %q: %w", key, err)
+	}
+
+	return CursorFromOpaque(string(content))
+}
@@ -0,0 +1,107 @@
+package bstream
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCheckpointStore(t *testing.T) (*dstore.MockStore, *int) {
+	var store *dstore.MockStore
+	writes := 0
+	store = dstore.NewMockStore(func(base string, f io.Reader) error {
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+		store.SetFile(base, content)
+		writes++
+		return nil
+	})
+	return store, &writes
+}
+
+func testCursorObj(step StepType, blk, lib string) *preprocessedForkableObject {
+	return &preprocessedForkableObject{
+		step: step,
+		cursor: &Cursor{
+			Step:      step,
+			Block:     bRef(blk),
+			HeadBlock: bRef(blk),
+			LIB:       bRef(lib),
+		},
+	}
+}
+
+func TestCheckpointingHandler(t *testing.T) {
+	ctx := context.Background()
+	store, writes := testCheckpointStore(t)
+
+	cursor, err := LoadCheckpoint(ctx, store, "cursor")
+	require.NoError(t, err)
+	assert.Nil(t, cursor)
+
+	noop := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error { return nil })
+	h := NewCheckpointingHandler(noop, store, "cursor", 0)
+
+	require.NoError(t, h.ProcessBlock(TestBlock("00000003a", "00000002a"), testCursorObj(StepNew, "00000003a", "00000001a")))
+	require.NoError(t, h.ProcessBlock(TestBlock("00000003a", "00000002a"), testCursorObj(StepUndo, "00000003a", "00000001a")))
+	assert.Equal(t, 1, *writes, "undo cursor must not be persisted")
+
+	cursor, err = LoadCheckpoint(ctx, store, "cursor")
+	require.NoError(t, err)
+	assert.Equal(t, StepNew, cursor.Step)
+	assert.Equal(t, "00000003a", cursor.Block.ID())
+
+	require.NoError(t, h.ProcessBlock(TestBlock("00000003b", "00000002a"), testCursorObj(StepNew, "00000003b", "00000001a")))
+	require.NoError(t, h.Close())
+	assert.Equal(t, 2, *writes, "close does not rewrite an already flushed cursor")
+
+	cursor, err = LoadCheckpoint(ctx, store, "cursor")
+	require.NoError(t, err)
+	assert.Equal(t, "00000003b", cursor.Block.ID())
+}
+
+func TestCheckpointingHandler_FlushOnClose(t *testing.T) {
+	ctx := context.Background()
+	store, writes := testCheckpointStore(t)
+
+	noop := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error { return nil })
+	h := NewCheckpointingHandler(noop, store, "cursor", time.Hour)
+
+	require.NoError(t, h.ProcessBlock(TestBlock("00000002a", "00000001a"), testCursorObj(StepNewIrreversible, "00000002a", "00000002a")))
+	assert.Equal(t, 0, *writes)
+
+	require.NoError(t, h.Close())
+	assert.Equal(t, 1, *writes)
+
+	cursor, err := LoadCheckpoint(ctx, store, "cursor")
+	require.NoError(t, err)
+	assert.Equal(t, StepNewIrreversible, cursor.Step)
+	assert.Equal(t, "00000002a", cursor.Block.ID())
+}
+
+func TestCheckpointingHandler_SlowStore(t *testing.T) {
+	store := dstore.NewMockStore(nil)
+	writes := 0
+	store.WriteObjectFunc = func(ctx context.Context, base string, f io.Reader) error {
+		writes++
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	noop := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error { return nil })
+	h := NewCheckpointingHandler(noop, store, "cursor", 0, CheckpointingHandlerWithWriteTimeout(20*time.Millisecond))
+
+	start := time.Now()
+	require.NoError(t, h.ProcessBlock(TestBlock("00000002a", "00000001a"), testCursorObj(StepNew, "00000002a", "00000001a")), "a failed write does not fail the block")
+	assert.Less(t, time.Since(start), time.Second, "write bounded by its timeout")
+	assert.Equal(t, 1, writes)
+
+	require.ErrorIs(t, h.Close(), context.DeadlineExceeded, "not flushed yet, retried on close")
+	assert.Equal(t, 2, writes)
+}
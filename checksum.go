@@ -0,0 +1,176 @@
+package bstream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// Checksummed merged blocks files are a distinct format from dbin files, they
+// start with their own magic so neither reader mistakes one for the other:
+//
+//	header: "bsck" | version (1 byte) | content type length (2 bytes) | content type
+//	record: block number (8 bytes) | length (4 bytes) | crc32 (4 bytes) | block proto
+//
+// Integers are big endian, the CRC32 (Castagnoli) covers the block number and
+// the block proto so a corrupted number is detected too.
+var checksumFileMagic = []byte("bsck")
+
+const checksumFileVersion = 1
+
+// maxChecksumRecordLength protects against allocating huge buffers when the
+// length of a record is itself corrupted.
+const maxChecksumRecordLength = 1 << 30
+
+var crc32Table = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrChecksumMismatch is wrapped by the errors returned when a block record
+// does not match its checksum.
+var ErrChecksumMismatch = errors.New("block checksum mismatch")
+
+// ChecksumBlockWriter writes blocks in the checksummed merged blocks file
+// format, read them back with a ChecksumBlockReader.
+type ChecksumBlockWriter struct {
+	dst              io.Writer
+	hasWrittenHeader bool
+}
+
+func NewChecksumBlockWriter(writer io.Writer) *ChecksumBlockWriter {
+	return &ChecksumBlockWriter{
+		dst: writer,
+	}
+}
+
+func (w *ChecksumBlockWriter) Write(block *pbbstream.Block) error {
+	if !w.hasWrittenHeader {
+		if err := w.writeHeader(PayloadTypeURL(block)); err != nil {
+			return fmt.Errorf("unable to write file header: %w", err)
+		}
+		w.hasWrittenHeader = true
+	}
+
+	message, err := proto.Marshal(block)
+	if err != nil {
+		return fmt.Errorf("unable to marshal proto block: %w", err)
+	}
+
+	record := make([]byte, 16, 16+len(message))
+	binary.BigEndian.PutUint64(record[0:8], block.Number)
+	binary.BigEndian.PutUint32(record[8:12], uint32(len(message)))
+	binary.BigEndian.PutUint32(record[12:16], recordChecksum(record[0:8], message))
+	record = append(record, message...)
+
+	if _, err := w.dst.Write(record); err != nil {
+		return fmt.Errorf("unable to write block %s: %w", block.AsRef(), err)
+	}
+	return nil
+}
+
+func (w *ChecksumBlockWriter) writeHeader(contentType string) error {
+	if len(contentType) > 0xFFFF {
+		return fmt.Errorf("content type too long (%d bytes)", len(contentType))
+	}
+
+	header := append([]byte{}, checksumFileMagic...)
+	header = append(header, checksumFileVersion)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(contentType)))
+	header = append(header, contentType...)
+
+	_, err := w.dst.Write(header)
+	return err
+}
+
+// ChecksumBlockReader reads the checksummed merged blocks file format, each
+// block is verified against its checksum and a mismatch is reported with the
+// offending block number, wrapping ErrChecksumMismatch.
+type ChecksumBlockReader struct {
+	src         *bufio.Reader
+	ContentType string
+}
+
+func NewChecksumBlockReader(reader io.Reader) (*ChecksumBlockReader, error) {
+	src := bufio.NewReader(reader)
+
+	header := make([]byte, len(checksumFileMagic)+3)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, fmt.Errorf("unable to read file header: %w", err)
+	}
+	if !bytes.Equal(header[:len(checksumFileMagic)], checksumFileMagic) {
+		return nil, fmt.Errorf("not a checksummed blocks file, invalid magic %q", header[:len(checksumFileMagic)])
+	}
+	if version := header[len(checksumFileMagic)]; version != checksumFileVersion {
+		return nil, fmt.Errorf("unsupported checksummed blocks file version %d", version)
+	}
+
+	contentType := make([]byte, binary.BigEndian.Uint16(header[len(checksumFileMagic)+1:]))
+	if _, err := io.ReadFull(src, contentType); err != nil {
+		return nil, fmt.Errorf("unable to read file content type: %w", err)
+	}
+
+	return &ChecksumBlockReader{
+		src:         src,
+		ContentType: string(contentType),
+	}, nil
+}
+
+// Read returns the next block, or io.EOF once all blocks were read.
+func (r *ChecksumBlockReader) Read() (*pbbstream.Block, error) {
+	recordHeader := make([]byte, 16)
+	if _, err := io.ReadFull(r.src, recordHeader); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("unable to read block record header: %w", err)
+	}
+
+	blockNum := binary.BigEndian.Uint64(recordHeader[0:8])
+	length := binary.BigEndian.Uint32(recordHeader[8:12])
+	if length > maxChecksumRecordLength {
+		return nil, fmt.Errorf("block #%d: record length %d too large: %w", blockNum, length, ErrChecksumMismatch)
+	}
+
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r.src, message); err != nil {
+		return nil, fmt.Errorf("block #%d: unable to read block record: %w", blockNum, err)
+	}
+
+	if expected, actual := binary.BigEndian.Uint32(recordHeader[12:16]), recordChecksum(recordHeader[0:8], message); expected != actual {
+		return nil, fmt.Errorf("block #%d: expected crc32 %08x, got %08x: %w: %w", blockNum, expected, actual, ErrChecksumMismatch, ErrCorruptBlock)
+	}
+
+	blk := new(pbbstream.Block)
+	if err := proto.Unmarshal(message, blk); err != nil {
+		return nil, fmt.Errorf("block #%d: unable to read block proto: %w: %w", blockNum, err, ErrCorruptBlock)
+	}
+	return blk, nil
+}
+
+func recordChecksum(blockNum, message []byte) uint32 {
+	return crc32.Update(crc32.Checksum(blockNum, crc32Table), crc32Table, message)
+}
+
+// NewChecksumFileSource is a FileSource reading merged blocks files written
+// with a ChecksumBlockWriter instead of dbin files. The source shuts down with
+// an error wrapping ErrChecksumMismatch on the first corrupted block.
+func NewChecksumFileSource(
+	blocksStore dstore.Store,
+	startBlockNum uint64,
+	h Handler,
+	logger *zap.Logger,
+	options ...FileSourceOption,
+) *FileSource {
+	s := NewFileSource(blocksStore, startBlockNum, h, logger, options...)
+	s.newBlockReader = func(reader io.Reader) (blockReader, error) {
+		return NewChecksumBlockReader(reader)
+	}
+	return s
+}
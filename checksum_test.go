@@ -0,0 +1,98 @@
+package bstream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checksumBlocks(t *testing.T, blocks ...*pbbstream.Block) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	writer := NewChecksumBlockWriter(buf)
+	for _, blk := range blocks {
+		require.NoError(t, writer.Write(blk))
+	}
+	return buf.Bytes()
+}
+
+func TestChecksumBlockReader(t *testing.T) {
+	content := checksumBlocks(t,
+		TestBlockWithNumbers("1a", "00", 1, 0),
+		TestBlockWithNumbers("2a", "1a", 2, 0),
+	)
+
+	t.Run("round trip", func(t *testing.T) {
+		reader, err := NewChecksumBlockReader(bytes.NewReader(content))
+		require.NoError(t, err)
+
+		blk, err := reader.Read()
+		require.NoError(t, err)
+		assert.Equal(t, "1a", blk.Id)
+		blk, err = reader.Read()
+		require.NoError(t, err)
+		assert.Equal(t, "2a", blk.Id)
+		_, err = reader.Read()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("corrupted block", func(t *testing.T) {
+		corrupted := append([]byte{}, content...)
+		corrupted[len(corrupted)-3] ^= 0xFF
+
+		reader, err := NewChecksumBlockReader(bytes.NewReader(corrupted))
+		require.NoError(t, err)
+
+		_, err = reader.Read()
+		require.NoError(t, err)
+		_, err = reader.Read()
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrChecksumMismatch))
+		assert.Contains(t, err.Error(), "block #2")
+	})
+
+	t.Run("dbin file rejected", func(t *testing.T) {
+		_, err := NewChecksumBlockReader(bytes.NewReader(testBlocks(TestBlockWithNumbers("1a", "00", 1, 0))))
+		assert.Error(t, err)
+	})
+}
+
+func TestChecksumFileSource(t *testing.T) {
+	bs := dstore.NewMockStore(nil)
+	bs.SetFile(base(0), checksumBlocks(t,
+		TestBlockWithNumbers("1a", "00", 1, 0),
+		TestBlockWithNumbers("2a", "1a", 2, 0),
+	))
+	bs.SetFile(base(100), checksumBlocks(t,
+		TestBlockWithNumbers("103a", "2a", 103, 0),
+	))
+
+	done := make(chan struct{})
+	var received []uint64
+	handler := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		received = append(received, blk.Number)
+		if blk.Number == 103 {
+			close(done)
+		}
+		return nil
+	})
+
+	fs := NewChecksumFileSource(bs, 1, handler, zlog)
+	go fs.Run()
+	defer fs.Shutdown(nil)
+
+	select {
+	case <-done:
+		assert.Equal(t, []uint64{1, 2, 103}, received)
+	case <-time.After(time.Second):
+		t.Error("Test timeout")
+	}
+}
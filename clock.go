@@ -0,0 +1,20 @@
+package bstream
+
+import (
+	"time"
+)
+
+// Clock is the source of the current time of time-based logic, a fake one
+// makes that logic testable deterministically, without sleeps.
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is the default Clock, it reads the system time
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,30 @@
+package bstream
+
+import (
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+)
+
+// NewCompareHandler returns a handler checking each block it handles against
+// the next block read from `reference`, typically fed by a second source
+// streaming the same range from another deployment. A divergence on the block
+// ID, number or LIB number is reported to `onMismatch`, with a nil `want`
+// once `reference` is closed. The handler never fails, it only reports.
+//
+// Blocks are paired by position: both streams must deliver the same steps in
+// the same order (e.g. both final blocks only, or both with the same forks
+// seen), otherwise every block after the first difference is reported. The
+// handler blocks until the reference block is available.
+func NewCompareHandler(reference <-chan *pbbstream.Block, onMismatch func(got, want *pbbstream.Block)) Handler {
+	return HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		want, ok := <-reference
+		if !ok || want == nil {
+			onMismatch(blk, nil)
+			return nil
+		}
+
+		if blk.Id != want.Id || blk.Number != want.Number || blk.LibNum != want.LibNum {
+			onMismatch(blk, want)
+		}
+		return nil
+	})
+}
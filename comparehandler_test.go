@@ -0,0 +1,51 @@
+package bstream
+
+import (
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareHandler(t *testing.T) {
+	reference := make(chan *pbbstream.Block, 3)
+	reference <- TestBlockWithLIBNum("00000001a", "00000000a", 0)
+	reference <- TestBlockWithLIBNum("00000002a", "00000001a", 1)
+	reference <- TestBlockWithLIBNum("00000003a", "00000002a", 1)
+	close(reference)
+
+	type mismatch struct{ got, want string }
+	var mismatches []mismatch
+	handler := NewCompareHandler(reference, func(got, want *pbbstream.Block) {
+		m := mismatch{got: got.Id}
+		if want != nil {
+			m.want = want.Id
+		}
+		mismatches = append(mismatches, m)
+	})
+
+	for _, blk := range []*pbbstream.Block{
+		TestBlockWithLIBNum("00000001a", "00000000a", 0),
+		TestBlockWithLIBNum("00000002b", "00000001a", 1),
+		TestBlockWithLIBNum("00000003a", "00000002a", 1),
+		TestBlockWithLIBNum("00000004a", "00000003a", 1),
+	} {
+		require.NoError(t, handler.ProcessBlock(blk, nil))
+	}
+
+	assert.Equal(t, []mismatch{
+		{got: "00000002b", want: "00000002a"},
+		{got: "00000004a"},
+	}, mismatches)
+}
+
+func TestCompareHandler_LIBNumMismatch(t *testing.T) {
+	reference := make(chan *pbbstream.Block, 1)
+	reference <- TestBlockWithLIBNum("00000002a", "00000001a", 1)
+
+	var mismatched bool
+	handler := NewCompareHandler(reference, func(got, want *pbbstream.Block) { mismatched = true })
+	require.NoError(t, handler.ProcessBlock(TestBlockWithLIBNum("00000002a", "00000001a", 0), nil))
+	assert.True(t, mismatched)
+}
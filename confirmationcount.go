@@ -0,0 +1,117 @@
+package bstream
+
+import (
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+)
+
+// ConfirmedObject is the object a ConfirmationCountHandler passes to its
+// handler, it wraps the ForkableObject it received, so its step, cursor and
+// wrapped object are unchanged.
+type ConfirmedObject struct {
+	ForkableObject
+
+	// Confirmations is the number of blocks of the canonical chain above the
+	// block when it was emitted, that is the cursor head block number minus
+	// the block number. It is always 0 on undo steps.
+	Confirmations uint64
+}
+
+func (o *ConfirmedObject) Attachments() Attachments {
+	return AttachmentsFromObject(o.ForkableObject)
+}
+
+type ConfirmationCountOption func(h *ConfirmationCountHandler)
+
+// ConfirmationCountWithUpdates calls `onUpdate` with the new confirmation
+// count of every block sent as New and not yet irreversible each time the head
+// advances, since the handler only sees each block once per step. Blocks stop
+// being tracked once undone or at or below the LIB.
+func ConfirmationCountWithUpdates(onUpdate func(blk BlockRef, confirmations uint64)) ConfirmationCountOption {
+	return func(h *ConfirmationCountHandler) {
+		h.onUpdate = onUpdate
+	}
+}
+
+// ConfirmationCountHandler attaches to the ForkableObjects going through it
+// the number of confirmations of their block at emission time, see
+// ConfirmedObject, for consumers showing confirmation progress. Objects not
+// implementing ForkableObject are passed as is.
+type ConfirmationCountHandler struct {
+	handler  Handler
+	onUpdate func(blk BlockRef, confirmations uint64)
+
+	unconfirmed []BlockRef // blocks sent as New above the LIB, tracked for updates
+	headNum     uint64
+}
+
+func NewConfirmationCountHandler(inner Handler, opts ...ConfirmationCountOption) *ConfirmationCountHandler {
+	h := &ConfirmationCountHandler{
+		handler: inner,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *ConfirmationCountHandler) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
+	fobj, ok := obj.(ForkableObject)
+	if !ok || fobj.Cursor() == nil {
+		return h.handler.ProcessBlock(blk, obj)
+	}
+
+	cursor := fobj.Cursor()
+	step := fobj.Step()
+
+	var confirmations uint64
+	if !step.Matches(StepUndo) && cursor.HeadBlock.Num() > blk.Number {
+		confirmations = cursor.HeadBlock.Num() - blk.Number
+	}
+
+	if err := h.handler.ProcessBlock(blk, &ConfirmedObject{ForkableObject: fobj, Confirmations: confirmations}); err != nil {
+		return err
+	}
+
+	if h.onUpdate != nil {
+		h.track(blk.AsRef(), step, cursor)
+	}
+	return nil
+}
+
+// track maintains the blocks awaiting confirmation updates and sends them
+// when the head advances
+func (h *ConfirmationCountHandler) track(ref BlockRef, step StepType, cursor *Cursor) {
+	switch {
+	case step.Matches(StepNew):
+		h.unconfirmed = append(h.unconfirmed, ref)
+	case step.Matches(StepUndo):
+		for i, tracked := range h.unconfirmed {
+			if tracked.ID() == ref.ID() {
+				h.unconfirmed = append(h.unconfirmed[:i], h.unconfirmed[i+1:]...)
+				break
+			}
+		}
+	}
+
+	libNum := cursor.LIB.Num()
+	kept := h.unconfirmed[:0]
+	for _, tracked := range h.unconfirmed {
+		if tracked.Num() > libNum {
+			kept = append(kept, tracked)
+		}
+	}
+	h.unconfirmed = kept
+
+	headNum := cursor.HeadBlock.Num()
+	if headNum <= h.headNum {
+		return
+	}
+	h.headNum = headNum
+
+	for _, tracked := range h.unconfirmed {
+		if tracked.ID() == ref.ID() || tracked.Num() > headNum {
+			continue
+		}
+		h.onUpdate(tracked, headNum-tracked.Num())
+	}
+}
@@ -0,0 +1,62 @@
+package bstream
+
+import (
+	"fmt"
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmationCountHandler(t *testing.T) {
+	obj := func(step StepType, blk, head, lib string) *preprocessedForkableObject {
+		return &preprocessedForkableObject{
+			step:   step,
+			obj:    "payload",
+			cursor: &Cursor{Step: step, Block: bRef(blk), HeadBlock: bRef(head), LIB: bRef(lib)},
+		}
+	}
+
+	var received []string
+	var updates []string
+	h := NewConfirmationCountHandler(HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		confirmed := obj.(*ConfirmedObject)
+		assert.Equal(t, "payload", confirmed.WrappedObject())
+		received = append(received, fmt.Sprintf("%s:%s:%d", confirmed.Step(), blk.Id, confirmed.Confirmations))
+		return nil
+	}), ConfirmationCountWithUpdates(func(blk BlockRef, confirmations uint64) {
+		updates = append(updates, fmt.Sprintf("%s:%d", blk.ID(), confirmations))
+	}))
+
+	require.NoError(t, h.ProcessBlock(TestBlock("00000002a", "00000001a"), obj(StepNew, "00000002a", "00000002a", "00000001a")))
+	require.NoError(t, h.ProcessBlock(TestBlock("00000003a", "00000002a"), obj(StepNew, "00000003a", "00000003a", "00000001a")))
+	require.NoError(t, h.ProcessBlock(TestBlock("00000003a", "00000002a"), obj(StepUndo, "00000003a", "00000004b", "00000001a")))
+	require.NoError(t, h.ProcessBlock(TestBlock("00000003b", "00000002a"), obj(StepNew, "00000003b", "00000004b", "00000001a")))
+	require.NoError(t, h.ProcessBlock(TestBlock("00000004b", "00000003b"), obj(StepNew, "00000004b", "00000004b", "00000001a")))
+	require.NoError(t, h.ProcessBlock(TestBlock("00000002a", "00000001a"), obj(StepIrreversible, "00000002a", "00000005b", "00000002a")))
+	require.NoError(t, h.ProcessBlock(TestBlock("00000005b", "00000004b"), obj(StepNew, "00000005b", "00000005b", "00000002a")))
+
+	assert.Equal(t, []string{
+		"new:00000002a:0",
+		"new:00000003a:0",
+		"undo:00000003a:0",
+		"new:00000003b:1",
+		"new:00000004b:0",
+		"irreversible:00000002a:3",
+		"new:00000005b:0",
+	}, received)
+
+	assert.Equal(t, []string{
+		"00000002a:1", // head 3a
+		"00000002a:2", // head 4b, on undo of 3a
+		"00000003b:2", // head 5b, 2a is irreversible
+		"00000004b:1",
+	}, updates)
+
+	plain := NewConfirmationCountHandler(HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		assert.Equal(t, "raw", obj)
+		return nil
+	}))
+	require.NoError(t, plain.ProcessBlock(TestBlock("00000002a", "00000001a"), "raw"))
+}
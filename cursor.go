@@ -51,6 +51,171 @@ func (c *Cursor) Equals(cc *Cursor) bool {
 		c.LIB.ID() == cc.LIB.ID()
 }
 
+// DiffCursors compares two cursors of the same stream. `advancedBy` and
+// `libAdvancedBy` are the block num deltas of the cursors' block and LIB
+// (negative when going backward). `reorged` is true when `old` block can no
+// longer be on the chain of `new`: the new cursor is an undo step, it is
+// behind the old one, or the cursors disagree on the block ID at a height
+// both refer to. When `new` LIB is past `old` head without any height in
+// common, `old` block cannot be related to the chain of `new` and is reported
+// reorged, so cursors from different chains always end up reorged. An empty
+// `old` cursor counts as streaming from the start.
+func DiffCursors(old, new *Cursor) (advancedBy int64, reorged bool, libAdvancedBy int64) {
+	if new.IsEmpty() {
+		return 0, false, 0
+	}
+	if old.IsEmpty() {
+		return int64(new.Block.Num()), false, int64(new.LIB.Num())
+	}
+
+	advancedBy = int64(new.Block.Num()) - int64(old.Block.Num())
+	libAdvancedBy = int64(new.LIB.Num()) - int64(old.LIB.Num())
+
+	switch {
+	case new.Step.Matches(StepUndo):
+		reorged = true
+	case advancedBy < 0:
+		reorged = true
+	case libAdvancedBy < 0:
+		reorged = true
+	default:
+		reorged = conflictingRefs(old.Block, new.Block, new.LIB, new.HeadBlock) ||
+			conflictingRefs(old.LIB, new.Block, new.LIB, new.HeadBlock) ||
+			(new.LIB.Num() > old.HeadBlock.Num() && !sharedHeight(old, new))
+	}
+	return
+}
+
+// DeliveredThrough returns the highest block number the consumer holds once
+// it has processed the cursor, along with the cursor step. After an undo
+// step, the undone block is no longer held: the number returned is the one
+// right below it, as chains may skip numbers, its parent can be lower. An
+// empty cursor returns 0 and no step.
+func (c *Cursor) DeliveredThrough() (block uint64, step StepType) {
+	if c.IsEmpty() {
+		return 0, 0
+	}
+	if c.Step.Matches(StepUndo) {
+		return c.Block.Num() - 1, c.Step
+	}
+	return c.Block.Num(), c.Step
+}
+
+// FinalBlockNumsDelivered enumerates the block numbers delivered as final
+// between two consecutive cursors of the same stream, `prev` excluded and
+// `next` included. A block is delivered as final once it is at or below the
+// LIB of a cursor the consumer processed: the numbers above the LIB of `next`
+// are left out, they may still be undone, and the numbers undone across a
+// reorg are never included, since only blocks above the LIB can be undone.
+// The range is `(prev.LIB, next.LIB]`, capped to `next.DeliveredThrough()`;
+// on chains skipping numbers, some of them have no block. An empty `prev`
+// cursor counts as streaming from the start. Nil is returned when nothing new
+// became final.
+func FinalBlockNumsDelivered(prev, next *Cursor) []uint64 {
+	if next.IsEmpty() {
+		return nil
+	}
+
+	var low uint64
+	if !prev.IsEmpty() {
+		low = prev.LIB.Num() + 1
+	}
+	high := next.LIB.Num()
+	if through, _ := next.DeliveredThrough(); through < high {
+		high = through
+	}
+	if high < low {
+		return nil
+	}
+
+	nums := make([]uint64, 0, high-low+1)
+	for num := low; num <= high; num++ {
+		nums = append(nums, num)
+	}
+	return nums
+}
+
+// conflictingRefs returns true if one of `refs` has the same num as `ref` but
+// a different ID.
+func conflictingRefs(ref BlockRef, refs ...BlockRef) bool {
+	for _, other := range refs {
+		if other.Num() == ref.Num() && other.ID() != ref.ID() {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedHeight returns true if a block of `a` has the same num as a block of
+// `b`, their IDs at that height can then be compared.
+func sharedHeight(a, b *Cursor) bool {
+	for _, ref := range []BlockRef{a.Block, a.LIB, a.HeadBlock} {
+		for _, other := range []BlockRef{b.Block, b.LIB, b.HeadBlock} {
+			if ref.Num() == other.Num() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Validate checks that the cursor, typically received from a client, is
+// internally consistent before it is used to resume a stream:
+//
+//   - its block, head block and LIB all have an ID
+//   - New cursors have LIB <= Block <= HeadBlock
+//   - Irreversible cursors point to their LIB, which is <= HeadBlock
+//   - Undo cursors point to a block above LIB, since irreversible blocks are never undone
+//
+// The cursor blocks are not checked against any chain.
+func (c *Cursor) Validate() error {
+	if c == nil {
+		return fmt.Errorf("nil cursor")
+	}
+
+	if err := validateCursorRef("block", c.Block); err != nil {
+		return err
+	}
+	if err := validateCursorRef("head block", c.HeadBlock); err != nil {
+		return err
+	}
+	if err := validateCursorRef("lib", c.LIB); err != nil {
+		return err
+	}
+
+	switch c.Step {
+	case StepNew, StepNewIrreversible:
+		if c.LIB.Num() > c.Block.Num() {
+			return fmt.Errorf("lib %s is above block %s", c.LIB, c.Block)
+		}
+		if c.Block.Num() > c.HeadBlock.Num() {
+			return fmt.Errorf("block %s is above head block %s", c.Block, c.HeadBlock)
+		}
+	case StepIrreversible:
+		if c.LIB.ID() != c.Block.ID() || c.LIB.Num() != c.Block.Num() {
+			return fmt.Errorf("irreversible block %s is not the lib %s", c.Block, c.LIB)
+		}
+		if c.Block.Num() > c.HeadBlock.Num() {
+			return fmt.Errorf("block %s is above head block %s", c.Block, c.HeadBlock)
+		}
+	case StepUndo:
+		if c.Block.Num() <= c.LIB.Num() {
+			return fmt.Errorf("undone block %s is not above lib %s", c.Block, c.LIB)
+		}
+	default:
+		return fmt.Errorf("invalid step %q (%d)", c.Step, c.Step)
+	}
+
+	return nil
+}
+
+func validateCursorRef(name string, ref BlockRef) error {
+	if ref == nil || ref.ID() == "" {
+		return fmt.Errorf("%s has no ID", name)
+	}
+	return nil
+}
+
 func (c *Cursor) IsEmpty() bool {
 	return c == nil ||
 		c.Block == nil ||
@@ -74,8 +239,27 @@ func (c *Cursor) String() string {
 	return fmt.Sprintf("c3:%d:%d:%s:%d:%s:%d:%s", c.Step, c.Block.Num(), blkID, c.HeadBlock.Num(), headID, c.LIB.Num(), libID)
 }
 
+// ParseCursor parses the string form of a cursor, as produced by
+// `Cursor.String()`, and validates the result. Use it to rebuild cursors from
+// stored strings, `CursorFromOpaque` handles the opaque form sent to clients.
+func ParseCursor(s string) (*Cursor, error) {
+	c, err := FromString(s)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cursor %q: %w", s, err)
+	}
+	return c, nil
+}
+
+// FromString parses the string form of a cursor without validating it, see
+// `ParseCursor`.
 func FromString(cur string) (*Cursor, error) {
 	parts := strings.Split(cur, ":")
+	if version := parts[0]; version != "c1" && version != "c2" && version != "c3" {
+		return nil, fmt.Errorf("invalid cursor: unknown version %q", version)
+	}
 	if len(parts) < 6 {
 		return nil, fmt.Errorf("invalid cursor: too short")
 	}
@@ -168,7 +352,7 @@ func FromString(cur string) (*Cursor, error) {
 		}, nil
 
 	default:
-		return nil, fmt.Errorf("invalid cursor: invalid prefix")
+		return nil, fmt.Errorf("invalid cursor: unknown version %q", parts[0])
 	}
 
 }
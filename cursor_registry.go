@@ -0,0 +1,112 @@
+package bstream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/streamingfast/dstore"
+)
+
+const cursorRegistrySuffix = ".cursor"
+
+// CursorRegistry keeps the latest cursor reported by each consumer of a
+// shared stream, giving a central view of the slowest one: `MinLIB` is the
+// lowest LIB across all consumers, every block below it was seen as final by
+// all of them and can safely be pruned.
+//
+// Each report is persisted to the store as `<consumerID>.cursor`, call `Load`
+// on start to get back the cursors reported before a restart. The store must
+// allow overwriting since the same keys are written over and over again.
+type CursorRegistry struct {
+	sync.Mutex
+
+	store   dstore.Store
+	cursors map[string]*Cursor
+}
+
+func NewCursorRegistry(store dstore.Store) *CursorRegistry {
+	return &CursorRegistry{
+		store:   store,
+		cursors: make(map[string]*Cursor),
+	}
+}
+
+// Load reads back all the cursors persisted in the store, replacing the ones
+// reported for the same consumers.
+func (r *CursorRegistry) Load(ctx context.Context) error {
+	loaded := make(map[string]*Cursor)
+	err := r.store.Walk(ctx, "", func(filename string) error {
+		consumerID, found := strings.CutSuffix(filename, cursorRegistrySuffix)
+		if !found {
+			return nil
+		}
+
+		cursor, err := r.readCursor(ctx, filename)
+		if err != nil {
+			return fmt.Errorf("consumer %q: %w", consumerID, err)
+		}
+		loaded[consumerID] = cursor
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("loading cursor registry: %w", err)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	for consumerID, cursor := range loaded {
+		r.cursors[consumerID] = cursor
+	}
+	return nil
+}
+
+func (r *CursorRegistry) readCursor(ctx context.Context, filename string) (*Cursor, error) {
+	reader, err := r.store.OpenObject(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("opening cursor: %w", err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading cursor: %w", err)
+	}
+
+	return CursorFromOpaque(string(content))
+}
+
+// Report records and persists `c` as the latest cursor of `consumerID`. An
+// empty cursor is ignored.
+func (r *CursorRegistry) Report(consumerID string, c *Cursor) error {
+	if c.IsEmpty() {
+		return nil
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	key := consumerID + cursorRegistrySuffix
+	if err := r.store.WriteObject(context.Background(), key, strings.NewReader(c.ToOpaque())); err != nil {
+		return fmt.Errorf("writing cursor of consumer %q: %w", consumerID, err)
+	}
+	r.cursors[consumerID] = c
+	return nil
+}
+
+// MinLIB returns the lowest LIB across the cursors of all consumers, or
+// BlockRefEmpty when no consumer reported a cursor yet.
+func (r *CursorRegistry) MinLIB() BlockRef {
+	r.Lock()
+	defer r.Unlock()
+
+	var minLIB BlockRef = BlockRefEmpty
+	for _, cursor := range r.cursors {
+		if IsEmpty(minLIB) || cursor.LIB.Num() < minLIB.Num() {
+			minLIB = cursor.LIB
+		}
+	}
+	return minLIB
+}
@@ -0,0 +1,50 @@
+package bstream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorRegistry(t *testing.T) {
+	store, _ := testCheckpointStore(t)
+	registry := NewCursorRegistry(store)
+
+	assert.True(t, IsEmpty(registry.MinLIB()))
+
+	require.NoError(t, registry.Report("fast", testCursorObj(StepNew, "00000010a", "00000008a").Cursor()))
+	require.NoError(t, registry.Report("slow", testCursorObj(StepNew, "00000005a", "00000003a").Cursor()))
+	require.NoError(t, registry.Report("empty", EmptyCursor))
+	assert.Equal(t, "00000003a", registry.MinLIB().ID())
+
+	require.NoError(t, registry.Report("slow", testCursorObj(StepIrreversible, "00000009a", "00000009a").Cursor()))
+	assert.Equal(t, "00000008a", registry.MinLIB().ID())
+
+	reloaded := NewCursorRegistry(store)
+	require.NoError(t, reloaded.Load(context.Background()))
+	assert.Equal(t, "00000008a", reloaded.MinLIB().ID())
+	assert.Len(t, reloaded.cursors, 2)
+}
+
+func TestCursorRegistry_ConcurrentReports(t *testing.T) {
+	store, _ := testCheckpointStore(t)
+	registry := NewCursorRegistry(store)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lib := fmt.Sprintf("%08xa", i)
+			assert.NoError(t, registry.Report(fmt.Sprintf("consumer-%d", i), testCursorObj(StepNew, fmt.Sprintf("%08xa", i+2), lib).Cursor()))
+			registry.MinLIB()
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, "00000001a", registry.MinLIB().ID())
+}
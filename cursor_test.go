@@ -67,3 +67,230 @@ func TestFromString(t *testing.T) {
 		})
 	}
 }
+
+func TestDiffCursors(t *testing.T) {
+	cursor := func(step StepType, blk, head, lib string) *Cursor {
+		return &Cursor{Step: step, Block: bRef(blk), HeadBlock: bRef(head), LIB: bRef(lib)}
+	}
+
+	tests := []struct {
+		name              string
+		old               *Cursor
+		new               *Cursor
+		expectAdvancedBy  int64
+		expectReorged     bool
+		expectLIBAdvanced int64
+	}{
+		{
+			name:              "empty old cursor",
+			old:               nil,
+			new:               cursor(StepNew, "00000005a", "00000005a", "00000003a"),
+			expectAdvancedBy:  5,
+			expectLIBAdvanced: 3,
+		},
+		{
+			name:              "linear progress",
+			old:               cursor(StepNew, "00000005a", "00000005a", "00000003a"),
+			new:               cursor(StepNew, "00000008a", "00000008a", "00000004a"),
+			expectAdvancedBy:  3,
+			expectLIBAdvanced: 1,
+		},
+		{
+			name:              "irreversible step on old block",
+			old:               cursor(StepNew, "00000005a", "00000005a", "00000003a"),
+			new:               cursor(StepIrreversible, "00000005a", "00000008a", "00000005a"),
+			expectAdvancedBy:  0,
+			expectLIBAdvanced: 2,
+		},
+		{
+			name:              "undo",
+			old:               cursor(StepNew, "00000005a", "00000005a", "00000003a"),
+			new:               cursor(StepUndo, "00000005a", "00000006b", "00000003a"),
+			expectReorged:     true,
+			expectLIBAdvanced: 0,
+		},
+		{
+			name:              "same height different block",
+			old:               cursor(StepNew, "00000005a", "00000005a", "00000003a"),
+			new:               cursor(StepNew, "00000005b", "00000005b", "00000003a"),
+			expectReorged:     true,
+			expectLIBAdvanced: 0,
+		},
+		{
+			name:              "went backward",
+			old:               cursor(StepNew, "00000005a", "00000005a", "00000003a"),
+			new:               cursor(StepNew, "00000004b", "00000004b", "00000003a"),
+			expectAdvancedBy:  -1,
+			expectReorged:     true,
+			expectLIBAdvanced: 0,
+		},
+		{
+			name:              "different chains",
+			old:               cursor(StepNew, "00000005a", "00000005a", "00000003a"),
+			new:               cursor(StepNew, "00000009z", "00000009z", "00000005z"),
+			expectAdvancedBy:  4,
+			expectReorged:     true,
+			expectLIBAdvanced: 2,
+		},
+		{
+			name:              "different chains without common height",
+			old:               cursor(StepNew, "00000005a", "00000005a", "00000003a"),
+			new:               cursor(StepNew, "00000009z", "00000009z", "00000007z"),
+			expectAdvancedBy:  4,
+			expectReorged:     true,
+			expectLIBAdvanced: 4,
+		},
+		{
+			name:              "linear progress past old head",
+			old:               cursor(StepNew, "00000005a", "00000005a", "00000003a"),
+			new:               cursor(StepNew, "00000009a", "00000009a", "00000005a"),
+			expectAdvancedBy:  4,
+			expectLIBAdvanced: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			advancedBy, reorged, libAdvancedBy := DiffCursors(test.old, test.new)
+			assert.Equal(t, test.expectAdvancedBy, advancedBy)
+			assert.Equal(t, test.expectReorged, reorged)
+			assert.Equal(t, test.expectLIBAdvanced, libAdvancedBy)
+		})
+	}
+}
+
+func TestCursor_DeliveredThrough(t *testing.T) {
+	cursor := func(step StepType, blk, head, lib string) *Cursor {
+		return &Cursor{Step: step, Block: bRef(blk), HeadBlock: bRef(head), LIB: bRef(lib)}
+	}
+
+	tests := []struct {
+		name        string
+		cursor      *Cursor
+		expectBlock uint64
+		expectStep  StepType
+	}{
+		{"empty", nil, 0, 0},
+		{"new", cursor(StepNew, "00000005a", "00000005a", "00000003a"), 5, StepNew},
+		{"irreversible", cursor(StepIrreversible, "00000003a", "00000005a", "00000003a"), 3, StepIrreversible},
+		{"undo", cursor(StepUndo, "00000005a", "00000006b", "00000003a"), 4, StepUndo},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block, step := test.cursor.DeliveredThrough()
+			assert.Equal(t, test.expectBlock, block)
+			assert.Equal(t, test.expectStep, step)
+		})
+	}
+}
+
+func TestFinalBlockNumsDelivered(t *testing.T) {
+	cursor := func(step StepType, blk, head, lib string) *Cursor {
+		return &Cursor{Step: step, Block: bRef(blk), HeadBlock: bRef(head), LIB: bRef(lib)}
+	}
+
+	tests := []struct {
+		name   string
+		prev   *Cursor
+		next   *Cursor
+		expect []uint64
+	}{
+		{
+			name:   "empty prev cursor",
+			prev:   nil,
+			next:   cursor(StepNew, "00000005a", "00000005a", "00000002a"),
+			expect: []uint64{0, 1, 2},
+		},
+		{
+			name:   "lib advancing",
+			prev:   cursor(StepNew, "00000005a", "00000005a", "00000002a"),
+			next:   cursor(StepNew, "00000006a", "00000006a", "00000004a"),
+			expect: []uint64{3, 4},
+		},
+		{
+			name:   "lib not moving",
+			prev:   cursor(StepNew, "00000005a", "00000005a", "00000002a"),
+			next:   cursor(StepNew, "00000006a", "00000006a", "00000002a"),
+			expect: nil,
+		},
+		{
+			name:   "irreversible step",
+			prev:   cursor(StepNew, "00000006a", "00000006a", "00000002a"),
+			next:   cursor(StepIrreversible, "00000003a", "00000006a", "00000003a"),
+			expect: []uint64{3},
+		},
+		{
+			name:   "undo across a reorg",
+			prev:   cursor(StepNew, "00000006a", "00000006a", "00000003a"),
+			next:   cursor(StepUndo, "00000006a", "00000007b", "00000004a"),
+			expect: []uint64{4},
+		},
+		{
+			name:   "new block after a reorg",
+			prev:   cursor(StepUndo, "00000006a", "00000007b", "00000004a"),
+			next:   cursor(StepNew, "00000006b", "00000007b", "00000004a"),
+			expect: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expect, FinalBlockNumsDelivered(test.prev, test.next))
+		})
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	tests := []struct {
+		name          string
+		in            string
+		expected      *Cursor
+		expectedError string
+	}{
+		{
+			name: "c1",
+			in:   "c1:1:3:00000003a:2:00000002a",
+			expected: &Cursor{
+				Step:      StepNew,
+				Block:     NewBlockRef("00000003a", 3),
+				HeadBlock: NewBlockRef("00000003a", 3),
+				LIB:       NewBlockRef("00000002a", 2),
+			},
+		},
+		{
+			name: "c2",
+			in:   "c2:16:2:00000002a:3:00000003a",
+			expected: &Cursor{
+				Step:      StepIrreversible,
+				Block:     NewBlockRef("00000002a", 2),
+				HeadBlock: NewBlockRef("00000003a", 3),
+				LIB:       NewBlockRef("00000002a", 2),
+			},
+		},
+		{name: "unknown version", in: "c4:1:3:00000003a:2:00000002a", expectedError: `unknown version "c4"`},
+		{name: "unknown short version", in: "v1:1", expectedError: `unknown version "v1"`},
+		{name: "empty", in: "", expectedError: `unknown version ""`},
+		{name: "too short", in: "c1:1:3", expectedError: "too short"},
+		{name: "invalid segments count", in: "c3:1:3:00000003a:2:00000002a", expectedError: "invalid number of segments"},
+		{name: "invalid num", in: "c1:1:three:00000003a:2:00000002a", expectedError: "invalid block num"},
+		{name: "invalid step", in: "c1:9:3:00000003a:2:00000002a", expectedError: "invalid step"},
+		{name: "lib above block", in: "c1:1:3:00000003a:4:00000004a", expectedError: "lib #4 (00000004a) is above block"},
+		{name: "no lib", in: "c1:1:3:00000003a:0:", expectedError: "lib has no ID"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := ParseCursor(test.in)
+			if test.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+			assert.Equal(t, test.in, actual.String())
+		})
+	}
+}
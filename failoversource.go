@@ -0,0 +1,219 @@
+package bstream
+
+import (
+	"sync"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/shutter"
+	"go.uber.org/zap"
+)
+
+type FailoverLiveSourceOption = func(s *FailoverLiveSource)
+
+func FailoverLiveSourceWithLogger(logger *zap.Logger) FailoverLiveSourceOption {
+	return func(s *FailoverLiveSource) {
+		s.logger = logger
+	}
+}
+
+// FailoverLiveSourceWithClock sets the clock used to detect stalls and to
+// pace the probes of the primary. Defaults to `RealClock`.
+func FailoverLiveSourceWithClock(clock Clock) FailoverLiveSourceOption {
+	return func(s *FailoverLiveSource) {
+		s.clock = clock
+	}
+}
+
+// FailoverLiveSource streams live blocks from a primary source, switching to
+// a backup source when the primary sends no block for `stallTimeout` or
+// terminates. Unlike the MultiplexedSource, a single source is active at a
+// time to save resources: while on the backup, the primary is probed once
+// per `stallTimeout` and takes over again as soon as it sends a block.
+//
+// The last delivered block is the resume point across a switch: every source
+// is created from its ref, like with an EternalSource, so the new active
+// source sends the blocks following it, including the ones produced while the
+// previous source was stalled. That block itself is skipped if the new source
+// sends it again. A probe only proves the primary recovered, its blocks are
+// not delivered: a new primary source is created from the last delivered
+// block instead, since the backup may have delivered more blocks after the
+// probe was created.
+type FailoverLiveSource struct {
+	*shutter.Shutter
+
+	primary      SourceFromRefFactory
+	backup       SourceFromRefFactory
+	stallTimeout time.Duration
+	handler      Handler
+	logger       *zap.Logger
+	clock        Clock
+
+	lock           sync.Mutex // also held while a block is delivered, so switches happen between blocks
+	active         Source
+	activeIsBackup bool
+	probe          Source
+	lastProbeAt    time.Time
+	lastBlockAt    time.Time
+	lastDelivered  BlockRef
+}
+
+func NewFailoverLiveSource(primary SourceFromRefFactory, backup SourceFromRefFactory, stallTimeout time.Duration, handler Handler, opts ...FailoverLiveSourceOption) *FailoverLiveSource {
+	s := &FailoverLiveSource{
+		Shutter:       shutter.New(),
+		primary:       primary,
+		backup:        backup,
+		stallTimeout:  stallTimeout,
+		handler:       handler,
+		logger:        zlog,
+		clock:         RealClock,
+		lastDelivered: BlockRefEmpty,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.OnTerminating(func(err error) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.active != nil {
+			s.active.Shutdown(err)
+		}
+		if s.probe != nil {
+			s.probe.Shutdown(err)
+		}
+	})
+
+	return s
+}
+
+// UsingBackup returns true while the backup source is the active one.
+func (s *FailoverLiveSource) UsingBackup() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.activeIsBackup
+}
+
+func (s *FailoverLiveSource) Run() {
+	s.lock.Lock()
+	s.activate(false)
+	s.lock.Unlock()
+
+	checkEvery := s.stallTimeout / 4
+	if checkEvery < time.Millisecond {
+		checkEvery = time.Millisecond
+	}
+	ticker := time.NewTicker(checkEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.Terminating():
+			return
+		case <-ticker.C:
+			s.check()
+		}
+	}
+}
+
+func (s *FailoverLiveSource) check() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.IsTerminating() {
+		return
+	}
+
+	sinceLastBlock := s.clock.Now().Sub(s.lastBlockAt)
+	if s.active.IsTerminating() || sinceLastBlock > s.stallTimeout {
+		s.logger.Warn("live source stalled, failing over",
+			zap.Bool("from_backup", s.activeIsBackup),
+			zap.Duration("since_last_block", sinceLastBlock),
+			zap.Stringer("resume_after", s.lastDelivered),
+			zap.Error(s.active.Err()),
+		)
+		s.active.Shutdown(nil)
+		s.activate(!s.activeIsBackup)
+		return
+	}
+
+	if !s.activeIsBackup {
+		return
+	}
+	if s.probe != nil && s.probe.IsTerminating() {
+		s.probe = nil
+	}
+	if s.probe == nil && s.clock.Now().Sub(s.lastProbeAt) > s.stallTimeout {
+		s.lastProbeAt = s.clock.Now()
+		s.probe = s.newSource(s.primary)
+		go s.probe.Run()
+	}
+}
+
+// activate starts a new active source, the primary or the backup, from the
+// last delivered block. Used only if you already hold the s.lock!
+func (s *FailoverLiveSource) activate(backup bool) {
+	if s.probe != nil {
+		s.probe.Shutdown(nil)
+		s.probe = nil
+	}
+
+	factory := s.primary
+	if backup {
+		factory = s.backup
+	}
+
+	src := s.newSource(factory)
+	s.active = src
+	s.activeIsBackup = backup
+	s.lastBlockAt = s.clock.Now()
+	s.lastProbeAt = s.clock.Now()
+	go src.Run()
+}
+
+// newSource creates a source from the last delivered block. Used only if you
+// already hold the s.lock!
+func (s *FailoverLiveSource) newSource(factory SourceFromRefFactory) (src Source) {
+	src = factory(s.lastDelivered, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		s.lock.Lock()
+		if !s.deliverable(src, blk) {
+			s.lock.Unlock()
+			return nil
+		}
+
+		err := s.handler.ProcessBlock(blk, obj)
+		if err == nil {
+			s.lastDelivered = blk.AsRef()
+		}
+		s.lock.Unlock()
+
+		if err != nil {
+			s.Shutdown(err)
+		}
+		return err
+	}))
+	return src
+}
+
+// deliverable returns true if `blk`, sent by `src`, must be delivered. The
+// first block of the probe switches back to a new primary source. Used only
+// if you already hold the s.lock!
+func (s *FailoverLiveSource) deliverable(src Source, blk *pbbstream.Block) bool {
+	if s.IsTerminating() {
+		return false
+	}
+
+	if src == s.probe {
+		s.logger.Info("primary live source recovered, switching back to it", zap.Stringer("resume_after", s.lastDelivered))
+		s.active.Shutdown(nil)
+		s.activate(false)
+		return false
+	}
+	if src != s.active {
+		return false
+	}
+
+	s.lastBlockAt = s.clock.Now()
+	return blk.Id != s.lastDelivered.ID()
+}
@@ -0,0 +1,82 @@
+package bstream
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailoverLiveSource(t *testing.T) {
+	primaries := NewTestSourceFactory()
+	backups := NewTestSourceFactory()
+	clock := NewTestClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	var lock sync.Mutex
+	var received []string
+	// the stall timeout is only measured on the test clock, checks are triggered by hand
+	src := NewFailoverLiveSource(primaries.NewSourceFromRef, backups.NewSourceFromRef, time.Hour, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		lock.Lock()
+		defer lock.Unlock()
+		received = append(received, blk.Id)
+		return nil
+	}), FailoverLiveSourceWithClock(clock))
+	go src.Run()
+	defer src.Shutdown(nil)
+
+	nextSource := func(factory *TestSourceFactory) *TestSource {
+		select {
+		case s := <-factory.Created:
+			<-s.running
+			return s
+		case <-time.After(time.Second):
+			t.Fatal("source not created")
+		}
+		return nil
+	}
+
+	primary := nextSource(primaries)
+	assert.Equal(t, "", primary.StartBlockID)
+	require.NoError(t, primary.Push(TestBlock("00000001a", "00000000a"), nil))
+	require.NoError(t, primary.Push(TestBlock("00000002a", "00000001a"), nil))
+
+	// primary stalls
+	clock.Advance(2 * time.Hour)
+	src.check()
+	backup := nextSource(backups)
+	assert.Equal(t, "00000002a", backup.StartBlockID, "backup resumes from the last delivered block")
+	assert.True(t, src.UsingBackup())
+	assert.True(t, primary.IsTerminating())
+	require.NoError(t, primary.Push(TestBlock("00000003x", "00000002a"), nil), "blocks from the replaced primary are ignored")
+
+	require.NoError(t, backup.Push(TestBlock("00000002a", "00000001a"), nil), "resume block is skipped")
+	require.NoError(t, backup.Push(TestBlock("00000003a", "00000002a"), nil))
+	require.NoError(t, backup.Push(TestBlock("00000004a", "00000003a"), nil))
+	clock.Advance(30 * time.Minute)
+	require.NoError(t, backup.Push(TestBlock("00000005a", "00000004a"), nil))
+
+	// backup is healthy, primary gets probed
+	clock.Advance(40 * time.Minute)
+	src.check()
+	probe := nextSource(primaries)
+	assert.Equal(t, "00000005a", probe.StartBlockID)
+	assert.True(t, src.UsingBackup(), "primary is only probed while the backup is healthy")
+
+	require.NoError(t, backup.Push(TestBlock("00000006a", "00000005a"), nil))
+	require.NoError(t, probe.Push(TestBlock("00000006a", "00000005a"), nil), "probe blocks are not delivered")
+	assert.False(t, src.UsingBackup())
+	assert.True(t, backup.IsTerminating())
+	assert.True(t, probe.IsTerminating())
+
+	primary = nextSource(primaries)
+	assert.Equal(t, "00000006a", primary.StartBlockID, "primary resumes from the last block delivered by the backup")
+	require.NoError(t, primary.Push(TestBlock("00000007a", "00000006a"), nil))
+	require.NoError(t, backup.Push(TestBlock("00000007x", "00000006a"), nil), "blocks from the replaced backup are ignored")
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{"00000001a", "00000002a", "00000003a", "00000004a", "00000005a", "00000006a", "00000007a"}, received)
+}
@@ -15,7 +15,9 @@
 package bstream
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"sort"
@@ -36,12 +38,19 @@ type FileSource struct {
 
 	// blocksStore is where we access the blocks archives.
 	blocksStore dstore.Store
+	// secondaryStores are mirrors of blocksStore, used when it is unhealthy
+	secondaryStores     []dstore.Store
+	storeHealthChecker  func(store dstore.Store) bool
+	storeHealthInterval time.Duration
+	storeHealth         *storeHealth
 
 	startBlockNum uint64
 	stopBlockNum  uint64
 	bundleSize    uint64
 
 	preprocFunc PreprocessFunc
+	// blocks below are sent without running preprocFunc
+	preprocessFromBlockNum uint64
 	// gates incoming blocks based on Gator type BEFORE pre-processing
 	gator Gator
 
@@ -57,6 +66,7 @@ type FileSource struct {
 	// fileStream is a chan of blocks coming from blocks archives, ordered
 	// and parallel processed
 	fileStream                chan *incomingBlocksFile
+	readAhead                 int
 	highestFileProcessedBlock BlockRef
 	blockIndexProvider        BlockIndexProvider
 
@@ -68,9 +78,27 @@ type FileSource struct {
 	// every time we have not matched any blocks for that duration
 	timeBetweenProgressBlocks time.Duration
 
+	corruptBlockPolicy CorruptBlockPolicy
+	onCorruptBlockSkip func(filename string, err error)
+
+	// verifyBlockIDs recomputes the ID of each block sent with GetBlockIDVerifier
+	verifyBlockIDs bool
+
+	// onSlowBlock is called for blocks the handler took more than blockDeadline to process
+	blockDeadline time.Duration
+	onSlowBlock   func(blockNum uint64, took time.Duration)
+
+	// newBlockReader decodes merged blocks files, dbin format when nil
+	newBlockReader func(reader io.Reader) (blockReader, error)
+
 	logger *zap.Logger
 }
 
+// blockReader is implemented by the readers of the merged blocks file formats
+type blockReader interface {
+	Read() (*pbbstream.Block, error)
+}
+
 type FileSourceOption = func(s *FileSource)
 
 func FileSourceWithConcurrentPreprocess(preprocFunc PreprocessFunc, threadCount int) FileSourceOption {
@@ -80,6 +108,81 @@ func FileSourceWithConcurrentPreprocess(preprocFunc PreprocessFunc, threadCount
 	}
 }
 
+// FileSourceWithPreprocessFromBlock skips the preprocess func on blocks below
+// `blockNum`, they are sent with a nil wrapped object. Resuming from a cursor
+// reads blocks from its LIB, use it with the cursor block number so blocks
+// only needed to resolve the cursor are not preprocessed. The handler must
+// then preprocess the blocks it actually uses, like a `Preprocessor` does
+// with ForkableObjects having no wrapped object.
+func FileSourceWithPreprocessFromBlock(blockNum uint64) FileSourceOption {
+	return func(s *FileSource) {
+		s.preprocessFromBlockNum = blockNum
+	}
+}
+
+// FileSourceWithReadAhead downloads up to `n` merged blocks files ahead of the
+// one being sent, each one fully into memory by its own goroutine, to hide the
+// latency of remote stores. Memory is bounded to `n+1` files: no further file
+// is fetched until the handler is done with the current one.
+func FileSourceWithReadAhead(n int) FileSourceOption {
+	return func(s *FileSource) {
+		if n > 0 {
+			s.readAhead = n
+			s.fileStream = make(chan *incomingBlocksFile, n)
+		}
+	}
+}
+
+// CorruptBlockPolicy is what a FileSource does with a block record that
+// cannot be decoded, see `FileSourceWithCorruptBlockPolicy`.
+type CorruptBlockPolicy int
+
+const (
+	// CorruptBlockFail shuts the source down with the decoding error, the default.
+	CorruptBlockFail CorruptBlockPolicy = iota
+	// CorruptBlockSkip drops the block and goes on with the next one.
+	CorruptBlockSkip
+)
+
+// FileSourceWithCorruptBlockPolicy sets what to do with a block that cannot
+// be decoded: with CorruptBlockSkip, `onSkip`, when not nil, is called with
+// the merged blocks file name and the decoding error, and the next blocks are
+// sent. Only records that were fully read are skipped, a truncated file still
+// fails the source.
+//
+// Skipping leaves a hole in the chain, the next block does not link to the
+// previous one: this is meant for raw reads, not for sources feeding a
+// forkable or relying on the order of blocks, like with a block index.
+func FileSourceWithCorruptBlockPolicy(policy CorruptBlockPolicy, onSkip func(filename string, err error)) FileSourceOption {
+	return func(s *FileSource) {
+		s.corruptBlockPolicy = policy
+		s.onCorruptBlockSkip = onSkip
+	}
+}
+
+// FileSourceWithIDVerification recomputes the ID of each block sent with the
+// `GetBlockIDVerifier` of the chain and fails on the first block whose ID does
+// not match, catching corrupted or tampered merged blocks files. It costs a
+// hash of every block, use it when reading from untrusted storage.
+func FileSourceWithIDVerification() FileSourceOption {
+	return func(s *FileSource) {
+		s.verifyBlockIDs = true
+	}
+}
+
+// FileSourceWithPerBlockDeadline measures the time the handler takes to
+// process each block and calls `onSlow` with the block number and that time
+// for every block taking more than `d`. The block is not aborted nor the
+// source stopped, this only finds slow blocks, huge ones for example; use
+// NewTimeoutHandler to fail on them instead. With a nil `onSlow`, blocks are
+// not timed.
+func FileSourceWithPerBlockDeadline(d time.Duration, onSlow func(blockNum uint64, took time.Duration)) FileSourceOption {
+	return func(s *FileSource) {
+		s.blockDeadline = d
+		s.onSlowBlock = onSlow
+	}
+}
+
 func FileSourceWithWhitelistedBlocks(nums ...uint64) FileSourceOption {
 	return func(s *FileSource) {
 		if s.whitelistedBlocks == nil {
@@ -168,6 +271,12 @@ func (g *FileSourceFactory) SourceThroughCursor(start uint64, cursor *Cursor, h
 	)
 }
 
+// NewFileSourceFromCursor resumes after `cursor`, reading from its LIB to
+// resolve it. With a block index provider, the cursor LIB and block, and the
+// blocks following them, are always read even if the index skips them: for a
+// cursor on the canonical chain, the blocks between its LIB and its block that
+// were read are sent as irreversible, its block included unless the cursor
+// was already final, then the blocks after it flow as new and irreversible.
 func NewFileSourceFromCursor(
 	mergedBlocksStore dstore.Store,
 	forkedBlocksStore dstore.Store,
@@ -180,8 +289,9 @@ func NewFileSourceFromCursor(
 	wrappedHandler := newCursorResolverHandler(forkedBlocksStore, cursor, false, h, logger)
 
 	// first block after cursor's block/lib will be sent even if they don't match filter
-	// cursor's block/lib also need to match
-	tweakedOptions := append(options, FileSourceWithWhitelistedBlocks(
+	// cursor's block/lib also need to match. The options are copied, they can
+	// come from a factory shared by concurrent calls.
+	tweakedOptions := append(append([]FileSourceOption{}, options...), FileSourceWithWhitelistedBlocks(
 		cursor.LIB.Num(),
 		cursor.LIB.Num()+1,
 		cursor.Block.Num(),
@@ -210,8 +320,8 @@ func NewFileSourceThroughCursor(
 	wrappedHandler := newCursorResolverHandler(forkedBlocksStore, cursor, true, h, logger)
 
 	// first block after cursor's block/lib will be sent even if they don't match filter
-	// cursor's block/lib also need to match
-	tweakedOptions := append(options, FileSourceWithWhitelistedBlocks(
+	// cursor's block/lib also need to match, see NewFileSourceFromCursor
+	tweakedOptions := append(append([]FileSourceOption{}, options...), FileSourceWithWhitelistedBlocks(
 		startBlockNum,
 		cursor.LIB.Num(),
 		cursor.LIB.Num()+1,
@@ -238,7 +348,7 @@ func NewFileSource(
 ) *FileSource {
 	s := &FileSource{
 		startBlockNum:             startBlockNum,
-		bundleSize:                100,
+		bundleSize:                GetMergedBlocksBundleSize,
 		blocksStore:               blocksStore,
 		fileStream:                make(chan *incomingBlocksFile, 1),
 		Shutter:                   shutter.New(),
@@ -251,6 +361,7 @@ func NewFileSource(
 	for _, option := range options {
 		option(s)
 	}
+	s.storeHealth = newStoreHealth(append([]dstore.Store{blocksStore}, s.secondaryStores...))
 
 	return s
 }
@@ -259,12 +370,12 @@ func (s *FileSource) Run() {
 	s.Shutdown(s.run())
 }
 
-func (s *FileSource) checkExists(baseBlockNum uint64) (exists bool, baseFilename string, err error) {
-	baseFilename = fmt.Sprintf("%010d", baseBlockNum)
+func (s *FileSource) checkExists(store dstore.Store, baseBlockNum uint64) (exists bool, baseFilename string, err error) {
+	baseFilename = mergedFileName(baseBlockNum)
 	timeout := 4 * time.Second
 	for i := 1; i <= 5; i++ {
 		ctx, cancel := context.WithTimeout(context.Background(), timeout)
-		exists, err = s.blocksStore.FileExists(ctx, baseFilename)
+		exists, err = store.FileExists(ctx, baseFilename)
 		cancel()
 		if err != nil {
 			timeout += time.Duration(i) * time.Second
@@ -276,6 +387,10 @@ func (s *FileSource) checkExists(baseBlockNum uint64) (exists bool, baseFilename
 }
 
 func (s *FileSource) run() (err error) {
+	if s.storeHealthChecker != nil {
+		s.storeHealth.check(s.storeHealthChecker, s.logger)
+		go s.watchStoreHealth(s.storeHealthInterval)
+	}
 
 	go s.launchReader()
 
@@ -310,7 +425,7 @@ func (s *FileSource) run() (err error) {
 					lastBlockID = preBlock.Block.Id
 				}
 
-				if err := s.handler.ProcessBlock(preBlock.Block, preBlock.Obj); err != nil {
+				if err := s.processBlock(preBlock); err != nil {
 					return err
 				}
 				if s.highestFileProcessedBlock != nil && preBlock.Num() > s.highestFileProcessedBlock.Num() {
@@ -322,6 +437,20 @@ func (s *FileSource) run() (err error) {
 
 }
 
+func (s *FileSource) processBlock(preBlock *PreprocessedBlock) error {
+	if s.onSlowBlock == nil {
+		return s.handler.ProcessBlock(preBlock.Block, preBlock.Obj)
+	}
+
+	start := time.Now()
+	err := s.handler.ProcessBlock(preBlock.Block, preBlock.Obj)
+	if took := time.Since(start); took > s.blockDeadline {
+		FileSourceSlowBlocks.Inc()
+		s.onSlowBlock(preBlock.Num(), took)
+	}
+	return err
+}
+
 func (s *FileSource) tweakRangeIndexResults(baseBlock uint64, inBlocks []uint64) []uint64 {
 	var addBlocks []uint64
 	for wl := range s.whitelistedBlocks {
@@ -399,7 +528,7 @@ func (s *FileSource) lookupBlockIndex(in uint64) (baseBlock uint64, outBlocks []
 	}
 }
 
-func (s *FileSource) streamReader(blockReader *DBinBlockReader, prevLastBlockRead BlockRef, incomingBlockFile *incomingBlocksFile) (err error) {
+func (s *FileSource) streamReader(blockReader blockReader, prevLastBlockRead BlockRef, incomingBlockFile *incomingBlocksFile) (err error) {
 	var previousLastBlockPassed bool
 	if prevLastBlockRead == nil {
 		previousLastBlockPassed = true
@@ -445,6 +574,13 @@ func (s *FileSource) streamReader(blockReader *DBinBlockReader, prevLastBlockRea
 
 		var blk *pbbstream.Block
 		blk, err = blockReader.Read()
+		if errors.Is(err, ErrCorruptBlock) && s.corruptBlockPolicy == CorruptBlockSkip {
+			s.logger.Warn("skipping corrupt block", zap.String("filename", incomingBlockFile.filename), zap.Error(err))
+			if s.onCorruptBlockSkip != nil {
+				s.onCorruptBlockSkip(incomingBlockFile.filename, err)
+			}
+			continue
+		}
 		if err != nil && err != io.EOF {
 			close(preprocessed)
 			return err
@@ -490,6 +626,13 @@ func (s *FileSource) streamReader(blockReader *DBinBlockReader, prevLastBlockRea
 			continue
 		}
 
+		if s.verifyBlockIDs {
+			if err := verifyBlockID(blk); err != nil {
+				close(preprocessed)
+				return fmt.Errorf("%w in merged blocks file %q", err, incomingBlockFile.filename)
+			}
+		}
+
 		out := make(chan *PreprocessedBlock, 1)
 
 		select {
@@ -505,10 +648,31 @@ func (s *FileSource) streamReader(blockReader *DBinBlockReader, prevLastBlockRea
 	return nil
 }
 
+// ErrBlockIDMismatch is wrapped by the error of a FileSource with ID
+// verification reading a block whose ID is not the one computed from it.
+var ErrBlockIDMismatch = errors.New("block ID mismatch")
+
+// verifyBlockID checks the ID of `blk` against the one GetBlockIDVerifier
+// computes from its content.
+func verifyBlockID(blk *pbbstream.Block) error {
+	if GetBlockIDVerifier == nil {
+		return fmt.Errorf("cannot verify block %s: no bstream.GetBlockIDVerifier registered", blk.AsRef())
+	}
+
+	computedID, err := GetBlockIDVerifier(blk)
+	if err != nil {
+		return fmt.Errorf("computing ID of block %s: %w", blk.AsRef(), err)
+	}
+	if NormalizeBlockID(computedID) != NormalizeBlockID(blk.Id) {
+		return fmt.Errorf("block #%d has ID %q but its computed ID is %q: %w", blk.Number, blk.Id, computedID, ErrBlockIDMismatch)
+	}
+	return nil
+}
+
 func (s *FileSource) preprocess(block *pbbstream.Block, out chan *PreprocessedBlock) {
 	var obj interface{}
 	var err error
-	if s.preprocFunc != nil {
+	if s.preprocFunc != nil && block.Number >= s.preprocessFromBlockNum {
 		obj, err = s.preprocFunc(block)
 		if err != nil {
 			s.Shutdown(fmt.Errorf("preprocess block: %s: %w", block, err))
@@ -548,8 +712,21 @@ func (s *FileSource) streamIncomingFile(newIncomingFile *incomingBlocksFile, blo
 		}
 	}()
 
-	//blockReader, err := s.blockReaderFactory.New(reader)
-	blockReader, err := NewDBinBlockReader(reader)
+	var content io.Reader = reader
+	if s.readAhead > 0 {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return fmt.Errorf("downloading %s from block store: %w", newIncomingFile.filename, err)
+		}
+		content = bytes.NewReader(data)
+	}
+
+	var blockReader blockReader
+	if s.newBlockReader != nil {
+		blockReader, err = s.newBlockReader(content)
+	} else {
+		blockReader, err = NewDBinBlockReader(content)
+	}
 	if err != nil {
 		return fmt.Errorf("unable to create block reader: %w", err)
 	}
@@ -564,6 +741,10 @@ func (s *FileSource) launchReader() {
 	baseBlockNum := lowBoundary(s.startBlockNum, s.bundleSize)
 	var delay time.Duration
 
+	// the index is dropped once exhausted, locally: the stream readers still
+	// rely on s.blockIndexProvider to know blocks may have been skipped
+	useIndex := s.blockIndexProvider != nil
+
 	defer close(s.fileStream)
 	for {
 		select {
@@ -572,19 +753,26 @@ func (s *FileSource) launchReader() {
 		case <-time.After(delay):
 		}
 
+		store := s.storeHealth.preferred()
+		if store == nil {
+			s.logger.Debug("no healthy blocks store, retrying in", zap.Duration("retry_delay", s.retryDelay))
+			delay = s.retryDelay
+			continue
+		}
+
 		var filteredBlocks []uint64
-		if s.blockIndexProvider != nil {
+		if useIndex {
 			nextBase, matching, noMoreIndex := s.lookupBlockIndex(baseBlockNum)
 			if noMoreIndex {
-				s.blockIndexProvider = nil
+				useIndex = false
 
-				exists, _, _ := s.checkExists(nextBase)
+				exists, _, _ := s.checkExists(store, nextBase)
 				if !exists && nextBase > baseBlockNum {
 					matching = nil
 					nextBase -= s.bundleSize
 					s.logger.Debug("index pushing us farther than the last bundle, reading previous one entirely", zap.Uint64("next_base", nextBase))
 				} else {
-					if nextExists, _, _ := s.checkExists(nextBase + s.bundleSize); !nextExists {
+					if nextExists, _, _ := s.checkExists(store, nextBase+s.bundleSize); !nextExists {
 						matching = nil
 						s.logger.Debug("index pushing us to the last bundle, reading it entirely", zap.Uint64("next_base", nextBase))
 					}
@@ -596,7 +784,7 @@ func (s *FileSource) launchReader() {
 		}
 
 		now := time.Now()
-		exists, baseFilename, err := s.checkExists(baseBlockNum)
+		exists, baseFilename, err := s.checkExists(store, baseBlockNum)
 		if err != nil {
 			s.logger.Warn("storage returned an error reading blocks file", zap.Error(err))
 			s.Shutdown(fmt.Errorf("filesource reading file existence: %w, since %s", err, time.Since(now)))
@@ -604,7 +792,7 @@ func (s *FileSource) launchReader() {
 		}
 
 		if !exists {
-			s.logger.Debug("reading from blocks store: file does not (yet?) exist, retrying in", zap.String("filename", s.blocksStore.ObjectPath(baseFilename)), zap.String("base_filename", baseFilename), zap.Any("retry_delay", s.retryDelay))
+			s.logger.Debug("reading from blocks store: file does not (yet?) exist, retrying in", zap.String("filename", store.ObjectPath(baseFilename)), zap.String("base_filename", baseFilename), zap.Any("retry_delay", s.retryDelay))
 			delay = s.retryDelay
 			continue
 		}
@@ -622,7 +810,7 @@ func (s *FileSource) launchReader() {
 
 		go func() {
 			s.logger.Debug("launching processing of file", zap.String("base_filename", baseFilename))
-			if err := s.streamIncomingFile(newIncomingFile, s.blocksStore); err != nil {
+			if err := s.streamIncomingFile(newIncomingFile, store); err != nil {
 				s.Shutdown(fmt.Errorf("processing of file %q failed: %w", baseFilename, err))
 			}
 		}()
@@ -16,7 +16,11 @@ package bstream
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -213,6 +217,190 @@ func TestFileSourceFromCursor(t *testing.T) {
 	fs.Shutdown(nil)
 }
 
+func TestFileSourceFromCursor_BlockIndex(t *testing.T) {
+	bs := dstore.NewMockStore(nil)
+	bs.SetFile(base(100), testBlocks(
+		TestBlockWithNumbers("198a", "197a", 198, 197),
+		TestBlockWithNumbers("199a", "198a", 199, 198),
+	))
+	bs.SetFile(base(200), testBlocks(
+		TestBlockWithNumbers("200a", "199a", 200, 199),
+		TestBlockWithNumbers("201a", "200a", 201, 200),
+		TestBlockWithNumbers("202a", "201a", 202, 201),
+		TestBlockWithNumbers("203a", "202a", 203, 202),
+	))
+
+	tests := []struct {
+		name   string
+		cursor *Cursor
+		expect []string
+	}{
+		{
+			name:   "cursor block on bundle boundary",
+			cursor: &Cursor{Step: StepNew, Block: NewBlockRef("200a", 200), HeadBlock: NewBlockRef("200a", 200), LIB: NewBlockRef("198a", 198)},
+			expect: []string{"irreversible:199a", "irreversible:200a", "new,irreversible:201a", "new,irreversible:203a"},
+		},
+		{
+			name:   "cursor block before bundle boundary",
+			cursor: &Cursor{Step: StepNew, Block: NewBlockRef("199a", 199), HeadBlock: NewBlockRef("199a", 199), LIB: NewBlockRef("198a", 198)},
+			expect: []string{"irreversible:199a", "new,irreversible:200a", "new,irreversible:203a"},
+		},
+		{
+			name:   "final cursor on bundle boundary",
+			cursor: &Cursor{Step: StepNewIrreversible, Block: NewBlockRef("200a", 200), HeadBlock: NewBlockRef("200a", 200), LIB: NewBlockRef("200a", 200)},
+			expect: []string{"new,irreversible:201a", "new,irreversible:203a"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			indexProvider := &TestBlockIndexProvider{Blocks: []uint64{150, 203}, LastIndexedBlock: 299}
+
+			done := make(chan struct{})
+			var got []string
+			handler := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+				got = append(got, fmt.Sprintf("%s:%s", obj.(Cursorable).Cursor().Step, blk.Id))
+				if blk.Number == 203 {
+					close(done)
+				}
+				return nil
+			})
+
+			fs := NewFileSourceFromCursor(bs, nil, test.cursor, handler, zlog, FileSourceWithBlockIndexProvider(indexProvider))
+			go fs.Run()
+			defer fs.Shutdown(nil)
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("timeout waiting for blocks")
+			}
+			assert.Equal(t, test.expect, got)
+		})
+	}
+}
+
+func TestFileSourceFromCursor_PreprocessFromBlock(t *testing.T) {
+	bs := dstore.NewMockStore(nil)
+	bs.SetFile(base(0), testBlocks(
+		TestBlockWithNumbers("1a", "00", 1, 0),
+		TestBlockWithNumbers("2a", "1a", 2, 0),
+		TestBlockWithNumbers("3a", "2a", 3, 0),
+	))
+	bs.SetFile(base(100), testBlocks(
+		TestBlockWithNumbers("104a", "3a", 104, 0),
+	))
+
+	preprocessor := PreprocessFunc(func(blk *pbbstream.Block) (interface{}, error) {
+		return blk.Id, nil
+	})
+
+	expectedObjs := []interface{}{nil, "3a", "104a"}
+	testDone := make(chan int, 1)
+	handlerCount := 0
+	handler := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		require.Equal(t, expectedObjs[handlerCount], obj.(ObjectWrapper).WrappedObject(), "block %s", blk.AsRef())
+		handlerCount++
+		if handlerCount == len(expectedObjs) {
+			testDone <- handlerCount
+		}
+		return nil
+	})
+
+	fs := NewFileSourceFromCursor(bs, nil, &Cursor{
+		Step:      StepNew,
+		Block:     NewBlockRef("3a", 3),
+		HeadBlock: NewBlockRef("3a", 3),
+		LIB:       NewBlockRef("1a", 1),
+	}, handler, zlog, FileSourceWithConcurrentPreprocess(preprocessor, 2), FileSourceWithPreprocessFromBlock(3))
+	go fs.Run()
+
+	select {
+	case count := <-testDone:
+		require.Equal(t, len(expectedObjs), count)
+	case <-time.After(5 * time.Second):
+		t.Error("Test timeout")
+	}
+	fs.Shutdown(nil)
+}
+
+// eofNotifier calls onEOF the first time it is read to the end
+type eofNotifier struct {
+	io.Reader
+	eof   bool
+	onEOF func()
+}
+
+func (r *eofNotifier) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF && !r.eof {
+		r.eof = true
+		r.onEOF()
+	}
+	return n, err
+}
+
+func (r *eofNotifier) Close() error {
+	return nil
+}
+
+func TestFileSource_ReadAhead(t *testing.T) {
+	bs := dstore.NewMockStore(nil)
+	files := map[string][]byte{}
+	var expectedBlocks []uint64
+	for i := 0; i < 6; i++ {
+		num := uint64(i*100 + 1)
+		files[base(i*100)] = testBlocks(TestBlockWithNumbers(fmt.Sprintf("%da", num), fmt.Sprintf("%da", num-100), num, 0))
+		bs.SetFile(base(i*100), files[base(i*100)])
+		expectedBlocks = append(expectedBlocks, num)
+	}
+
+	var lock sync.Mutex
+	opened, fullyRead := 0, 0
+	bs.OpenObjectFunc = func(ctx context.Context, name string) (io.ReadCloser, error) {
+		lock.Lock()
+		opened++
+		lock.Unlock()
+		return &eofNotifier{Reader: bytes.NewReader(files[name]), onEOF: func() {
+			lock.Lock()
+			fullyRead++
+			lock.Unlock()
+		}}, nil
+	}
+	counts := func() (int, int) {
+		lock.Lock()
+		defer lock.Unlock()
+		return opened, fullyRead
+	}
+
+	release := make(chan struct{})
+	var received []uint64
+	handler := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		<-release
+		received = append(received, blk.Number)
+		if len(received) == len(expectedBlocks) {
+			return io.EOF
+		}
+		return nil
+	})
+
+	fs := NewFileSource(bs, 1, handler, zlog, FileSourceWithReadAhead(3))
+	go fs.Run()
+
+	// consumer stuck on the first block, 3 files are downloaded ahead of it
+	require.Eventually(t, func() bool {
+		_, fullyRead := counts()
+		return fullyRead == 4
+	}, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	opened, _ = counts()
+	assert.Equal(t, 4, opened, "read ahead stops when the consumer falls behind")
+
+	close(release)
+	<-fs.Terminated()
+	assert.Equal(t, expectedBlocks, received)
+}
+
 func TestFileSource_lookupBlockIndex(t *testing.T) {
 	tests := []struct {
 		name                        string
@@ -309,3 +497,176 @@ func TestFileSource_lookupBlockIndex(t *testing.T) {
 	}
 
 }
+
+func TestFileSource_IDVerification(t *testing.T) {
+	defer func(verifier func(blk *pbbstream.Block) (string, error)) { GetBlockIDVerifier = verifier }(GetBlockIDVerifier)
+	GetBlockIDVerifier = func(blk *pbbstream.Block) (string, error) {
+		return fmt.Sprintf("%d%s", blk.Number, blk.ParentId), nil
+	}
+
+	bs := dstore.NewMockStore(nil)
+	bs.SetFile(base(0), testBlocks(
+		TestBlockWithNumbers("100", "00", 1, 0),
+		TestBlockWithNumbers("2100", "100", 2, 1),
+		TestBlockWithNumbers("32100", "2101", 3, 2), // tampered parent
+		TestBlockWithNumbers("432100", "32100", 4, 3),
+	))
+
+	handler := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		assert.Less(t, blk.Number, uint64(3), "blocks from the tampered one must not be sent")
+		return nil
+	})
+
+	fs := NewFileSource(bs, 1, handler, zlog, FileSourceWithIDVerification())
+	go fs.Run()
+
+	select {
+	case <-fs.Terminated():
+	case <-time.After(time.Second):
+		t.Fatal("expected file source to fail on the tampered block")
+	}
+	require.ErrorIs(t, fs.Err(), ErrBlockIDMismatch)
+	assert.Contains(t, fs.Err().Error(), `block #3 has ID "32100" but its computed ID is "32101"`)
+}
+
+func TestFileSource_CorruptBlockPolicy(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer, err := NewDBinBlockWriter(buf)
+	require.NoError(t, err)
+	require.NoError(t, writer.Write(TestBlockWithNumbers("1a", "00", 1, 0)))
+	require.NoError(t, writer.src.WriteMessage([]byte{0xff, 0xff})) // undecodable block
+	require.NoError(t, writer.Write(TestBlockWithNumbers("3a", "1a", 3, 1)))
+
+	bs := dstore.NewMockStore(nil)
+	bs.SetFile(base(0), buf.Bytes())
+
+	t.Run("fail", func(t *testing.T) {
+		fs := NewFileSource(bs, 1, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error { return nil }), zlog)
+		go fs.Run()
+
+		select {
+		case <-fs.Terminated():
+		case <-time.After(time.Second):
+			t.Fatal("expected file source to fail on the corrupt block")
+		}
+		assert.ErrorIs(t, fs.Err(), ErrCorruptBlock)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		var skipped []string
+		var received []uint64
+		handler := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			received = append(received, blk.Number)
+			if blk.Number == 3 {
+				return io.EOF
+			}
+			return nil
+		})
+
+		fs := NewFileSource(bs, 1, handler, zlog, FileSourceWithCorruptBlockPolicy(CorruptBlockSkip, func(filename string, err error) {
+			assert.ErrorIs(t, err, ErrCorruptBlock)
+			skipped = append(skipped, filename)
+		}))
+		go fs.Run()
+
+		select {
+		case <-fs.Terminated():
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for blocks")
+		}
+		assert.ErrorIs(t, fs.Err(), io.EOF)
+		assert.Equal(t, []string{base(0)}, skipped)
+		assert.Equal(t, []uint64{1, 3}, received)
+	})
+}
+
+func TestFileSource_PerBlockDeadline(t *testing.T) {
+	bs := dstore.NewMockStore(nil)
+	bs.SetFile(base(0), testBlocks(
+		TestBlockWithNumbers("1a", "00", 1, 0),
+		TestBlockWithNumbers("2a", "1a", 2, 1),
+		TestBlockWithNumbers("3a", "2a", 3, 2),
+	))
+
+	var received []uint64
+	handler := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		received = append(received, blk.Number)
+		switch blk.Number {
+		case 2:
+			time.Sleep(30 * time.Millisecond)
+		case 3:
+			return io.EOF
+		}
+		return nil
+	})
+
+	var slow []uint64
+	fs := NewFileSource(bs, 1, handler, zlog, FileSourceWithPerBlockDeadline(20*time.Millisecond, func(blockNum uint64, took time.Duration) {
+		assert.GreaterOrEqual(t, took, 30*time.Millisecond)
+		slow = append(slow, blockNum)
+	}))
+	go fs.Run()
+
+	select {
+	case <-fs.Terminated():
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for blocks")
+	}
+	assert.ErrorIs(t, fs.Err(), io.EOF)
+	assert.Equal(t, []uint64{1, 2, 3}, received, "slow blocks are not aborted")
+	assert.Equal(t, []uint64{2}, slow)
+}
+
+func TestFileSource_StoreHealth(t *testing.T) {
+	primary := dstore.NewMockStore(nil)
+	primary.SetFile(base(0), testBlocks(
+		TestBlockWithNumbers("1p", "00", 1, 0),
+	))
+	mirror := dstore.NewMockStore(nil)
+	mirror.SetFile(base(0), testBlocks(
+		TestBlockWithNumbers("1m", "00", 1, 0),
+	))
+
+	run := func(t *testing.T, options ...FileSourceOption) string {
+		t.Helper()
+		var got string
+		handler := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			got = blk.Id
+			return io.EOF
+		})
+
+		fs := NewFileSource(primary, 1, handler, zlog, options...)
+		go fs.Run()
+		select {
+		case <-fs.Terminated():
+		case <-time.After(time.Second):
+			t.Fatal("expected file source to send a block")
+		}
+		require.ErrorIs(t, fs.Err(), io.EOF)
+		return got
+	}
+
+	t.Run("healthy by default", func(t *testing.T) {
+		assert.Equal(t, "1p", run(t, FileSourceWithSecondaryStores(mirror)))
+	})
+
+	t.Run("unhealthy primary", func(t *testing.T) {
+		checker := func(store dstore.Store) bool { return store != primary }
+		assert.Equal(t, "1m", run(t, FileSourceWithSecondaryStores(mirror), FileSourceWithStoreHealth(0, checker)))
+	})
+
+	t.Run("rechecked every interval", func(t *testing.T) {
+		var checks atomic.Int64
+		checker := func(store dstore.Store) bool {
+			checks.Add(1)
+			return true
+		}
+
+		handler := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error { return nil })
+		fs := NewFileSource(primary, 1, handler, zlog, FileSourceWithSecondaryStores(mirror), FileSourceWithStoreHealth(5*time.Millisecond, checker))
+		go fs.Run()
+		defer fs.Shutdown(nil)
+
+		require.Eventually(t, func() bool { return checks.Load() >= 6 }, time.Second, time.Millisecond, "2 stores checked on start, then every interval")
+	})
+}
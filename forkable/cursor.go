@@ -0,0 +1,13 @@
+package forkable
+
+import (
+	"github.com/streamingfast/bstream"
+)
+
+// ValidateCursor checks that a cursor, typically received from a client, is
+// internally consistent before it is used to resume a stream, see
+// `bstream.Cursor.Validate`. It does not need any ForkDB, the cursor blocks
+// are not checked against a chain.
+func ValidateCursor(c *bstream.Cursor) error {
+	return c.Validate()
+}
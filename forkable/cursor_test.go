@@ -0,0 +1,50 @@
+package forkable
+
+import (
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCursor(t *testing.T) {
+	cursor := func(step bstream.StepType, block, head, lib string) *bstream.Cursor {
+		return &bstream.Cursor{Step: step, Block: bRef(block), HeadBlock: bRef(head), LIB: bRef(lib)}
+	}
+
+	tests := []struct {
+		name        string
+		cursor      *bstream.Cursor
+		expectedErr string
+	}{
+		{"new", cursor(bstream.StepNew, "00000003a", "00000005a", "00000002a"), ""},
+		{"new irreversible", cursor(bstream.StepNewIrreversible, "00000003a", "00000003a", "00000003a"), ""},
+		{"irreversible", cursor(bstream.StepIrreversible, "00000003a", "00000005a", "00000003a"), ""},
+		{"undo", cursor(bstream.StepUndo, "00000005a", "00000006b", "00000002a"), ""},
+
+		{"nil", nil, "nil cursor"},
+		{"empty block id", cursor(bstream.StepNew, "", "00000005a", "00000002a"), "block has no ID"},
+		{"nil head", &bstream.Cursor{Step: bstream.StepNew, Block: bRef("00000003a"), LIB: bRef("00000002a")}, "head block has no ID"},
+		{"empty lib id", &bstream.Cursor{Step: bstream.StepNew, Block: bRef("00000003a"), HeadBlock: bRef("00000003a"), LIB: bstream.NewBlockRef("", 2)}, "lib has no ID"},
+		{"new lib above block", cursor(bstream.StepNew, "00000003a", "00000005a", "00000004a"), "lib #4 (00000004a) is above block #3 (00000003a)"},
+		{"new block above head", cursor(bstream.StepNew, "00000006a", "00000005a", "00000002a"), "block #6 (00000006a) is above head block #5 (00000005a)"},
+		{"irreversible not lib", cursor(bstream.StepIrreversible, "00000003a", "00000005a", "00000002a"), "is not the lib"},
+		{"irreversible above head", cursor(bstream.StepIrreversible, "00000006a", "00000005a", "00000006a"), "is above head block"},
+		{"undo irreversible block", cursor(bstream.StepUndo, "00000002a", "00000006b", "00000002a"), "is not above lib"},
+		{"stalled step", cursor(bstream.StepStalled, "00000003a", "00000005a", "00000002a"), "invalid step"},
+		{"unknown step", cursor(bstream.StepType(0), "00000003a", "00000005a", "00000002a"), "invalid step"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateCursor(test.cursor)
+			if test.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.expectedErr)
+		})
+	}
+}
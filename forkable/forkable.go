@@ -15,6 +15,7 @@
 package forkable
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"sync"
@@ -39,8 +40,11 @@ type Forkable struct {
 	ensureBlockFlowed                  bool
 	ensureAllBlocksTriggerLongestChain bool
 
-	holdBlocksUntilLIB bool // if true, never passthrough anything before a LIB is set
-	keptFinalBlocks    int  // how many blocks we keep behind LIB
+	holdBlocksUntilLIB   bool   // if true, never passthrough anything before a LIB is set
+	holdBlocksUntilDepth uint64 // if set, blocks are sent as new only once that many descendants are on the longest chain
+	keptFinalBlocks      int    // how many blocks we keep behind LIB
+
+	keptFinalBlocksDuration time.Duration // if set, final blocks within that duration of head are kept instead of keptFinalBlocks
 
 	includeInitialLIB bool
 
@@ -51,6 +55,74 @@ type Forkable struct {
 	unlinkableBlocksSince             time.Time
 
 	lastLongestChain []*Block
+
+	spanTracer bstream.Tracer
+
+	clock bstream.Clock
+
+	libUpdateHandler func(lib bstream.BlockRef)
+
+	belowLIBHandler func(blk *pbbstream.Block)
+	rejectBelowLIB  bool
+
+	gateUntilHead bstream.BlockRef
+
+	finalityLatencyObserver func(blk bstream.BlockRef, seen, finalized time.Time)
+
+	maxSkipDistance uint64
+
+	sequentialUndoDelivery bool
+
+	expectedChainTag  string
+	chainTagExtractor func(blk *pbbstream.Block) string
+
+	coalescedIrreversibleBatchSize  uint64
+	coalescedIrreversibleHeadGetter bstream.BlockRefGetter
+	coalescedIrreversibleThreshold  uint64
+	coalescedIrreversibleHead       *headCache
+	coalescedIrreversibleLive       bool
+	coalescedIrreversiblePending    bstream.BlockRef // deferred LIB, nil when none
+
+	preconfirmationHandler func(blk *pbbstream.Block)
+
+	libFetcher func(ref bstream.BlockRef) (*pbbstream.Block, error)
+
+	liveHeadGetter bstream.BlockRefGetter
+	onLive         func(at bstream.BlockRef)
+	liveHead       *headCache
+	live           bool
+
+	orphanedSubtreeObserver func(root bstream.BlockRef, blocks []bstream.BlockRef)
+
+	firstStreamableAsIrreversible bool
+
+	stickyHead bstream.BlockRef
+
+	redoBatchLimit         int
+	redoBudget             int // redos that can still be sent during the current ProcessBlock call
+	pendingRedos           []*ForkableBlock
+	pendingRedosBlock      *pbbstream.Block
+	pendingRedosCompletion func() error
+	deferredBlocks         []*bstream.PreprocessedBlock
+
+	stats              *statsRecorder
+	statsLiveThreshold uint64
+	statsHeadGetter    bstream.BlockRefGetter
+
+	libNumRegressionHandler func(blk bstream.BlockRef, prevLib, newLib uint64)
+	rejectLibNumRegression  bool
+
+	headGate          *headGate
+	gateOpened        bool
+	gateOpenCallbacks []func()
+
+	flushIrreversibleOnComplete bool
+
+	blockedIDs map[string]bool
+
+	maxPendingBlocks       int
+	rejectMaxPendingBlocks bool
+	pendingBlocks          []string // IDs of the blocks not linking to LIB when added, oldest first
 }
 
 func (p *Forkable) AllBlocksAt(num uint64) (out []*pbbstream.Block) {
@@ -133,6 +205,47 @@ func (p *Forkable) CallWithBlocksThroughCursor(startBlock uint64, cursor *bstrea
 	return nil
 }
 
+// CallWithCanonicalBlocks calls `callback` with the blocks of the longest
+// chain of the ForkDB, from LIB to its head, all as StepNew. Among forks of
+// equal length, the one followed by the Forkable wins, see headRef, so it is
+// the chain sent to the handler once blocks were sent.
+func (p *Forkable) CallWithCanonicalBlocks(callback func([]*bstream.PreprocessedBlock)) error {
+	p.RLock()
+	defer p.RUnlock()
+	blks, err := p.canonicalBlocks()
+	if err != nil {
+		return err
+	}
+	callback(blks)
+	return nil
+}
+
+func (p *Forkable) canonicalBlocks() ([]*bstream.PreprocessedBlock, error) {
+	if !p.forkDB.HasLIB() {
+		return nil, fmt.Errorf("no lib")
+	}
+
+	headRef := p.headRef()
+	seg, reachLIB := p.forkDB.CompleteSegment(headRef)
+	if !reachLIB {
+		return nil, fmt.Errorf("longest chain head %s does not reach LIB", headRef)
+	}
+
+	var out []*bstream.PreprocessedBlock
+	for _, blk := range seg {
+		forkableBlock, ok := blk.Object.(*ForkableBlock)
+		if !ok {
+			continue // LIB set from a reference, without its block
+		}
+		lib := p.forkDB.libRef
+		if lib.Num() > blk.BlockNum {
+			lib = blk.AsRef() // never send cursor with LIB > Block
+		}
+		out = append(out, wrapBlockForkableObject(forkableBlock, bstream.StepNew, headRef, lib, nil))
+	}
+	return out, nil
+}
+
 // blocksFromNumWithForks will *NOT* output information about steps
 func (p *Forkable) blocksFromNumWithForks(startNum uint64) ([]*bstream.PreprocessedBlock, error) {
 	if !p.forkDB.HasLIB() {
@@ -419,8 +532,10 @@ func wrapBlockForkableObject(blk *ForkableBlock, step bstream.StepType, head bst
 			step:               step,
 			headBlock:          head,
 			block:              blk.Block.AsRef(),
+			previousBlock:      bstream.NewBlockRef(blk.Block.ParentId, blk.Block.ParentNum),
 			lastLIBSent:        lib,
 			Obj:                blk.Obj,
+			attachments:        blk.Attachments,
 			reorgJunctionBlock: reorgJunctionBlock,
 		},
 	}
@@ -435,9 +550,16 @@ type ForkableObject struct {
 	StepBlocks         []*bstream.PreprocessedBlock // You can decide to process them when StepCount == StepIndex +1 or when StepIndex == 0 only.
 	reorgJunctionBlock bstream.BlockRef
 
-	headBlock   bstream.BlockRef
-	block       bstream.BlockRef
-	lastLIBSent bstream.BlockRef
+	headBlock     bstream.BlockRef
+	block         bstream.BlockRef
+	previousBlock bstream.BlockRef // parent of block, only needed by RestoreCursor on undo steps
+	lastLIBSent   bstream.BlockRef
+
+	attachments bstream.Attachments
+
+	// refs of the LIB then of the longest chain above it when the object was
+	// emitted, shared by the objects of a same step, see CanonicalChainRefs
+	canonicalChain []bstream.BlockRef
 
 	// Object that was returned by PreprocessBlock(). Could be nil
 	Obj interface{}
@@ -462,6 +584,31 @@ func (fobj *ForkableObject) WrappedObject() interface{} {
 	return fobj.Obj
 }
 
+// CanonicalChainRefs returns the canonical chain retained by the forkable,
+// from its LIB to the head block of the object, as it was when the object was
+// emitted: it does not reflect later blocks or forks, whenever it is called.
+// It is computed on call. It is nil for the objects of blocks replayed from
+// the forkable's buffer, ex: by a hub source starting from a cursor.
+func (fobj *ForkableObject) CanonicalChainRefs() []bstream.BlockRef {
+	if len(fobj.canonicalChain) == 0 {
+		return nil
+	}
+
+	end := len(fobj.canonicalChain)
+	if fobj.headBlock != nil {
+		for end > 1 && fobj.canonicalChain[end-1].Num() > fobj.headBlock.Num() {
+			end--
+		}
+	}
+	return append([]bstream.BlockRef(nil), fobj.canonicalChain[:end]...)
+}
+
+// Attachments returns the metadata attached to the block when it was pushed
+// to the forkable through a `bstream.AttachedObject`, nil otherwise.
+func (fobj *ForkableObject) Attachments() bstream.Attachments {
+	return fobj.attachments
+}
+
 func (fobj *ForkableObject) Cursor() *bstream.Cursor {
 	if fobj == nil ||
 		fobj.block == nil ||
@@ -478,20 +625,98 @@ func (fobj *ForkableObject) Cursor() *bstream.Cursor {
 	}
 }
 
+// RestoreCursor returns the cursor of the position the consumer is at once it
+// handled this step, as a forkable reaching that position without any reorg
+// would emit it, making it suitable for per-block checkpoints.
+//
+// It differs from `Cursor()` in the middle of an undo/redo cascade, where
+// `Cursor()` has the block causing the reorg as head block: after undoing a
+// block, the consumer's chain ends at the parent of that block, so the
+// restore cursor is a New cursor on that parent. After a New block, the
+// block is its own head. Irreversible and stalled steps do not move the
+// consumer's chain, their restore cursor is `Cursor()`. Resuming from either
+// cursor brings the same blocks.
+func (fobj *ForkableObject) RestoreCursor() *bstream.Cursor {
+	cursor := fobj.Cursor()
+	if cursor.IsEmpty() {
+		return cursor
+	}
+
+	switch fobj.step {
+	case bstream.StepNew, bstream.StepNewIrreversible:
+		cursor.HeadBlock = cursor.Block
+	case bstream.StepUndo:
+		if bstream.IsEmpty(fobj.previousBlock) {
+			return cursor
+		}
+		cursor.Step = bstream.StepNew
+		cursor.Block = fobj.previousBlock
+		cursor.HeadBlock = fobj.previousBlock
+	}
+	return cursor
+}
+
+// ForkableObjectSnapshot is a comparable view of a ForkableObject, for
+// assertions in tests. Block references are all `bstream.BasicBlockRef`
+// values, nil when not set. `Step` is always the step of the object, even
+// when its cursor is empty. `Block`, `HeadBlock` and `LIB` are the fields of
+// `Cursor()`, they are all nil when the cursor is empty.
+type ForkableObjectSnapshot struct {
+	Step               bstream.StepType
+	Block              bstream.BlockRef
+	HeadBlock          bstream.BlockRef
+	LIB                bstream.BlockRef
+	ReorgJunctionBlock bstream.BlockRef
+
+	StepIndex  int
+	StepCount  int
+	StepBlocks []bstream.BlockRef
+}
+
+// Snapshot returns the comparable view of the object, see ForkableObjectSnapshot.
+func (fobj *ForkableObject) Snapshot() ForkableObjectSnapshot {
+	snapshot := ForkableObjectSnapshot{
+		Step:               fobj.step,
+		ReorgJunctionBlock: basicBlockRef(fobj.ReorgJunctionBlock()),
+		StepIndex:          fobj.StepIndex,
+		StepCount:          fobj.StepCount,
+	}
+	if cursor := fobj.Cursor(); !cursor.IsEmpty() {
+		snapshot.Block = basicBlockRef(cursor.Block)
+		snapshot.HeadBlock = basicBlockRef(cursor.HeadBlock)
+		snapshot.LIB = basicBlockRef(cursor.LIB)
+	}
+	for _, blk := range fobj.StepBlocks {
+		snapshot.StepBlocks = append(snapshot.StepBlocks, basicBlockRef(blk.Block.AsRef()))
+	}
+	return snapshot
+}
+
+func basicBlockRef(ref bstream.BlockRef) bstream.BlockRef {
+	if ref == nil {
+		return nil
+	}
+	return bstream.NewBlockRef(ref.ID(), ref.Num())
+}
+
 type ForkableBlock struct {
-	Block     *pbbstream.Block
-	Obj       interface{}
-	sentAsNew bool
+	Block       *pbbstream.Block
+	Obj         interface{}
+	Attachments bstream.Attachments
+	sentAsNew   bool
+	sentAsNewAt time.Time
 }
 
 func New(h bstream.Handler, opts ...Option) *Forkable {
 	f := &Forkable{
-		filterSteps:      bstream.StepsAll,
-		handler:          h,
-		forkDB:           NewForkDB(),
-		ensureBlockFlows: bstream.BlockRefEmpty,
-		lastLIBSeen:      bstream.BlockRefEmpty,
-		logger:           zlog,
+		filterSteps:        bstream.StepsAll,
+		handler:            h,
+		forkDB:             NewForkDB(),
+		ensureBlockFlows:   bstream.BlockRefEmpty,
+		lastLIBSeen:        bstream.BlockRefEmpty,
+		clock:              bstream.RealClock,
+		statsLiveThreshold: DefaultStatsLiveThreshold,
+		logger:             zlog,
 	}
 
 	for _, opt := range opts {
@@ -501,9 +726,80 @@ func New(h bstream.Handler, opts ...Option) *Forkable {
 	// Done afterwards so forkdb can get configured forkable logger from options
 	f.forkDB.logger = f.logger
 
+	if f.coalescedIrreversibleBatchSize != 0 {
+		f.coalescedIrreversibleHead = newHeadCache(f.coalescedIrreversibleHeadGetter, f.coalescedIrreversibleThreshold, f.logger)
+	}
+	if f.onLive != nil {
+		f.liveHead = newHeadCache(f.liveHeadGetter, 0, f.logger)
+	}
+
+	if f.gateUntilHead != nil {
+		f.headGate = newHeadGate(f.handler, f.gateUntilHead, f.logger)
+		f.handler = f.headGate
+	}
+
+	f.stats = &statsRecorder{
+		handler:       f.handler,
+		head:          newHeadCache(f.statsHeadGetter, f.statsLiveThreshold, f.logger),
+		chainHead:     f.longestChainHeadNum,
+		liveThreshold: f.statsLiveThreshold,
+	}
+	f.handler = f.stats
+
 	return f
 }
 
+// GateOpen tells if blocks flow to the handler, that is once the block of
+// `EnsureBlockFlows` (ex: the cursor block on resume) was sent and the head
+// reached the target of `WithGateUntilHead`. It is always true when neither is
+// set. The gate never closes once open.
+func (p *Forkable) GateOpen() bool {
+	p.RLock()
+	defer p.RUnlock()
+	return p.gateOpen()
+}
+
+// OnGateOpen registers `f` to be called once, when the gate opens, see
+// `GateOpen`. It is called right away if the gate is already open. The call
+// happens in the goroutine processing the block that opened the gate, after
+// the forkable lock was released.
+func (p *Forkable) OnGateOpen(f func()) {
+	p.Lock()
+	if p.gateOpened || p.gateOpen() {
+		p.gateOpened = true
+		p.Unlock()
+		f()
+		return
+	}
+	p.gateOpenCallbacks = append(p.gateOpenCallbacks, f)
+	p.Unlock()
+}
+
+func (p *Forkable) gateOpen() bool {
+	if p.ensureBlockFlows.ID() != "" && !p.ensureBlockFlowed {
+		return false
+	}
+	return p.headGate == nil || p.headGate.opened
+}
+
+// unlockNotifyingGateOpen releases the lock, calling the OnGateOpen callbacks
+// if the gate just opened.
+func (p *Forkable) unlockNotifyingGateOpen() {
+	if p.gateOpened || !p.gateOpen() {
+		p.Unlock()
+		return
+	}
+
+	p.gateOpened = true
+	callbacks := p.gateOpenCallbacks
+	p.gateOpenCallbacks = nil
+	p.Unlock()
+
+	for _, f := range callbacks {
+		f()
+	}
+}
+
 func (p *Forkable) targetChainBlock(blk bstream.BlockRef) bstream.BlockRef {
 	if p.ensureBlockFlows.ID() != "" && !p.ensureBlockFlowed {
 		return p.ensureBlockFlows
@@ -516,6 +812,15 @@ func (p *Forkable) matchFilter(step bstream.StepType) bool {
 	return p.filterSteps&step != 0
 }
 
+// longestChainHeadNum returns the number of the head of the last longest
+// chain computed, 0 before any. It is called under the forkable lock.
+func (p *Forkable) longestChainHeadNum() uint64 {
+	if len(p.lastLongestChain) == 0 {
+		return 0
+	}
+	return p.lastLongestChain[len(p.lastLongestChain)-1].BlockNum
+}
+
 func (p *Forkable) computeNewLongestChain(ppBlk *ForkableBlock) []*Block {
 	longestChain := p.lastLongestChain
 	blk := ppBlk.Block
@@ -543,17 +848,117 @@ func (p *Forkable) computeNewLongestChain(ppBlk *ForkableBlock) []*Block {
 }
 
 func (p *Forkable) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
+	if p.spanTracer == nil {
+		return p.processBlock(blk, obj)
+	}
+
+	span := p.spanTracer.StartSpan("forkable.process_block", blk.AsRef(), 0)
+	err := p.processBlock(blk, obj)
+	span.End(err)
+	return err
+}
+
+func (p *Forkable) processBlock(blk *pbbstream.Block, obj interface{}) error {
+	// head getters are called before locking, they can block up to their timeout
+	p.coalescedIrreversibleHead.refresh(blk.Number)
+	p.liveHead.refresh(blk.Number)
+	p.stats.head.refresh(blk.Number)
+
 	p.Lock()
-	defer p.Unlock()
+	defer p.unlockNotifyingGateOpen()
+
+	if p.redoBatchLimit == 0 {
+		return p.processIncomingBlock(blk, obj)
+	}
+
+	p.redoBudget = p.redoBatchLimit
+	if err := p.sendPendingRedos(); err != nil {
+		return err
+	}
+
+	// blocks received while redos are pending are processed once they are all sent
+	p.deferredBlocks = append(p.deferredBlocks, &bstream.PreprocessedBlock{Block: blk, Obj: obj})
+	for p.pendingRedos == nil && len(p.deferredBlocks) != 0 {
+		next := p.deferredBlocks[0]
+		p.deferredBlocks = p.deferredBlocks[1:]
+		if err := p.processIncomingBlock(next.Block, next.Obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendPendingRedos sends the redos deferred by WithRedoBatchLimit, within the
+// budget of the current call, and completes the chain switch that triggered
+// them once the last one is sent.
+func (p *Forkable) sendPendingRedos() error {
+	if p.pendingRedos == nil {
+		return nil
+	}
+
+	batch := p.pendingRedos
+	if len(batch) > p.redoBudget {
+		batch = batch[:p.redoBudget]
+	}
+	if len(batch) != 0 {
+		p.redoBudget -= len(batch)
+		if err := p.processBlocks(p.pendingRedosBlock, batch, bstream.StepNew, nil); err != nil {
+			return err
+		}
+	}
+
+	p.pendingRedos = p.pendingRedos[len(batch):]
+	if len(p.pendingRedos) != 0 {
+		return nil
+	}
+
+	completion := p.pendingRedosCompletion
+	p.pendingRedos = nil
+	p.pendingRedosBlock = nil
+	p.pendingRedosCompletion = nil
+	return completion()
+}
+
+func (p *Forkable) processIncomingBlock(blk *pbbstream.Block, obj interface{}) (err error) {
+	p.stats.observe(blk)
 
 	if blk.Id == blk.ParentId {
 		return fmt.Errorf("invalid block ID detected on block %s (previousID: %s), bad data", blk.AsRef().String(), blk.ParentId)
 	}
 
+	if p.blockedIDs[blk.Id] {
+		p.logger.Warn("rejecting blocked block", zap.Stringer("block", blk.AsRef()))
+		return nil
+	}
+
+	if p.chainTagExtractor != nil {
+		if tag := p.chainTagExtractor(blk); tag != p.expectedChainTag {
+			return fmt.Errorf("block %s has chain tag %q but %q is expected, is it coming from another network?", blk.AsRef(), tag, p.expectedChainTag)
+		}
+	}
+
 	if blk.Number < p.forkDB.LIBNum() && p.lastBlockSent != nil {
+		if p.belowLIBHandler != nil {
+			p.belowLIBHandler(blk)
+		}
+		if p.rejectBelowLIB {
+			return fmt.Errorf("received block %s below LIB %s", blk.AsRef(), p.forkDB.libRef)
+		}
 		return nil
 	}
 
+	if p.maxSkipDistance != 0 && p.lastBlockSent != nil && blk.Number > p.lastBlockSent.Number+p.maxSkipDistance {
+		if p.forkDB.Exists(blk.ParentId) || blk.ParentId == p.forkDB.LIBID() {
+			return fmt.Errorf("block %s is %d blocks ahead of head %s, more than the max skip distance of %d", blk.AsRef(), blk.Number-p.lastBlockSent.Number, p.lastBlockSent.AsRef(), p.maxSkipDistance)
+		}
+	}
+
+	var attachments bstream.Attachments
+	if attachedObj, ok := obj.(*bstream.AttachedObject); ok {
+		obj = attachedObj.Obj
+		attachments = attachedObj.Attachments()
+	}
+
 	zlogBlk := p.logger.With(zap.Stringer("block", blk.AsRef()))
 
 	// TODO: consider an `initialHeadBlockID`, triggerNewLongestChain also when the initialHeadBlockID's BlockNum == blk.Num()
@@ -565,11 +970,17 @@ func (p *Forkable) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
 		zlogBlk.Debug("processing block (1/600 sampling)", zap.Bool("new_longest_chain", triggersNewLongestChain))
 	}
 
-	if p.includeInitialLIB && p.lastBlockSent == nil && blk.Id == p.forkDB.LIBID() {
-		return p.processInitialInclusiveIrreversibleBlock(blk, obj, true)
+	if p.lastBlockSent == nil && blk.Id == p.forkDB.LIBID() && (p.includeInitialLIB || p.sendsFirstStreamableAsIrreversible(blk)) {
+		return p.processInitialInclusiveIrreversibleBlock(&ForkableBlock{Block: blk, Obj: obj, Attachments: attachments}, true)
+	}
+
+	if p.libFetcher != nil && p.lastBlockSent == nil && p.forkDB.HasLIB() && blk.Number > p.forkDB.LIBNum() {
+		if err := p.fetchLIBBlock(); err != nil {
+			return err
+		}
 	}
 
-	ppBlk := &ForkableBlock{Block: blk, Obj: obj}
+	ppBlk := &ForkableBlock{Block: blk, Obj: obj, Attachments: attachments}
 
 	var reorgJunctionBlock bstream.BlockRef
 	var undos, redos []*ForkableBlock
@@ -579,16 +990,30 @@ func (p *Forkable) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
 		}
 	}
 
+	if p.libNumRegressionHandler != nil || p.rejectLibNumRegression {
+		if err := p.checkLibNumMonotonicity(blk); err != nil {
+			return err
+		}
+	}
+
 	if exists, _ := p.forkDB.AddLink(blk.AsRef(), blk.ParentId, ppBlk); exists {
 		return nil
 	}
 
+	if p.preconfirmationHandler != nil {
+		defer func() {
+			if err == nil && !ppBlk.sentAsNew {
+				p.preconfirmationHandler(blk)
+			}
+		}()
+	}
+
 	var firstIrreverbleBlock *Block
 	if !p.forkDB.HasLIB() { // always skip processing until LIB is set
 		p.forkDB.SetLIB(blk.AsRef(), blk.LibNum)
 		if p.forkDB.HasLIB() { //this is an edge case. forkdb will not is returning the 1st lib in the forkDB.HasNewIrreversibleSegment call
 			if p.forkDB.libRef.Num() == blk.Number { // this block just came in and was determined as LIB, it is probably first streamable block and must be processed.
-				return p.processInitialInclusiveIrreversibleBlock(blk, obj, true)
+				return p.processInitialInclusiveIrreversibleBlock(ppBlk, true)
 			}
 			firstIrreverbleBlock = p.forkDB.BlockForID(p.forkDB.libRef.ID())
 		} else {
@@ -599,15 +1024,20 @@ func (p *Forkable) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
 	}
 
 	longestChain := p.computeNewLongestChain(ppBlk)
+	if p.maxPendingBlocks != 0 && longestChain == nil && p.forkDB.HasLIB() {
+		if err := p.capPendingBlocks(blk); err != nil {
+			return err
+		}
+	}
 	if p.failOnUnlinkableBlocksCount != 0 || p.warnOnUnlinkableBlocksCount != 0 {
 		if longestChain == nil && p.forkDB.HasLIB() {
 			if p.consecutiveUnlinkableBlocks == 0 {
-				p.unlinkableBlocksSince = time.Now()
+				p.unlinkableBlocksSince = p.clock.Now()
 			}
 			p.consecutiveUnlinkableBlocks++
 			if p.failOnUnlinkableBlocksCount != 0 &&
 				p.consecutiveUnlinkableBlocks > p.failOnUnlinkableBlocksCount &&
-				time.Since(p.unlinkableBlocksSince) > p.failOnUnlinkableBlocksGracePeriod {
+				p.clock.Now().Sub(p.unlinkableBlocksSince) > p.failOnUnlinkableBlocksGracePeriod {
 				zlogBlk.Warn("too many consecutive unlinkable blocks")
 				return fmt.Errorf("too many consecutive unlinkable blocks")
 			}
@@ -640,11 +1070,34 @@ func (p *Forkable) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
 	}
 
 	if p.matchFilter(bstream.StepNew) {
-		if err := p.processBlocks(blk, redos, bstream.StepNew, nil); err != nil {
-			return err
+		if p.redoBatchLimit != 0 && len(redos) > p.redoBudget {
+			// the rest of the redos, then the new blocks, are sent by the next ProcessBlock calls
+			p.pendingRedos = redos[p.redoBudget:]
+			p.pendingRedosBlock = blk
+			p.pendingRedosCompletion = func() error {
+				return p.sendLongestChain(blk, ppBlk, longestChain, firstIrreverbleBlock, zlogBlk)
+			}
+			redos = redos[:p.redoBudget]
+		}
+		if len(redos) != 0 {
+			if p.redoBatchLimit != 0 {
+				p.redoBudget -= len(redos)
+			}
+			if err := p.processBlocks(blk, redos, bstream.StepNew, nil); err != nil {
+				return err
+			}
+		}
+		if p.pendingRedos != nil {
+			return nil
 		}
 	}
 
+	return p.sendLongestChain(blk, ppBlk, longestChain, firstIrreverbleBlock, zlogBlk)
+}
+
+// sendLongestChain sends the blocks of `longestChain` not sent yet as new,
+// then moves the LIB if the head block allows it.
+func (p *Forkable) sendLongestChain(blk *pbbstream.Block, ppBlk *ForkableBlock, longestChain []*Block, firstIrreverbleBlock *Block, zlogBlk *zap.Logger) error {
 	if err := p.processNewBlocks(longestChain); err != nil {
 		return err
 	}
@@ -685,6 +1138,9 @@ func (p *Forkable) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
 	if !hasNew && firstIrreverbleBlock == nil {
 		return nil
 	}
+	if firstIrreverbleBlock == nil && p.coalescingIrreversible(blk, libRef) {
+		return nil
+	}
 
 	if tracer.Enabled() {
 		zlogBlk.Debug("moving lib", zap.Stringer("lib", libRef))
@@ -692,20 +1148,347 @@ func (p *Forkable) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
 		zlogBlk.Debug("moving lib (1/600)", zap.Stringer("lib", libRef))
 	}
 
+	return p.moveLIB(libRef, irreversibleSegment, stalledBlocks, ppBlk.Block.AsRef())
+}
+
+// moveLIB sets `libRef` as LIB and sends the newly irreversible and stalled
+// blocks
+func (p *Forkable) moveLIB(libRef bstream.BlockRef, irreversibleSegment, stalledBlocks []*Block, headBlock bstream.BlockRef) error {
+	var orphaned []*orphanedSubtree
+	if p.orphanedSubtreeObserver != nil {
+		orphaned = p.forkDB.orphanedSubtrees(p.forkDB.LIBID(), irreversibleSegment)
+	}
+
 	p.forkDB.MoveLIB(libRef)
-	_ = p.forkDB.PurgeBeforeLIB(p.keptFinalBlocks)
+	_ = p.forkDB.PurgeBeforeLIB(p.keptFinalBlocksCount())
 
-	if err := p.processIrreversibleSegment(irreversibleSegment, ppBlk.Block.AsRef()); err != nil {
+	if err := p.processIrreversibleSegment(irreversibleSegment, headBlock); err != nil {
 		return err
 	}
 
-	if err := p.processStalledSegment(stalledBlocks, ppBlk.Block.AsRef()); err != nil {
+	if err := p.processStalledSegment(stalledBlocks, headBlock); err != nil {
 		return err
 	}
 
+	for _, subtree := range orphaned {
+		p.orphanedSubtreeObserver(subtree.root, subtree.blocks)
+	}
+
+	if p.libUpdateHandler != nil {
+		p.libUpdateHandler(libRef)
+	}
+
+	return nil
+}
+
+// MarkIrreversible moves the LIB to `ref`, sending the irreversible steps,
+// from a finality signal received out of band instead of from the LibNum of
+// the blocks. It returns an error if `ref` is not in the ForkDB or not on the
+// chain sent so far. A `ref` at or below the current LIB is a no-op.
+func (p *Forkable) MarkIrreversible(ref bstream.BlockRef) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if !p.forkDB.HasLIB() || p.lastBlockSent == nil {
+		return fmt.Errorf("cannot mark block %s irreversible: no block sent yet", ref)
+	}
+	if ref.Num() <= p.forkDB.LIBNum() {
+		return nil
+	}
+	if p.forkDB.BlockForID(ref.ID()) == nil {
+		return fmt.Errorf("cannot mark block %s irreversible: unknown block", ref)
+	}
+
+	headBlock := p.lastBlockSent.AsRef()
+	if ref.Num() > headBlock.Num() || p.forkDB.BlockInCurrentChain(headBlock, ref.Num()).ID() != ref.ID() {
+		return fmt.Errorf("cannot mark block %s irreversible: not on the chain of head block %s", ref, headBlock)
+	}
+
+	hasNew, irreversibleSegment, stalledBlocks := p.forkDB.HasNewIrreversibleSegment(ref)
+	if !hasNew {
+		return nil
+	}
+	return p.moveLIB(ref, irreversibleSegment, stalledBlocks, headBlock)
+}
+
+// BlockIDs adds `ids` to the blocked IDs of a running Forkable, see
+// WithBlockedIDs. The blocked blocks already in the ForkDB are removed with
+// their descendants. When the head sent so far is one of them, the chain
+// switches to the best remaining fork: the removed blocks are sent as undo,
+// then the blocks of that fork as new. It returns an error, blocking nothing,
+// if one of the blocks is irreversible or if no fork is left to switch to.
+func (p *Forkable) BlockIDs(ids ...string) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.pendingRedos != nil {
+		return fmt.Errorf("cannot block IDs while redos are pending")
+	}
+
+	libID := p.forkDB.LIBID()
+	for _, id := range ids {
+		if id == libID {
+			return fmt.Errorf("cannot block irreversible block %s", p.forkDB.libRef)
+		}
+		if blk := p.forkDB.BlockForID(id); blk != nil && p.forkDB.HasLIB() && blk.BlockNum <= p.forkDB.LIBNum() {
+			return fmt.Errorf("cannot block irreversible block %s", blk.AsRef())
+		}
+	}
+
+	removed := p.blockedWithDescendants(ids)
+	if p.lastBlockSent == nil || !removed[p.lastBlockSent.Id] {
+		p.addBlockedIDs(ids)
+		for id := range removed {
+			p.forkDB.DeleteLink(id)
+		}
+		for i, blk := range p.lastLongestChain {
+			if removed[blk.BlockID] {
+				p.lastLongestChain = p.lastLongestChain[:i]
+				break
+			}
+		}
+		return nil
+	}
+
+	var removedBlocks []*Block
+	for id := range removed {
+		removedBlocks = append(removedBlocks, p.forkDB.BlockForID(id))
+		p.forkDB.DeleteLink(id)
+	}
+
+	newHead := p.headRef()
+	newHeadBlk := p.forkDB.BlockForID(newHead.ID())
+	if newHeadBlk == nil {
+		for _, blk := range removedBlocks {
+			p.forkDB.AddLink(blk.AsRef(), blk.PreviousBlockID, blk.Object)
+		}
+		return fmt.Errorf("cannot block head block %s: no other fork to switch to", p.lastBlockSent.AsRef())
+	}
+	p.addBlockedIDs(ids)
+
+	p.logger.Warn("head block blocked, switching to another fork", zap.Stringer("previous_head", p.lastBlockSent.AsRef()), zap.Stringer("new_head", newHead))
+	return p.switchToFork(newHeadBlk.Object.(*ForkableBlock).Block)
+}
+
+// switchToFork sends the undos of the blocks of the last sent chain that are
+// not on the chain of `newHead` anymore, the redos of the blocks of that
+// chain already sent, then the new ones.
+func (p *Forkable) switchToFork(newHead *pbbstream.Block) error {
+	newChain, _ := p.forkDB.ReversibleSegment(newHead.AsRef())
+	onNewChain := map[string]bool{p.forkDB.LIBID(): true}
+	for _, blk := range newChain {
+		onNewChain[blk.BlockID] = true
+	}
+
+	junction := p.forkDB.libRef
+	var undos []*ForkableBlock
+	for i := len(p.lastLongestChain) - 1; i >= 0; i-- {
+		blk := p.lastLongestChain[i]
+		if onNewChain[blk.BlockID] {
+			junction = blk.AsRef()
+			break
+		}
+		if ppBlk := blk.Object.(*ForkableBlock); ppBlk.sentAsNew {
+			undos = append(undos, ppBlk)
+		}
+	}
+
+	var redos []*ForkableBlock
+	lastSent := newHead
+	for _, blk := range newChain {
+		ppBlk := blk.Object.(*ForkableBlock)
+		if !ppBlk.sentAsNew {
+			break
+		}
+		lastSent = ppBlk.Block
+		if blk.BlockNum > junction.Num() {
+			redos = append(redos, ppBlk)
+		}
+	}
+
+	if p.matchFilter(bstream.StepUndo) {
+		if err := p.processBlocks(newHead, undos, bstream.StepUndo, junction); err != nil {
+			return err
+		}
+	}
+	if p.matchFilter(bstream.StepNew) && len(redos) != 0 {
+		if err := p.processBlocks(newHead, redos, bstream.StepNew, nil); err != nil {
+			return err
+		}
+	}
+
+	p.lastBlockSent = lastSent
+	p.lastLongestChain = newChain
+	if len(newChain) == 0 {
+		return nil
+	}
+	return p.processNewBlocks(newChain)
+}
+
+// blockedWithDescendants returns the IDs of the blocks of `ids` in the ForkDB
+// and of all their descendants
+func (p *Forkable) blockedWithDescendants(ids []string) map[string]bool {
+	removed := make(map[string]bool)
+	for _, id := range ids {
+		if p.forkDB.Exists(id) {
+			removed[id] = true
+		}
+	}
+
+	links, _ := p.forkDB.ClonedLinks()
+	for added := true; added; {
+		added = false
+		for id, previousID := range links {
+			if removed[previousID] && !removed[id] {
+				removed[id] = true
+				added = true
+			}
+		}
+	}
+	return removed
+}
+
+func (p *Forkable) addBlockedIDs(ids []string) {
+	if p.blockedIDs == nil {
+		p.blockedIDs = make(map[string]bool)
+	}
+	for _, id := range ids {
+		p.blockedIDs[id] = true
+	}
+}
+
+// capPendingBlocks records `blk` as pending, then drops the oldest pending
+// blocks from the ForkDB, or fails, when there are more than allowed, see
+// WithMaxPendingBlocks.
+func (p *Forkable) capPendingBlocks(blk *pbbstream.Block) error {
+	p.pendingBlocks = append(p.pendingBlocks, blk.Id)
+	if len(p.pendingBlocks) <= p.maxPendingBlocks {
+		return nil
+	}
+
+	p.pendingBlocks = p.forkDB.unlinkedIDs(p.pendingBlocks)
+	excess := len(p.pendingBlocks) - p.maxPendingBlocks
+	if excess <= 0 {
+		return nil
+	}
+
+	if p.rejectMaxPendingBlocks {
+		return fmt.Errorf("block %s does not link to LIB, more than %d blocks are pending", blk.AsRef(), p.maxPendingBlocks)
+	}
+
+	p.logger.Warn("too many pending blocks, dropping the oldest ones",
+		zap.Int("max_pending_blocks", p.maxPendingBlocks),
+		zap.Int("dropped", excess),
+		zap.String("oldest_dropped_id", p.pendingBlocks[0]),
+	)
+	for _, id := range p.pendingBlocks[:excess] {
+		p.forkDB.DeleteLink(id)
+	}
+	p.pendingBlocks = append([]string{}, p.pendingBlocks[excess:]...)
+	return nil
+}
+
+// checkLibNumMonotonicity compares the LibNum of `blk` with the one of its
+// parent, when known, so only regressions along a same chain are reported. A
+// LIB set from a reference has no block, hence no LibNum: its children are
+// not checked, the blocks above it reporting older LIBs legitimately.
+func (p *Forkable) checkLibNumMonotonicity(blk *pbbstream.Block) error {
+	if p.forkDB.Exists(blk.Id) {
+		return nil
+	}
+	parent := p.forkDB.BlockForID(blk.ParentId)
+	if parent == nil {
+		return nil
+	}
+	parentBlk, ok := parent.Object.(*ForkableBlock)
+	if !ok || blk.LibNum >= parentBlk.Block.LibNum {
+		return nil
+	}
+
+	if p.libNumRegressionHandler != nil {
+		p.libNumRegressionHandler(blk.AsRef(), parentBlk.Block.LibNum, blk.LibNum)
+	}
+	if p.rejectLibNumRegression {
+		return fmt.Errorf("block %s has LIB #%d, below LIB #%d of its parent %s", blk.AsRef(), blk.LibNum, parentBlk.Block.LibNum, parentBlk.Block.AsRef())
+	}
+	return nil
+}
+
+// coalescingIrreversible returns true when moving the LIB to `libRef` should
+// be deferred so a larger irreversible segment is sent later, see
+// WithCoalescedCatchupIrreversible. The deferred LIB is kept so it can be
+// flushed if the stream stops before it is applied.
+func (p *Forkable) coalescingIrreversible(blk *pbbstream.Block, libRef bstream.BlockRef) bool {
+	if p.coalescedIrreversibleBatchSize == 0 || p.coalescedIrreversibleLive {
+		return false
+	}
+	if libRef.Num()-p.forkDB.LIBNum() >= p.coalescedIrreversibleBatchSize || !p.catchingUp(blk.Number) {
+		p.coalescedIrreversiblePending = nil
+		return false
+	}
+
+	p.coalescedIrreversiblePending = libRef
+	return true
+}
+
+// catchingUp returns true while `num` is more than the coalescing threshold
+// below the head. The head is fetched before locking, again when it is
+// approached since it may have moved in the meantime. Once reached, the
+// forkable is live for good.
+func (p *Forkable) catchingUp(num uint64) bool {
+	head := p.coalescedIrreversibleHead.get()
+	if head == nil {
+		p.logger.Debug("head unknown, not coalescing irreversible blocks")
+		return false
+	}
+
+	if num+p.coalescedIrreversibleThreshold >= head.Num() {
+		p.coalescedIrreversibleLive = true
+		p.coalescedIrreversiblePending = nil
+		p.coalescedIrreversibleHead.stop()
+		return false
+	}
+	return true
+}
+
+// flushCoalescedIrreversible applies the LIB move deferred while catching up,
+// sending its irreversible segment, so the blocks already known final are not
+// lost when the stream stops. The handler signaling the stop block again
+// while they are sent is expected.
+func (p *Forkable) flushCoalescedIrreversible(head bstream.BlockRef) error {
+	libRef := p.coalescedIrreversiblePending
+	if libRef == nil {
+		return nil
+	}
+	p.coalescedIrreversiblePending = nil
+
+	hasNew, irreversibleSegment, stalledBlocks := p.forkDB.HasNewIrreversibleSegment(libRef)
+	if !hasNew {
+		return nil
+	}
+
+	p.logger.Debug("stream stopped, flushing deferred irreversible blocks", zap.Stringer("lib", libRef), zap.Int("count", len(irreversibleSegment)))
+	if err := p.moveLIB(libRef, irreversibleSegment, stalledBlocks, head); err != nil && !errors.Is(err, bstream.ErrStopBlockReached) {
+		return err
+	}
 	return nil
 }
 
+// FlushCoalescedIrreversible applies the LIB move deferred by
+// WithCoalescedCatchupIrreversible, if any, sending the irreversible blocks
+// it holds back. Call it when the source feeding the forkable completes
+// while catching up. Stopping on `bstream.ErrStopBlockReached` flushes them
+// already.
+func (p *Forkable) FlushCoalescedIrreversible() error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.lastBlockSent == nil {
+		return nil
+	}
+	return p.flushCoalescedIrreversible(p.lastBlockSent.AsRef())
+}
+
 func ids(blocks []*ForkableBlock) (ids []string) {
 	ids = make([]string, len(blocks))
 	for i, obj := range blocks {
@@ -751,6 +1534,25 @@ func (p *Forkable) sentChainSegment(ids []string, doingRedos bool) (ppBlocks []*
 }
 
 func (p *Forkable) processBlocks(currentBlock *pbbstream.Block, blocks []*ForkableBlock, step bstream.StepType, reorgJunctionBlock bstream.BlockRef) error {
+	if step == bstream.StepUndo && p.sequentialUndoDelivery {
+		// each undo is its own single block step, only for blocks that were sent as New
+		for _, block := range blocks {
+			if !block.sentAsNew {
+				continue
+			}
+			if err := p.sendBlocks(currentBlock, []*ForkableBlock{block}, step, reorgJunctionBlock); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return p.sendBlocks(currentBlock, blocks, step, reorgJunctionBlock)
+}
+
+func (p *Forkable) sendBlocks(currentBlock *pbbstream.Block, blocks []*ForkableBlock, step bstream.StepType, reorgJunctionBlock bstream.BlockRef) error {
+	canonicalChain := p.canonicalChainRefs()
+
 	var objs []*bstream.PreprocessedBlock
 
 	for _, block := range blocks {
@@ -770,9 +1572,12 @@ func (p *Forkable) processBlocks(currentBlock *pbbstream.Block, blocks []*Forkab
 			step:               step,
 			lastLIBSent:        lib,
 			Obj:                block.Obj,
+			attachments:        block.Attachments,
 			headBlock:          currentBlock.AsRef(),
 			block:              block.Block.AsRef(),
+			previousBlock:      bstream.NewBlockRef(block.Block.ParentId, block.Block.ParentNum),
 			reorgJunctionBlock: reorgJunctionBlock,
+			canonicalChain:     canonicalChain,
 
 			StepIndex:  idx,
 			StepCount:  len(blocks),
@@ -790,7 +1595,17 @@ func (p *Forkable) processBlocks(currentBlock *pbbstream.Block, blocks []*Forkab
 }
 
 func (p *Forkable) processNewBlocks(longestChain []*Block) (err error) {
+	if p.holdBlocksUntilDepth != 0 {
+		// only the blocks with enough descendants are sent, the deepest of them acts as head
+		confirmed := len(longestChain) - int(p.holdBlocksUntilDepth)
+		if confirmed <= 0 {
+			return nil
+		}
+		longestChain = longestChain[:confirmed]
+	}
+
 	headBlock := longestChain[len(longestChain)-1]
+	var canonicalChain []bstream.BlockRef // copied once, only if a block is sent
 	for _, b := range longestChain {
 		ppBlk := b.Object.(*ForkableBlock)
 		if ppBlk.sentAsNew {
@@ -806,16 +1621,32 @@ func (p *Forkable) processNewBlocks(longestChain []*Block) (err error) {
 			if bstream.IsEmpty(lib) {
 				lib = p.forkDB.libRef
 			}
+			if canonicalChain == nil {
+				canonicalChain = p.canonicalChainRefs()
+			}
 			fo := &ForkableObject{
 				headBlock:   headBlock.AsRef(),
 				block:       b.AsRef(),
 				step:        bstream.StepNew,
 				lastLIBSent: lib,
 				Obj:         ppBlk.Obj,
+				attachments: ppBlk.Attachments,
+
+				canonicalChain: canonicalChain,
 			}
 
 			err = p.handler.ProcessBlock(ppBlk.Block, fo)
 			if err != nil {
+				if errors.Is(err, bstream.ErrStopBlockReached) {
+					if flushErr := p.flushCoalescedIrreversible(b.AsRef()); flushErr != nil {
+						return flushErr
+					}
+				}
+				if p.flushIrreversibleOnComplete && errors.Is(err, bstream.ErrStopBlockReached) {
+					if flushErr := p.flushIrreversible(b.AsRef()); flushErr != nil {
+						return flushErr
+					}
+				}
 				return
 			}
 		}
@@ -829,23 +1660,91 @@ func (p *Forkable) processNewBlocks(longestChain []*Block) (err error) {
 		zlog.Debug("block sent as new", zap.Stringer("pblk.block", ppBlk.Block.AsRef()))
 		p.blockFlowed(ppBlk.Block.AsRef())
 		ppBlk.sentAsNew = true
+		ppBlk.sentAsNewAt = p.clock.Now()
 		p.lastBlockSent = ppBlk.Block
+
+		if p.onLive != nil && !p.live {
+			p.checkLive(ppBlk.Block.AsRef())
+		}
 	}
 
 	return
 }
 
-func (p *Forkable) processInitialInclusiveIrreversibleBlock(blk *pbbstream.Block, obj interface{}, sendAsNew bool) error {
+// flushIrreversible sends the blocks of the chain of `head` above the LIB as
+// irreversible, without moving the LIB, see WithFlushIrreversibleOnComplete.
+// The handler signaling the stop block again while they are sent is expected.
+func (p *Forkable) flushIrreversible(head bstream.BlockRef) error {
+	hasNew, irreversibleSegment, _ := p.forkDB.HasNewIrreversibleSegment(head)
+	if !hasNew {
+		return nil
+	}
+
+	p.logger.Debug("stream complete, flushing blocks as irreversible", zap.Stringer("head", head), zap.Int("count", len(irreversibleSegment)))
+	if err := p.processIrreversibleSegment(irreversibleSegment, head); err != nil && !errors.Is(err, bstream.ErrStopBlockReached) {
+		return err
+	}
+	return nil
+}
+
+// checkLive fires onLive once `sent` reaches the live head. The head is
+// fetched before locking, again when reached since it may have moved in the
+// meantime, so the getter is not called on every block while catching up.
+func (p *Forkable) checkLive(sent bstream.BlockRef) {
+	head := p.liveHead.get()
+	if head == nil || sent.Num() < head.Num() {
+		return
+	}
+
+	p.live = true
+	p.liveHead.stop()
+	p.onLive(sent)
+}
+
+// fetchLIBBlock adds the LIB block to the ForkDB when it only knows its
+// reference, so blocks can be linked and resolved down to it. It is sent first
+// when the LIB is inclusive.
+func (p *Forkable) fetchLIBBlock() error {
+	libRef := p.forkDB.libRef
+	if p.forkDB.BlockForID(libRef.ID()) != nil {
+		return nil
+	}
+
+	libBlk, err := p.libFetcher(libRef)
+	if err != nil {
+		return fmt.Errorf("fetching LIB block %s: %w", libRef, err)
+	}
+	if libBlk.Id != libRef.ID() {
+		return fmt.Errorf("fetched LIB block %s does not match LIB %s", libBlk.AsRef(), libRef)
+	}
+
+	libPPBlk := &ForkableBlock{Block: libBlk}
+	p.forkDB.AddLink(libRef, libBlk.ParentId, libPPBlk)
+	if p.includeInitialLIB {
+		return p.processInitialInclusiveIrreversibleBlock(libPPBlk, true)
+	}
+	return nil
+}
+
+// sendsFirstStreamableAsIrreversible is true when `blk` is the first
+// streamable block of the chain and WithFirstStreamableAsIrreversible is set,
+// it is then sent like an inclusive LIB even when the LIB is exclusive.
+func (p *Forkable) sendsFirstStreamableAsIrreversible(blk *pbbstream.Block) bool {
+	return p.firstStreamableAsIrreversible && blk.Number == bstream.GetProtocolFirstStreamableBlock
+}
+
+// processInitialInclusiveIrreversibleBlock sends `ppBlk` as new and irreversible.
+// When the block is stored in the ForkDB, `ppBlk` must be the stored object so
+// that it is flagged as sent as new there.
+func (p *Forkable) processInitialInclusiveIrreversibleBlock(ppBlk *ForkableBlock, sendAsNew bool) error {
+	blk := ppBlk.Block
+
 	// Normally extracted from ForkDB, we create it here:
 	singleBlock := &Block{
 		BlockID:  blk.Id,
 		BlockNum: blk.Number,
 		// Other fields not needed by `processNewBlocks`
-		Object: &ForkableBlock{
-			// WARN: this ForkDB doesn't have a reference to the current block, hopefully downstream doesn't need that (!)
-			Block: blk,
-			Obj:   obj,
-		},
+		Object: ppBlk,
 	}
 
 	tinyChain := []*Block{singleBlock}
@@ -865,6 +1764,8 @@ func (p *Forkable) processInitialInclusiveIrreversibleBlock(blk *pbbstream.Block
 
 func (p *Forkable) processIrreversibleSegment(irreversibleSegment []*Block, headBlock bstream.BlockRef) error {
 	if p.matchFilter(bstream.StepIrreversible) {
+		canonicalChain := p.canonicalChainRefs()
+
 		var irrGroup []*bstream.PreprocessedBlock
 		for _, irrBlock := range irreversibleSegment {
 			preprocBlock := irrBlock.Object.(*ForkableBlock)
@@ -882,9 +1783,12 @@ func (p *Forkable) processIrreversibleSegment(irreversibleSegment []*Block, head
 				step:        bstream.StepIrreversible,
 				lastLIBSent: blkRef, // we are that lastLIBSent
 				Obj:         preprocBlock.Obj,
+				attachments: preprocBlock.Attachments,
 				block:       blkRef,
 				headBlock:   headBlock,
 
+				canonicalChain: canonicalChain,
+
 				StepIndex:  idx,
 				StepCount:  len(irreversibleSegment),
 				StepBlocks: irrGroup,
@@ -896,6 +1800,15 @@ func (p *Forkable) processIrreversibleSegment(irreversibleSegment []*Block, head
 		}
 	}
 
+	if p.finalityLatencyObserver != nil {
+		now := p.clock.Now()
+		for _, irrBlock := range irreversibleSegment {
+			if seenAt := irrBlock.Object.(*ForkableBlock).sentAsNewAt; !seenAt.IsZero() {
+				p.finalityLatencyObserver(irrBlock.AsRef(), seenAt, now)
+			}
+		}
+	}
+
 	// Always set the last LIB sent used in the cursor to define where to start back the ForkDB
 	if len(irreversibleSegment) > 0 {
 		irrBlock := irreversibleSegment[len(irreversibleSegment)-1]
@@ -905,8 +1818,29 @@ func (p *Forkable) processIrreversibleSegment(irreversibleSegment []*Block, head
 	return nil
 }
 
+// canonicalChainRefs copies the refs of the LIB and of the blocks of the last
+// longest chain above it, for the objects emitted: the chain itself is
+// recomputed, or truncated in place, by the next blocks.
+func (p *Forkable) canonicalChainRefs() []bstream.BlockRef {
+	lib := p.forkDB.libRef
+	if bstream.IsEmpty(lib) {
+		return nil
+	}
+
+	out := make([]bstream.BlockRef, 0, len(p.lastLongestChain)+1)
+	out = append(out, lib)
+	for _, blk := range p.lastLongestChain {
+		if blk.BlockNum > lib.Num() {
+			out = append(out, blk.AsRef())
+		}
+	}
+	return out
+}
+
 func (p *Forkable) processStalledSegment(stalledBlocks []*Block, headBlock bstream.BlockRef) error {
 	if p.matchFilter(bstream.StepStalled) {
+		canonicalChain := p.canonicalChainRefs()
+
 		var stalledGroup []*bstream.PreprocessedBlock
 		for _, staleBlock := range stalledBlocks {
 			preprocBlock := staleBlock.Object.(*ForkableBlock)
@@ -923,9 +1857,12 @@ func (p *Forkable) processStalledSegment(stalledBlocks []*Block, headBlock bstre
 				step:        bstream.StepStalled,
 				lastLIBSent: p.lastLIBSeen,
 				Obj:         preprocBlock.Obj,
+				attachments: preprocBlock.Attachments,
 				block:       staleBlock.AsRef(),
 				headBlock:   headBlock,
 
+				canonicalChain: canonicalChain,
+
 				StepIndex:  idx,
 				StepCount:  len(stalledBlocks),
 				StepBlocks: stalledGroup,
@@ -939,6 +1876,39 @@ func (p *Forkable) processStalledSegment(stalledBlocks []*Block, headBlock bstre
 	return nil
 }
 
+// keptFinalBlocksCount converts the kept final blocks duration to a number of
+// blocks behind LIB, falling back to keptFinalBlocks when timestamps are unreliable
+func (p *Forkable) keptFinalBlocksCount() int {
+	if p.keptFinalBlocksDuration == 0 || p.lastBlockSent == nil {
+		return p.keptFinalBlocks
+	}
+
+	if p.lastBlockSent.Timestamp.CheckValid() != nil {
+		return p.keptFinalBlocks
+	}
+	cutoff := p.lastBlockSent.Time().Add(-p.keptFinalBlocksDuration)
+
+	libNum := p.forkDB.LIBNum()
+	kept := 0
+	for cur := p.forkDB.BlockForID(p.forkDB.LIBID()); cur != nil; cur = p.forkDB.BlockForID(cur.PreviousBlockID) {
+		fb, ok := cur.Object.(*ForkableBlock)
+		if !ok || fb.Block.Timestamp.CheckValid() != nil {
+			return p.keptFinalBlocks
+		}
+
+		blkTime := fb.Block.Time()
+		if blkTime.After(p.lastBlockSent.Time()) {
+			return p.keptFinalBlocks
+		}
+		if blkTime.Before(cutoff) {
+			break
+		}
+		kept = int(libNum - cur.BlockNum)
+	}
+
+	return kept
+}
+
 func (p *Forkable) blockFlowed(blockRef bstream.BlockRef) {
 	if p.ensureBlockFlows.ID() == "" {
 		return
@@ -962,13 +1932,61 @@ func (p *Forkable) triggersNewLongestChain(blk *pbbstream.Block) bool {
 		return true
 	}
 
+	if p.holdBlocksUntilDepth != 0 && len(p.lastLongestChain) != 0 {
+		// lastBlockSent lags behind the real head, compare with the tip of the longest chain instead
+		return blk.Number > p.lastLongestChain[len(p.lastLongestChain)-1].BlockNum
+	}
+
 	if blk.Number > p.lastBlockSent.Number {
 		return true
 	}
 
+	if p.stickyHead != nil && blk.Number == p.lastBlockSent.Number {
+		if p.forkDB.LIBNum() >= p.stickyHead.Num() {
+			p.stickyHead = nil // LIB passed it, no equal-length fork can involve it anymore
+			return false
+		}
+		return p.onStickyChain(blk.Id, blk.ParentId) && !p.onStickyChain(p.lastBlockSent.Id, p.lastBlockSent.ParentId)
+	}
+
 	return false
 }
 
+// onStickyChain is true when the block `id` is the sticky head or descends
+// from it, `parentID` is used to walk the links when `id` is not linked yet.
+func (p *Forkable) onStickyChain(id, parentID string) bool {
+	if id == p.stickyHead.ID() {
+		return true
+	}
+
+	for cur := parentID; cur != ""; cur = p.forkDB.links[cur] {
+		if cur == p.stickyHead.ID() {
+			return true
+		}
+		if num, found := p.forkDB.nums[cur]; !found || num <= p.stickyHead.Num() {
+			return false
+		}
+	}
+	return false
+}
+
+// headRef returns the head of the longest chain as followed by the Forkable.
+// Among forks of equal length, the ForkDB takes the lowest ID, see
+// ForkDB.HeadBlock, while the Forkable keeps the fork it switched to first
+// (the first received one, or the one of the sticky head): the last block
+// sent is preferred when it is still at the ForkDB head height.
+func (p *Forkable) headRef() bstream.BlockRef {
+	dbHead, found := p.forkDB.HeadBlock()
+	if !found {
+		return nil
+	}
+
+	if p.lastBlockSent != nil && p.lastBlockSent.Number == dbHead.Num() && p.forkDB.Exists(p.lastBlockSent.Id) {
+		return p.lastBlockSent.AsRef()
+	}
+	return dbHead
+}
+
 func (p *Forkable) HeadInfo() (headNum uint64, headID string, headTime time.Time, libNum uint64, err error) {
 	p.RLock()
 	defer p.RUnlock()
@@ -14,17 +14,20 @@
 package forkable
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/streamingfast/bstream"
 	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // testing cursor being applied...
@@ -1520,6 +1523,102 @@ func TestForkable_ForkDBContainsPreviousPreprocessedBlockObjects(t *testing.T) {
 	assert.Equal(t, "mama", blk.Object.(*ForkableBlock).Obj)
 }
 
+func TestForkable_AttachmentsFollowBlock(t *testing.T) {
+	sink := newTestForkableSink(nil, nil)
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithFilters(bstream.StepNew|bstream.StepIrreversible))
+
+	attachments := bstream.Attachments{"correlation_id": "abc"}
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), bstream.NewAttachedObject("mama", attachments)))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 2), "papa"))
+
+	require.Len(t, sink.results, 3)
+
+	assert.Equal(t, bstream.StepNew, sink.results[0].step)
+	assert.Equal(t, "mama", sink.results[0].WrappedObject())
+	assert.Equal(t, attachments, sink.results[0].Attachments())
+
+	assert.Equal(t, bstream.StepNew, sink.results[1].step)
+	assert.Equal(t, "papa", sink.results[1].WrappedObject())
+	assert.Nil(t, sink.results[1].Attachments())
+
+	assert.Equal(t, bstream.StepIrreversible, sink.results[2].step)
+	assert.Equal(t, "mama", sink.results[2].WrappedObject())
+	assert.Equal(t, attachments, bstream.AttachmentsFromObject(sink.results[2]))
+}
+
+func TestForkable_HoldBlocksUntilDepth(t *testing.T) {
+	sink := newTestForkableSink(nil, nil)
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")), HoldBlocksUntilDepth(2), WithFilters(bstream.StepNew|bstream.StepUndo))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+	assert.Len(t, sink.results, 0)
+
+	require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005a", "00000004a", 1), nil))
+
+	// a shallow fork does not reach sent blocks
+	require.NoError(t, p.ProcessBlock(tb("00000005b", "00000004a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000006b", "00000005b", 1), nil))
+
+	var got []string
+	for _, res := range sink.results {
+		got = append(got, fmt.Sprintf("%s:%s", res.step, res.block.ID()))
+	}
+	assert.Equal(t, []string{"new:00000002a", "new:00000003a", "new:00000004a"}, got)
+
+	last := sink.results[len(sink.results)-1].Cursor()
+	assert.Equal(t, "00000004a", last.HeadBlock.ID())
+	assert.Equal(t, "00000004a", last.Block.ID())
+}
+
+func TestForkable_WithLIBUpdateHandler(t *testing.T) {
+	var libs []string
+	p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithFilters(bstream.StepNew), WithLIBUpdateHandler(func(lib bstream.BlockRef) {
+		libs = append(libs, lib.ID())
+	}))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 2), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 2), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005a", "00000004a", 4), nil))
+
+	assert.Equal(t, []string{"00000002a", "00000004a"}, libs)
+}
+
+func TestForkable_BelowLIB(t *testing.T) {
+	feed := func(t *testing.T, p *Forkable) {
+		t.Helper()
+		require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000005a", "00000004a", 4), nil))
+		require.Equal(t, uint64(4), p.forkDB.LIBNum())
+	}
+
+	t.Run("silent drop by default", func(t *testing.T) {
+		p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")))
+		feed(t, p)
+		assert.NoError(t, p.ProcessBlock(tb("00000002b", "00000001a", 1), nil))
+	})
+
+	t.Run("below LIB handler", func(t *testing.T) {
+		var seen []string
+		p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithBelowLIBHandler(func(blk *pbbstream.Block) {
+			seen = append(seen, blk.Id)
+		}))
+		feed(t, p)
+		assert.NoError(t, p.ProcessBlock(tb("00000002b", "00000001a", 1), nil))
+		assert.Equal(t, []string{"00000002b"}, seen)
+	})
+
+	t.Run("reject below LIB", func(t *testing.T) {
+		p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithRejectBelowLIB())
+		feed(t, p)
+		assert.Error(t, p.ProcessBlock(tb("00000002b", "00000001a", 1), nil))
+	})
+}
+
 var nullHandler = bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
 	return nil
 })
@@ -1887,3 +1986,1014 @@ func TestForkableSentChainSwitchSegments(t *testing.T) {
 	assert.Nil(t, undos)
 	assert.Nil(t, redos)
 }
+
+func TestForkable_WithGateUntilHead(t *testing.T) {
+	sink := newTestForkableSink(nil, nil)
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithGateUntilHead(bRef("00000004a")))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 2), nil))
+	assert.Len(t, sink.results, 0)
+
+	require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 2), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005a", "00000004a", 3), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000006a", "00000005a", 5), nil))
+
+	var got []string
+	for _, res := range sink.results {
+		got = append(got, fmt.Sprintf("%s:%s", res.step, res.block.ID()))
+	}
+	assert.Equal(t, []string{"new:00000004a", "new:00000005a", "new:00000006a", "irreversible:00000004a", "irreversible:00000005a"}, got)
+
+	first := sink.results[0].Cursor()
+	assert.Equal(t, "00000004a", first.Block.ID())
+	assert.Equal(t, "00000002a", first.LIB.ID())
+}
+
+func TestForkable_GateOpen(t *testing.T) {
+	t.Run("without gate", func(t *testing.T) {
+		p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")))
+		assert.True(t, p.GateOpen())
+
+		called := 0
+		p.OnGateOpen(func() { called++ })
+		assert.Equal(t, 1, called)
+	})
+
+	t.Run("gate until head", func(t *testing.T) {
+		p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithGateUntilHead(bRef("00000004a")))
+
+		called := 0
+		p.OnGateOpen(func() {
+			called++
+			assert.True(t, p.GateOpen())
+		})
+
+		require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 2), nil))
+		assert.False(t, p.GateOpen())
+		assert.Equal(t, 0, called)
+
+		require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 2), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000005a", "00000004a", 3), nil))
+		assert.True(t, p.GateOpen())
+		assert.Equal(t, 1, called)
+	})
+
+	t.Run("ensure block flows", func(t *testing.T) {
+		p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), EnsureBlockFlows(bRef("00000003a")))
+
+		called := 0
+		p.OnGateOpen(func() { called++ })
+
+		require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+		assert.False(t, p.GateOpen())
+
+		require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 1), nil))
+		assert.True(t, p.GateOpen())
+		assert.Equal(t, 1, called)
+	})
+}
+
+func TestForkable_WithKeptFinalBlocksDuration(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feed := func(t *testing.T, p *Forkable, withoutTimestamp uint64) {
+		t.Helper()
+		for i := uint64(2); i <= 10; i++ {
+			blk := tb(fmt.Sprintf("%08xa", i), fmt.Sprintf("%08xa", i-1), i-1)
+			blk.Timestamp = timestamppb.New(start.Add(time.Duration(i) * time.Second))
+			if i == withoutTimestamp {
+				blk.Timestamp = nil
+			}
+			require.NoError(t, p.ProcessBlock(blk, nil))
+		}
+		require.Equal(t, uint64(9), p.forkDB.LIBNum())
+	}
+	keptNums := func(p *Forkable) (out []uint64) {
+		for num := uint64(0); num <= 10; num++ {
+			for _, n := range p.forkDB.nums {
+				if n == num {
+					out = append(out, num)
+				}
+			}
+		}
+		return
+	}
+
+	t.Run("time window", func(t *testing.T) {
+		p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithKeptFinalBlocks(1), WithKeptFinalBlocksDuration(3*time.Second))
+		feed(t, p, 0)
+		assert.Equal(t, []uint64{7, 8, 9, 10}, keptNums(p))
+	})
+
+	t.Run("unreliable timestamps fall back to count", func(t *testing.T) {
+		p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithKeptFinalBlocks(1), WithKeptFinalBlocksDuration(3*time.Second))
+		feed(t, p, 8)
+		assert.Equal(t, []uint64{8, 9, 10}, keptNums(p))
+	})
+}
+
+func TestForkable_WithFinalityLatencyObserver(t *testing.T) {
+	var finalized []string
+	p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithFilters(bstream.StepNew), WithFinalityLatencyObserver(func(blk bstream.BlockRef, seen, final time.Time) {
+		assert.False(t, seen.IsZero())
+		assert.False(t, final.Before(seen))
+		finalized = append(finalized, blk.ID())
+	}))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 3), nil))
+	assert.Equal(t, []string{"00000002a", "00000003a"}, finalized)
+}
+
+func TestForkable_WithMaxSkipDistance(t *testing.T) {
+	p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithMaxSkipDistance(3))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005a", "00000002a", 1), nil), "skipping within distance")
+
+	err := p.ProcessBlock(tb("00000009a", "00000005a", 1), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "max skip distance")
+	assert.Equal(t, uint64(5), p.HeadNum())
+
+	require.NoError(t, p.ProcessBlock(tb("00000009b", "00000007b", 1), nil), "unlinkable blocks are not checked")
+	require.NoError(t, p.ProcessBlock(tb("00000008a", "00000005a", 1), nil))
+	assert.Equal(t, uint64(8), p.HeadNum())
+
+	err = p.ProcessBlock(tb("00000012b", "00000001a", 1), nil)
+	require.Error(t, err, "blocks linking to the LIB reference are checked")
+	assert.Contains(t, err.Error(), "max skip distance")
+}
+
+func TestForkable_WithSequentialUndoDelivery(t *testing.T) {
+	sink := newTestForkableSink(nil, nil)
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithFilters(bstream.StepUndo), WithSequentialUndoDelivery())
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003b", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004b", "00000003b", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005b", "00000004b", 1), nil))
+
+	require.Len(t, sink.results, 2)
+	for i, expected := range []string{"00000004a", "00000003a"} {
+		res := sink.results[i]
+		assert.Equal(t, bstream.StepUndo, res.Step())
+		assert.Equal(t, expected, res.block.ID())
+		assert.Equal(t, 1, res.StepCount)
+		assert.Equal(t, 0, res.StepIndex)
+		require.Len(t, res.StepBlocks, 1)
+		assert.Equal(t, expected, res.StepBlocks[0].Block.Id)
+		assert.Equal(t, "00000002a", res.ReorgJunctionBlock().ID())
+	}
+}
+
+func TestForkable_WithExpectedChainTag(t *testing.T) {
+	sink := newTestForkableSink(nil, nil)
+	tagOf := func(blk *pbbstream.Block) string {
+		return blk.Id[len(blk.Id)-1:]
+	}
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithExpectedChainTag("a", tagOf))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+
+	err := p.ProcessBlock(tb("00000003b", "00000002a", 1), nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `chain tag "b" but "a" is expected`)
+
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+	assert.Equal(t, uint64(3), p.HeadNum())
+	require.Len(t, sink.results, 2)
+}
+
+func TestForkable_WithCoalescedCatchupIrreversible(t *testing.T) {
+	headGetter := func(head uint64) bstream.BlockRefGetter {
+		return func(context.Context) (bstream.BlockRef, error) {
+			return bstream.NewBlockRef(fmt.Sprintf("%08xa", head), head), nil
+		}
+	}
+
+	t.Run("coalesced until near head", func(t *testing.T) {
+		sink := newTestForkableSink(nil, nil)
+		p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithFilters(bstream.StepIrreversible), WithCoalescedCatchupIrreversible(3, headGetter(10), 2))
+
+		for i := uint64(2); i <= 10; i++ {
+			require.NoError(t, p.ProcessBlock(tb(fmt.Sprintf("%08xa", i), fmt.Sprintf("%08xa", i-1), i-1), nil))
+		}
+
+		var segments [][]string
+		for _, res := range sink.results {
+			if res.StepIndex == 0 {
+				segments = append(segments, nil)
+			}
+			segments[len(segments)-1] = append(segments[len(segments)-1], res.block.ID())
+		}
+		assert.Equal(t, [][]string{
+			{"00000002a", "00000003a", "00000004a"},
+			{"00000005a", "00000006a", "00000007a"},
+			{"00000008a"},
+			{"00000009a"},
+		}, segments)
+		assert.Equal(t, uint64(9), p.forkDB.LIBNum())
+	})
+
+	t.Run("flushed on stop", func(t *testing.T) {
+		var irreversible []string
+		handler := bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			switch obj.(*ForkableObject).Step() {
+			case bstream.StepIrreversible:
+				irreversible = append(irreversible, blk.Id)
+			case bstream.StepNew:
+				if blk.Number == 5 {
+					return bstream.ErrStopBlockReached
+				}
+			}
+			return nil
+		})
+		p := New(handler, WithExclusiveLIB(bRef("00000001a")), WithCoalescedCatchupIrreversible(10, headGetter(100), 2))
+
+		for i := uint64(2); i <= 4; i++ {
+			require.NoError(t, p.ProcessBlock(tb(fmt.Sprintf("%08xa", i), fmt.Sprintf("%08xa", i-1), i-1), nil))
+		}
+		assert.Empty(t, irreversible, "deferred while catching up")
+
+		err := p.ProcessBlock(tb("00000005a", "00000004a", 4), nil)
+		require.ErrorIs(t, err, bstream.ErrStopBlockReached)
+		assert.Equal(t, []string{"00000002a", "00000003a"}, irreversible)
+		assert.Equal(t, uint64(3), p.forkDB.LIBNum())
+	})
+
+	t.Run("flushed on completion", func(t *testing.T) {
+		sink := newTestForkableSink(nil, nil)
+		p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithFilters(bstream.StepIrreversible), WithCoalescedCatchupIrreversible(10, headGetter(100), 2))
+
+		for i := uint64(2); i <= 4; i++ {
+			require.NoError(t, p.ProcessBlock(tb(fmt.Sprintf("%08xa", i), fmt.Sprintf("%08xa", i-1), i-1), nil))
+		}
+		require.Empty(t, sink.results)
+
+		require.NoError(t, p.FlushCoalescedIrreversible())
+		require.Len(t, sink.results, 2)
+		assert.Equal(t, "00000003a", sink.results[1].block.ID())
+		assert.Equal(t, uint64(3), p.forkDB.LIBNum())
+	})
+
+	t.Run("head fetched outside the lock", func(t *testing.T) {
+		var p *Forkable
+		calls := 0
+		getter := func(ctx context.Context) (bstream.BlockRef, error) {
+			calls++
+			require.True(t, p.TryRLock(), "head getter called while the forkable is locked")
+			p.RUnlock()
+			return bRef("00000064a"), nil
+		}
+		p = New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithCoalescedCatchupIrreversible(10, getter, 2))
+
+		for i := uint64(2); i <= 4; i++ {
+			require.NoError(t, p.ProcessBlock(tb(fmt.Sprintf("%08xa", i), fmt.Sprintf("%08xa", i-1), i-1), nil))
+		}
+		assert.Equal(t, 1, calls, "fetched again only when approached")
+	})
+}
+
+func TestForkableObject_RestoreCursor(t *testing.T) {
+	sink := newTestForkableSink(nil, nil)
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithFilters(bstream.StepNew|bstream.StepUndo))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003b", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004b", "00000003b", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005b", "00000004b", 1), nil)) // triggers the undo/redo cascade
+
+	var cursors, restoreCursors []string
+	for _, res := range sink.results {
+		cursors = append(cursors, res.Cursor().String())
+		restoreCursors = append(restoreCursors, res.RestoreCursor().String())
+	}
+
+	assert.Equal(t, []string{
+		"c1:1:2:00000002a:1:00000001a",
+		"c1:1:3:00000003a:1:00000001a",
+		"c1:1:4:00000004a:1:00000001a",
+		"c3:2:4:00000004a:5:00000005b:1:00000001a",
+		"c3:2:3:00000003a:5:00000005b:1:00000001a",
+		"c3:1:3:00000003b:5:00000005b:1:00000001a",
+		"c3:1:4:00000004b:5:00000005b:1:00000001a",
+		"c1:1:5:00000005b:1:00000001a",
+	}, cursors)
+
+	assert.Equal(t, []string{
+		"c1:1:2:00000002a:1:00000001a",
+		"c1:1:3:00000003a:1:00000001a",
+		"c1:1:4:00000004a:1:00000001a",
+		"c1:1:3:00000003a:1:00000001a", // undoing 4a brings the consumer back to 3a
+		"c1:1:2:00000002a:1:00000001a", // undoing 3a brings the consumer back to the junction 2a
+		"c1:1:3:00000003b:1:00000001a",
+		"c1:1:4:00000004b:1:00000001a",
+		"c1:1:5:00000005b:1:00000001a",
+	}, restoreCursors)
+}
+
+func TestForkable_WithPreconfirmationHandler(t *testing.T) {
+	var preconfirmed []string
+	sink := newTestForkableSink(nil, nil)
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithFilters(bstream.StepNew), WithPreconfirmationHandler(func(blk *pbbstream.Block) {
+		preconfirmed = append(preconfirmed, blk.Id)
+	}))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003b", "00000002a", 1), nil)) // shorter fork
+	require.NoError(t, p.ProcessBlock(tb("00000006x", "00000005x", 1), nil)) // unlinkable
+	require.NoError(t, p.ProcessBlock(tb("00000003b", "00000002a", 1), nil)) // already known
+	require.NoError(t, p.ProcessBlock(tb("00000004b", "00000003b", 1), nil)) // switches to the b fork
+
+	assert.Equal(t, []string{"00000003b", "00000006x"}, preconfirmed)
+
+	var sent []string
+	for _, res := range sink.results {
+		sent = append(sent, res.block.ID())
+	}
+	assert.Equal(t, []string{"00000002a", "00000003a", "00000003b", "00000004b"}, sent)
+}
+
+func TestForkable_WithPreconfirmationHandler_InitialLIB(t *testing.T) {
+	var preconfirmed []string
+	sink := newTestForkableSink(nil, nil)
+	p := New(sink, WithFilters(bstream.StepNew|bstream.StepIrreversible), WithPreconfirmationHandler(func(blk *pbbstream.Block) {
+		preconfirmed = append(preconfirmed, blk.Id)
+	}))
+
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 3), nil)) // becomes the LIB, sent as new
+	require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 3), nil))
+
+	assert.Empty(t, preconfirmed)
+	assert.True(t, p.forkDB.BlockForID("00000003a").Object.(*ForkableBlock).sentAsNew)
+}
+
+func TestForkable_WithLibNumMonotonicityCheck(t *testing.T) {
+	type regression struct {
+		blk             string
+		prevLib, newLib uint64
+	}
+
+	t.Run("observational", func(t *testing.T) {
+		var regressions []regression
+		sink := newTestForkableSink(nil, nil)
+		p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithLibNumMonotonicityCheck(func(blk bstream.BlockRef, prevLib, newLib uint64) {
+			regressions = append(regressions, regression{blk.ID(), prevLib, newLib})
+		}))
+
+		require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 2), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 1), nil)) // regression
+		require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 1), nil)) // already known
+		require.NoError(t, p.ProcessBlock(tb("00000003b", "00000002a", 1), nil)) // other chain, parent has LIB 1
+
+		assert.Equal(t, []regression{{"00000004a", 2, 1}}, regressions)
+		assert.NotNil(t, p.forkDB.BlockForID("00000004a"))
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		sink := newTestForkableSink(nil, nil)
+		p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithStrictLibNumMonotonicity())
+
+		require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 2), nil))
+		err := p.ProcessBlock(tb("00000004a", "00000003a", 1), nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "has LIB #1, below LIB #2 of its parent")
+		assert.Nil(t, p.forkDB.BlockForID("00000004a"))
+	})
+
+	t.Run("parent is the LIB reference", func(t *testing.T) {
+		var regressions []regression
+		p := New(nullHandler, WithExclusiveLIB(bRef("00000005a")), WithLibNumMonotonicityCheck(func(blk bstream.BlockRef, prevLib, newLib uint64) {
+			regressions = append(regressions, regression{blk.ID(), prevLib, newLib})
+		}))
+
+		require.NoError(t, p.ProcessBlock(tb("00000006a", "00000005a", 3), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000007a", "00000006a", 4), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000008a", "00000007a", 3), nil)) // regression
+		assert.Equal(t, []regression{{"00000008a", 4, 3}}, regressions)
+	})
+}
+
+func TestForkable_WithLIBFetcher(t *testing.T) {
+	fetched := 0
+	fetcher := func(ref bstream.BlockRef) (*pbbstream.Block, error) {
+		fetched++
+		return tb(ref.ID(), "00000001a", 1), nil
+	}
+
+	t.Run("inclusive LIB sent first", func(t *testing.T) {
+		fetched = 0
+		sink := newTestForkableSink(nil, nil)
+		p := New(sink, WithInclusiveLIB(bRef("00000002a")), WithLIBFetcher(fetcher))
+
+		require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 2), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 2), nil))
+
+		var sent []string
+		for _, res := range sink.results {
+			sent = append(sent, fmt.Sprintf("%s %s", res.block.ID(), res.step))
+		}
+		assert.Equal(t, []string{
+			"00000002a new",
+			"00000002a irreversible",
+			"00000003a new",
+			"00000004a new",
+		}, sent)
+		assert.Equal(t, 1, fetched)
+	})
+
+	cursor := &bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     bRef("00000003a"),
+		HeadBlock: bRef("00000003a"),
+		LIB:       bRef("00000002a"),
+	}
+	resumeFromCursor := func(opts ...Option) ([]*bstream.PreprocessedBlock, error) {
+		p := New(nullHandler, append([]Option{WithExclusiveLIB(bRef("00000002a"))}, opts...)...)
+		require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 2), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 2), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000005a", "00000004a", 2), nil))
+
+		var out []*bstream.PreprocessedBlock
+		err := p.CallWithBlocksFromCursor(cursor, func(blocks []*bstream.PreprocessedBlock) {
+			out = blocks
+		})
+		return out, err
+	}
+
+	t.Run("cursor on exclusive LIB not resolvable without it", func(t *testing.T) {
+		_, err := resumeFromCursor()
+		require.Error(t, err)
+	})
+
+	t.Run("cursor on exclusive LIB", func(t *testing.T) {
+		fetched = 0
+		blocks, err := resumeFromCursor(WithLIBFetcher(fetcher))
+		require.NoError(t, err)
+		require.Len(t, blocks, 2)
+		assert.Equal(t, "00000004a", blocks[0].Block.Id)
+		assert.Equal(t, "00000005a", blocks[1].Block.Id)
+		assert.Equal(t, 1, fetched)
+	})
+}
+
+func TestForkable_WithLiveMarker(t *testing.T) {
+	heads := []bstream.BlockRef{bRef("00000004a"), bRef("00000006a")}
+	getterCalls := 0
+	headGetter := func(ctx context.Context) (bstream.BlockRef, error) {
+		head := heads[len(heads)-1]
+		if getterCalls < len(heads) {
+			head = heads[getterCalls]
+		}
+		getterCalls++
+		return head, nil
+	}
+
+	var liveAt []string
+	p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithLiveMarker(headGetter, func(at bstream.BlockRef) {
+		liveAt = append(liveAt, at.ID())
+	}))
+
+	for i := 2; i <= 9; i++ {
+		require.NoError(t, p.ProcessBlock(tb(fmt.Sprintf("%08xa", i), fmt.Sprintf("%08xa", i-1), 1), nil))
+	}
+
+	assert.Equal(t, []string{"00000006a"}, liveAt, "head moved from 4 to 6 while catching up")
+	assert.Equal(t, 3, getterCalls)
+}
+
+func TestForkable_WithLiveMarker_HeadFetchedOutsideLock(t *testing.T) {
+	var p *Forkable
+	getter := func(ctx context.Context) (bstream.BlockRef, error) {
+		require.True(t, p.TryRLock(), "head getter called while the forkable is locked")
+		p.RUnlock()
+		return bRef("00000003a"), nil
+	}
+
+	var liveAt []string
+	p = New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithLiveMarker(getter, func(at bstream.BlockRef) {
+		liveAt = append(liveAt, at.ID())
+	}))
+
+	for i := 2; i <= 4; i++ {
+		require.NoError(t, p.ProcessBlock(tb(fmt.Sprintf("%08xa", i), fmt.Sprintf("%08xa", i-1), 1), nil))
+	}
+	assert.Equal(t, []string{"00000003a"}, liveAt)
+}
+
+func TestForkable_WithClock(t *testing.T) {
+	clock := bstream.NewTestClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithFailOnUnlinkableBlocks(2, time.Minute), WithClock(clock))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004b", "00000003b", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005b", "00000004b", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000006b", "00000005b", 1), nil), "still within the grace period")
+
+	clock.Advance(2 * time.Minute)
+	require.Error(t, p.ProcessBlock(tb("00000007b", "00000006b", 1), nil))
+}
+
+func TestForkable_MarkIrreversible(t *testing.T) {
+	sink := newTestForkableSink(nil, nil)
+	var libUpdates []string
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithFilters(bstream.StepIrreversible), WithLIBUpdateHandler(func(lib bstream.BlockRef) {
+		libUpdates = append(libUpdates, lib.ID())
+	}))
+
+	require.EqualError(t, p.MarkIrreversible(bRef("00000002a")), "cannot mark block #2 (00000002a) irreversible: no block sent yet")
+
+	for _, blk := range []*pbbstream.Block{
+		tb("00000002a", "00000001a", 1),
+		tb("00000003a", "00000002a", 1),
+		tb("00000004a", "00000003a", 1),
+		tb("00000004b", "00000003a", 1),
+		tb("00000005a", "00000004a", 1),
+	} {
+		require.NoError(t, p.ProcessBlock(blk, nil))
+	}
+	require.Empty(t, sink.results)
+
+	require.NoError(t, p.MarkIrreversible(bRef("00000003a")))
+	assert.Equal(t, uint64(3), p.forkDB.LIBNum())
+	assert.Equal(t, []string{"00000003a"}, libUpdates)
+
+	var irreversible []string
+	for _, res := range sink.results {
+		irreversible = append(irreversible, res.block.ID())
+	}
+	assert.Equal(t, []string{"00000002a", "00000003a"}, irreversible)
+
+	require.NoError(t, p.MarkIrreversible(bRef("00000002a")), "already irreversible")
+
+	err := p.MarkIrreversible(bRef("00000004b"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not on the chain of head block")
+
+	err = p.MarkIrreversible(bRef("00000009a"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown block")
+
+	// blocks still carrying an older LibNum do not move the LIB back
+	require.NoError(t, p.ProcessBlock(tb("00000006a", "00000005a", 2), nil))
+	assert.Equal(t, uint64(3), p.forkDB.LIBNum())
+	assert.Len(t, sink.results, 2)
+}
+
+func TestForkable_WithOrphanedSubtreeObserver(t *testing.T) {
+	type orphaned struct {
+		root   string
+		blocks []string
+	}
+
+	var observed []orphaned
+	sink := newTestForkableSink(nil, nil)
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithOrphanedSubtreeObserver(func(root bstream.BlockRef, blocks []bstream.BlockRef) {
+		var ids []string
+		for _, blk := range blocks {
+			ids = append(ids, blk.ID())
+		}
+		observed = append(observed, orphaned{root.ID(), ids})
+	}))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003b", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003c", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004b", "00000003b", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005a", "00000004a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005b", "00000004b", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005c", "00000004a", 1), nil)) // forks from the next LIB, still alive
+	assert.Empty(t, observed)
+
+	require.NoError(t, p.ProcessBlock(tb("00000006a", "00000005a", 4), nil))
+	assert.Equal(t, []orphaned{
+		{"00000003b", []string{"00000003b", "00000004b", "00000005b"}},
+		{"00000003c", []string{"00000003c"}},
+	}, observed)
+}
+
+func TestForkable_WithFirstStreamableAsIrreversible(t *testing.T) {
+	defer func(firstStreamable uint64) { bstream.GetProtocolFirstStreamableBlock = firstStreamable }(bstream.GetProtocolFirstStreamableBlock)
+	bstream.GetProtocolFirstStreamableBlock = 2
+
+	cases := []struct {
+		name    string
+		options []Option
+	}{
+		{"inclusive LIB", []Option{WithInclusiveLIB(bRef("00000002a"))}},
+		{"exclusive LIB", []Option{WithExclusiveLIB(bRef("00000002a"))}},
+		{"no initial LIB", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sink := newTestForkableSink(nil, nil)
+			p := New(sink, append(c.options, WithFirstStreamableAsIrreversible())...)
+
+			require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 2), nil))
+			require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 2), nil)) // sent again by the source
+			require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 2), nil))
+
+			var sent []string
+			for _, res := range sink.results {
+				sent = append(sent, res.step.String()+" "+res.block.ID())
+			}
+			assert.Equal(t, []string{"new 00000002a", "irreversible 00000002a", "new 00000003a"}, sent)
+		})
+	}
+}
+
+func TestForkable_WithStickyHead(t *testing.T) {
+	run := func(options ...Option) []string {
+		sink := newTestForkableSink(nil, nil)
+		p := New(sink, append([]Option{WithExclusiveLIB(bRef("00000001a"))}, options...)...)
+
+		require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000003b", "00000002a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000004b", "00000003b", 1), nil))
+
+		var sent []string
+		for _, res := range sink.results {
+			sent = append(sent, res.step.String()+" "+res.block.ID())
+		}
+		return sent
+	}
+
+	// first received wins among equal-length forks
+	assert.Equal(t, []string{
+		"new 00000002a",
+		"new 00000003b",
+		"undo 00000003b",
+		"new 00000003a",
+		"new 00000004a",
+	}, run())
+
+	// 00000004b descends from the previous head, it wins at equal length
+	assert.Equal(t, []string{
+		"new 00000002a",
+		"new 00000003b",
+		"undo 00000003b",
+		"new 00000003a",
+		"new 00000004a",
+		"undo 00000004a",
+		"undo 00000003a",
+		"new 00000003b",
+		"new 00000004b",
+	}, run(WithStickyHead(bRef("00000003b"))))
+
+	// the chain is already the one of the previous head
+	assert.Equal(t, []string{
+		"new 00000002a",
+		"new 00000003b",
+		"undo 00000003b",
+		"new 00000003a",
+		"new 00000004a",
+	}, run(WithStickyHead(bRef("00000004a"))))
+}
+
+func TestForkable_CallWithCanonicalBlocks_EqualLengthForks(t *testing.T) {
+	canonical := func(p *Forkable) (out []string) {
+		require.NoError(t, p.CallWithCanonicalBlocks(func(blks []*bstream.PreprocessedBlock) {
+			for _, blk := range blks {
+				out = append(out, blk.Block.Id)
+			}
+		}))
+		return out
+	}
+
+	p := New(newTestForkableSink(nil, nil), WithExclusiveLIB(bRef("00000001a")))
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003b", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+
+	head, _ := p.forkDB.HeadBlock()
+	assert.Equal(t, "00000003a", head.ID(), "ForkDB takes the lowest ID")
+	assert.Equal(t, []string{"00000002a", "00000003b"}, canonical(p), "forkable keeps the first received fork")
+
+	p = New(newTestForkableSink(nil, nil), WithExclusiveLIB(bRef("00000001a")), WithStickyHead(bRef("00000003b")))
+	for _, blk := range []*pbbstream.Block{
+		tb("00000002a", "00000001a", 1),
+		tb("00000003a", "00000002a", 1),
+		tb("00000004a", "00000003a", 1),
+		tb("00000003b", "00000002a", 1),
+		tb("00000004b", "00000003b", 1),
+	} {
+		require.NoError(t, p.ProcessBlock(blk, nil))
+	}
+	assert.Equal(t, []string{"00000002a", "00000003b", "00000004b"}, canonical(p), "sticky head fork")
+}
+
+func TestForkable_WithRedoBatchLimit(t *testing.T) {
+	blocks := []*pbbstream.Block{
+		tb("00000002a", "00000001a", 1),
+		tb("00000003a", "00000002a", 1),
+		tb("00000004a", "00000003a", 1),
+		tb("00000005a", "00000004a", 1),
+		tb("00000003b", "00000002a", 1),
+		tb("00000004b", "00000003b", 1),
+		tb("00000005b", "00000004b", 1),
+		tb("00000006b", "00000005b", 1),
+		tb("00000006a", "00000005a", 1),
+		tb("00000007a", "00000006a", 1), // switches back to a, redo of 3a, 4a and 5a
+		tb("00000008a", "00000007a", 1),
+		tb("00000009a", "00000008a", 1),
+	}
+
+	steps := func(sink *testForkableSink) (out []string) {
+		for _, res := range sink.results {
+			out = append(out, res.step.String()+" "+res.block.ID())
+		}
+		return
+	}
+
+	unlimited := newTestForkableSink(nil, nil)
+	p := New(unlimited, WithExclusiveLIB(bRef("00000001a")))
+	for _, blk := range blocks {
+		require.NoError(t, p.ProcessBlock(blk, nil))
+	}
+
+	limited := newTestForkableSink(nil, nil)
+	p = New(limited, WithExclusiveLIB(bRef("00000001a")), WithRedoBatchLimit(2))
+	for _, blk := range blocks[:10] {
+		require.NoError(t, p.ProcessBlock(blk, nil))
+	}
+	sent := steps(limited)
+	assert.Equal(t, []string{"new 00000003a", "new 00000004a"}, sent[len(sent)-2:], "only 2 redos sent by the switching block")
+
+	require.NoError(t, p.ProcessBlock(blocks[10], nil))
+	sent = steps(limited)
+	assert.Equal(t, []string{"new 00000005a", "new 00000006a", "new 00000007a", "new 00000008a"}, sent[len(sent)-4:], "last redo, then the new blocks")
+
+	require.NoError(t, p.ProcessBlock(blocks[11], nil))
+	assert.Equal(t, steps(unlimited), steps(limited))
+}
+
+func TestForkable_Stats(t *testing.T) {
+	getterCalls := 0
+	headGetter := func(ctx context.Context) (bstream.BlockRef, error) {
+		getterCalls++
+		return bRef("00000006a"), nil
+	}
+	p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithStatsLiveThreshold(1, headGetter))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004b", "00000003a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005b", "00000004b", 3), nil))
+
+	stats := p.Stats()
+	assert.Equal(t, StepCounts{New: 3}, stats.Catchup)
+	assert.Equal(t, StepCounts{New: 2, Undo: 1, Irreversible: 2}, stats.Live)
+	assert.Equal(t, StepCounts{New: 5, Undo: 1, Irreversible: 2}, stats.Total())
+	assert.Equal(t, 2, getterCalls, "fetched again only within the threshold of the head")
+}
+
+func TestForkable_Stats_LongestChainHead(t *testing.T) {
+	p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithStatsLiveThreshold(1, nil))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000002b", "00000001a", 1), nil)) // late fork, 2 blocks behind
+	require.NoError(t, p.ProcessBlock(tb("00000003b", "00000002b", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004b", "00000003b", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005b", "00000004b", 1), nil))
+
+	stats := p.Stats()
+	assert.Equal(t, StepCounts{}, stats.Catchup, "the blocks behind the head emitted no step")
+	assert.Equal(t, StepCounts{New: 7, Undo: 3}, stats.Live)
+}
+
+func TestForkableObject_Snapshot(t *testing.T) {
+	sink := newTestForkableSink(nil, nil)
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003b", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004b", "00000003b", 2), nil))
+
+	var snapshots []ForkableObjectSnapshot
+	for _, res := range sink.results {
+		snapshots = append(snapshots, res.Snapshot())
+	}
+
+	assert.Equal(t, []ForkableObjectSnapshot{
+		{Step: bstream.StepNew, Block: bRef("00000002a"), HeadBlock: bRef("00000002a"), LIB: bRef("00000001a")},
+		{Step: bstream.StepNew, Block: bRef("00000003a"), HeadBlock: bRef("00000003a"), LIB: bRef("00000001a")},
+		{
+			Step:               bstream.StepUndo,
+			Block:              bRef("00000003a"),
+			HeadBlock:          bRef("00000004b"),
+			LIB:                bRef("00000001a"),
+			ReorgJunctionBlock: bRef("00000002a"),
+			StepCount:          1,
+			StepBlocks:         []bstream.BlockRef{bRef("00000003a")},
+		},
+		{Step: bstream.StepNew, Block: bRef("00000003b"), HeadBlock: bRef("00000004b"), LIB: bRef("00000001a")},
+		{Step: bstream.StepNew, Block: bRef("00000004b"), HeadBlock: bRef("00000004b"), LIB: bRef("00000001a")},
+		{
+			Step:       bstream.StepIrreversible,
+			Block:      bRef("00000002a"),
+			HeadBlock:  bRef("00000004b"),
+			LIB:        bRef("00000002a"),
+			StepCount:  1,
+			StepBlocks: []bstream.BlockRef{bRef("00000002a")},
+		},
+	}, snapshots)
+
+	for i, res := range sink.results {
+		cursor := res.Cursor()
+		assert.Equal(t, cursor.Block.ID(), snapshots[i].Block.ID())
+		assert.Equal(t, cursor.HeadBlock.ID(), snapshots[i].HeadBlock.ID())
+		assert.Equal(t, cursor.LIB.ID(), snapshots[i].LIB.ID())
+	}
+}
+
+func TestForkableObject_CanonicalChainRefs(t *testing.T) {
+	sink := newTestForkableSink(nil, nil)
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")))
+
+	require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000003b", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004b", "00000003b", 2), nil))
+
+	var got []string
+	for _, res := range sink.results {
+		var ids []string
+		for _, ref := range res.CanonicalChainRefs() {
+			ids = append(ids, ref.ID())
+		}
+		got = append(got, fmt.Sprintf("%s:%s %s", res.step, res.block.ID(), strings.Join(ids, ",")))
+	}
+
+	assert.Equal(t, []string{
+		"new:00000002a 00000001a,00000002a",
+		"new:00000003a 00000001a,00000002a,00000003a", // not changed by the fork that came after
+		"undo:00000003a 00000001a,00000002a,00000003b,00000004b",
+		"new:00000003b 00000001a,00000002a,00000003b,00000004b",
+		"new:00000004b 00000001a,00000002a,00000003b,00000004b",
+		"irreversible:00000002a 00000002a,00000003b,00000004b",
+	}, got)
+
+	replayed, err := p.blocksFromCursor(sink.results[5].Cursor())
+	require.NoError(t, err)
+	require.NotEmpty(t, replayed)
+	assert.Nil(t, replayed[0].Obj.(*ForkableObject).CanonicalChainRefs())
+
+	// the longest chain is truncated and appended to in place, ex: by BlockIDs
+	for i := range p.lastLongestChain {
+		p.lastLongestChain[i] = &Block{BlockID: "00000009z", BlockNum: 9}
+	}
+	refs := sink.results[4].CanonicalChainRefs()
+	assert.Equal(t, "00000004b", refs[len(refs)-1].ID(), "refs are copied when the object is emitted")
+}
+
+func TestForkable_WithFlushIrreversibleOnComplete(t *testing.T) {
+	run := func(opts ...Option) (got []string, err error) {
+		stopAt4 := bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			got = append(got, fmt.Sprintf("%s:%s", obj.(*ForkableObject).step, blk.Id))
+			if blk.Number == 4 {
+				return bstream.ErrStopBlockReached
+			}
+			return nil
+		})
+		p := New(stopAt4, append([]Option{WithExclusiveLIB(bRef("00000001a"))}, opts...)...)
+
+		for _, blk := range []*pbbstream.Block{
+			tb("00000002a", "00000001a", 1),
+			tb("00000003a", "00000002a", 1),
+			tb("00000003b", "00000002a", 1),
+			tb("00000004a", "00000003a", 2),
+		} {
+			if err = p.ProcessBlock(blk, nil); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	got, err := run()
+	assert.ErrorIs(t, err, bstream.ErrStopBlockReached)
+	assert.Equal(t, []string{"new:00000002a", "new:00000003a", "new:00000004a"}, got)
+
+	got, err = run(WithFlushIrreversibleOnComplete())
+	assert.ErrorIs(t, err, bstream.ErrStopBlockReached)
+	assert.Equal(t, []string{"new:00000002a", "new:00000003a", "new:00000004a", "irreversible:00000002a", "irreversible:00000003a", "irreversible:00000004a"}, got)
+}
+
+func TestForkable_WithBlockedIDs(t *testing.T) {
+	sink := newTestForkableSink(nil, nil)
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithBlockedIDs([]string{"00000003a"}))
+
+	for _, blk := range []*pbbstream.Block{
+		tb("00000002a", "00000001a", 1),
+		tb("00000003a", "00000002a", 1),
+		tb("00000004a", "00000003a", 1),
+		tb("00000003b", "00000002a", 1),
+	} {
+		require.NoError(t, p.ProcessBlock(blk, nil))
+	}
+
+	var got []string
+	for _, res := range sink.results {
+		got = append(got, fmt.Sprintf("%s:%s", res.step, res.block.ID()))
+	}
+	assert.Equal(t, []string{"new:00000002a", "new:00000003b"}, got)
+	assert.Equal(t, uint64(3), p.HeadNum())
+	assert.False(t, p.forkDB.Exists("00000003a"), "blocked block must not be added to the ForkDB")
+}
+
+func TestForkable_BlockIDs(t *testing.T) {
+	sink := newTestForkableSink(nil, nil)
+	p := New(sink, WithExclusiveLIB(bRef("00000001a")))
+
+	for _, blk := range []*pbbstream.Block{
+		tb("00000002a", "00000001a", 1),
+		tb("00000003a", "00000002a", 1),
+		tb("00000003b", "00000002a", 1),
+		tb("00000004a", "00000003a", 1),
+	} {
+		require.NoError(t, p.ProcessBlock(blk, nil))
+	}
+
+	require.EqualError(t, p.BlockIDs("00000002a", "00000003b"), "cannot block head block #4 (00000004a): no other fork to switch to")
+	assert.True(t, p.forkDB.Exists("00000003b"), "nothing blocked on error")
+
+	sink.results = nil
+	require.NoError(t, p.BlockIDs("00000003a"))
+
+	var got []string
+	for _, res := range sink.results {
+		got = append(got, fmt.Sprintf("%s:%s", res.step, res.block.ID()))
+	}
+	assert.Equal(t, []string{"undo:00000004a", "undo:00000003a", "new:00000003b"}, got)
+	assert.Equal(t, "00000003b", sink.results[2].Cursor().HeadBlock.ID())
+
+	// the blocked block cannot become head again
+	sink.results = nil
+	require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000005a", "00000004a", 1), nil))
+	require.NoError(t, p.ProcessBlock(tb("00000004b", "00000003b", 1), nil))
+
+	got = nil
+	for _, res := range sink.results {
+		got = append(got, fmt.Sprintf("%s:%s", res.step, res.block.ID()))
+	}
+	assert.Equal(t, []string{"new:00000004b"}, got)
+
+	require.EqualError(t, p.BlockIDs("00000001a"), "cannot block irreversible block #1 (00000001a)")
+}
+
+func TestForkable_WithMaxPendingBlocks(t *testing.T) {
+	unlinkable := func(i int) *pbbstream.Block {
+		return tb(fmt.Sprintf("%08dz", 100+i), fmt.Sprintf("%08dy", 99+i), 1)
+	}
+
+	t.Run("drops oldest", func(t *testing.T) {
+		sink := newTestForkableSink(nil, nil)
+		p := New(sink, WithExclusiveLIB(bRef("00000001a")), WithMaxPendingBlocks(10))
+
+		require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000004a", "00000003a", 1), nil))
+		require.NoError(t, p.ProcessBlock(tb("00000003a", "00000002a", 1), nil))
+		for i := 0; i < 50; i++ {
+			require.NoError(t, p.ProcessBlock(unlinkable(i), nil))
+			assert.LessOrEqual(t, len(p.forkDB.unlinkedIDs(p.AllIDs())), 10)
+		}
+
+		assert.Len(t, p.pendingBlocks, 10)
+		assert.False(t, p.forkDB.Exists(unlinkable(39).Id))
+		assert.True(t, p.forkDB.Exists(unlinkable(40).Id))
+		assert.True(t, p.forkDB.Exists("00000004a"), "linked blocks are not pending")
+		assert.NotContains(t, p.pendingBlocks, "00000004a")
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		p := New(nullHandler, WithExclusiveLIB(bRef("00000001a")), WithMaxPendingBlocks(2), WithStrictMaxPendingBlocks())
+
+		require.NoError(t, p.ProcessBlock(tb("00000002a", "00000001a", 1), nil))
+		require.NoError(t, p.ProcessBlock(unlinkable(0), nil))
+		require.NoError(t, p.ProcessBlock(unlinkable(1), nil))
+		err := p.ProcessBlock(unlinkable(2), nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "more than 2 blocks are pending")
+	})
+}
@@ -16,8 +16,10 @@ package forkable
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/streamingfast/bstream"
@@ -186,6 +188,44 @@ func (f *ForkDB) ChainSwitchSegments(oldHeadBlockID, newHeadsPreviousID string)
 	return truncatedUndo, reversedRedo, reorgJunctionBlock
 }
 
+// CommonAncestor walks the parent links of both blocks back to the first
+// block they share, which is one of the two IDs if a block is an ancestor of
+// the other. It returns false if either block is unknown or if the chains
+// don't converge within the links retained in the ForkDB.
+func (f *ForkDB) CommonAncestor(idA, idB string) (string, bool) {
+	f.linksLock.Lock()
+	defer f.linksLock.Unlock()
+
+	if !f.knownBlock(idA) || !f.knownBlock(idB) {
+		return "", false
+	}
+
+	seen := make(map[string]bool)
+	for cur := idA; cur != "" && !seen[cur]; cur = f.links[cur] {
+		seen[cur] = true
+	}
+
+	visited := make(map[string]bool)
+	for cur := idB; cur != "" && !visited[cur]; cur = f.links[cur] {
+		if seen[cur] {
+			return cur, true
+		}
+		visited[cur] = true
+	}
+
+	return "", false
+}
+
+// knownBlock returns true if the block was added or set as LIB. Used only if
+// you already hold the f.linksLock!
+func (f *ForkDB) knownBlock(blockID string) bool {
+	if _, found := f.links[blockID]; found {
+		return true
+	}
+	_, found := f.nums[blockID]
+	return found
+}
+
 func (f *ForkDB) Exists(blockID string) bool {
 	f.linksLock.Lock()
 	defer f.linksLock.Unlock()
@@ -257,6 +297,126 @@ func (f *ForkDB) BlockInCurrentChain(startAtBlock bstream.BlockRef, blockNum uin
 	}
 }
 
+// IsOnLongestChain returns true if `blockID` is part of the longest chain,
+// that is the chain going from the highest block linking back to LIB down to
+// the root of the ForkDB. Forked out and unknown block IDs return false. When
+// two heads share the highest block num, the lowest ID wins.
+func (f *ForkDB) IsOnLongestChain(blockID string) bool {
+	f.linksLock.Lock()
+	defer f.linksLock.Unlock()
+
+	if blockID == "" {
+		return false
+	}
+
+	targetNum, found := f.nums[blockID]
+	if !found {
+		return false
+	}
+
+	cur := f.longestChainHeadID()
+	for cur != "" {
+		if cur == blockID {
+			return true
+		}
+
+		curNum, found := f.nums[cur]
+		if !found || curNum <= targetNum {
+			return false
+		}
+		cur = f.links[cur]
+	}
+	return false
+}
+
+// HeadBlock returns the head of the longest chain, that is the highest block
+// linking back to LIB, or the highest block when no LIB is set. When no block
+// links back to LIB, the LIB itself is the head. The selection is
+// deterministic: when two heads share the highest block num, the
+// lexicographically lowest ID wins, regardless of insertion order. The
+// Forkable does not switch forks on that tiebreak: at equal length, it keeps
+// following the fork it received first, or the one of its sticky head. Returns
+// false when the ForkDB holds no block and has no LIB.
+func (f *ForkDB) HeadBlock() (bstream.BlockRef, bool) {
+	f.linksLock.Lock()
+	defer f.linksLock.Unlock()
+
+	headID := f.longestChainHeadID()
+	if headID == "" {
+		return nil, false
+	}
+
+	if ref := f.blockRefForID(headID); ref != nil {
+		return ref, true
+	}
+	return f.libRef, true
+}
+
+// longestChainHeadID returns the ID of the highest block linking back to LIB,
+// or the highest block when no LIB is set. Ties on the block num are broken
+// by taking the lowest ID. Used only if you already hold the f.linksLock!
+func (f *ForkDB) longestChainHeadID() string {
+	candidates := make([]string, 0, len(f.links))
+	for id := range f.links {
+		candidates = append(candidates, id)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		numI, numJ := f.nums[candidates[i]], f.nums[candidates[j]]
+		if numI != numJ {
+			return numI > numJ
+		}
+		return candidates[i] < candidates[j]
+	})
+
+	for _, id := range candidates {
+		if !f.HasLIB() || f.linksToLIB(id) {
+			return id
+		}
+	}
+
+	if f.HasLIB() {
+		return f.libRef.ID()
+	}
+	return ""
+}
+
+// linksToLIB follows the parent links of `blockID` looking for LIB. Used only
+// if you already hold the f.linksLock!
+func (f *ForkDB) linksToLIB(blockID string) bool {
+	libID, libNum := f.libRef.ID(), f.libRef.Num()
+	for cur := blockID; ; {
+		if cur == libID {
+			return true
+		}
+
+		curNum, found := f.nums[cur]
+		if !found || curNum < libNum {
+			return false
+		}
+
+		parentID, found := f.links[cur]
+		if !found {
+			return false
+		}
+		cur = parentID
+	}
+}
+
+// unlinkedIDs returns the IDs of `ids` still in the ForkDB that do not link
+// back to LIB, in the same order.
+func (f *ForkDB) unlinkedIDs(ids []string) (out []string) {
+	f.linksLock.Lock()
+	defer f.linksLock.Unlock()
+
+	for _, id := range ids {
+		if _, found := f.links[id]; found && !f.linksToLIB(id) {
+			out = append(out, id)
+		}
+	}
+	return
+}
+
 // CompleteSegment is like ReversibleSegment but keeps going passed lib and stops as soon no parent
 // for a given block is present in ForkDB (there could be a hole however in which case this method
 // returns up to the point where the hole is found).
@@ -433,6 +593,71 @@ func (f *ForkDB) stalledInSegment(blocks []*Block) (out []*Block) {
 	return out
 }
 
+// orphanedSubtree is a fork that can never become canonical anymore, its
+// blocks, root first, are ordered by block number then ID.
+type orphanedSubtree struct {
+	root   bstream.BlockRef
+	blocks []bstream.BlockRef
+}
+
+// orphanedSubtrees returns the forks orphaned by moving the LIB from
+// `previousLIBID` through the `irreversibleSegment`: the subtrees rooted at a
+// sibling of a segment block. Forks from the new LIB block are still alive.
+func (f *ForkDB) orphanedSubtrees(previousLIBID string, irreversibleSegment []*Block) (out []*orphanedSubtree) {
+	if len(irreversibleSegment) == 0 {
+		return nil
+	}
+
+	f.linksLock.Lock()
+	defer f.linksLock.Unlock()
+
+	children := make(map[string][]string)
+	for id, prevID := range f.links {
+		children[prevID] = append(children[prevID], id)
+	}
+
+	canonical := make(map[string]bool)
+	for _, blk := range irreversibleSegment {
+		canonical[blk.BlockID] = true
+	}
+
+	junctions := []string{previousLIBID}
+	for _, blk := range irreversibleSegment[:len(irreversibleSegment)-1] {
+		junctions = append(junctions, blk.BlockID)
+	}
+
+	for _, junctionID := range junctions {
+		roots := children[junctionID]
+		sort.Strings(roots)
+		for _, rootID := range roots {
+			if canonical[rootID] {
+				continue
+			}
+
+			var blocks []bstream.BlockRef
+			queue := []string{rootID}
+			for len(queue) > 0 {
+				id := queue[0]
+				queue = queue[1:]
+				blocks = append(blocks, bstream.NewBlockRef(id, f.nums[id]))
+				queue = append(queue, children[id]...)
+			}
+			sort.SliceStable(blocks[1:], func(i, j int) bool {
+				if blocks[i+1].Num() == blocks[j+1].Num() {
+					return blocks[i+1].ID() < blocks[j+1].ID()
+				}
+				return blocks[i+1].Num() < blocks[j+1].Num()
+			})
+
+			out = append(out, &orphanedSubtree{
+				root:   blocks[0],
+				blocks: blocks,
+			})
+		}
+	}
+	return out
+}
+
 // HasNewIrreversibleSegment returns segments upon passing the
 // newDposLIBID that are irreversible and stale. If there was no new
 // segment, `hasNew` will be false. WARN: this method can only be
@@ -539,6 +764,42 @@ func (f *ForkDB) BlockForID(blockID string) *Block {
 	return nil
 }
 
+// BlockForIDPrefix returns the block whose ID starts with `prefix`, for tools
+// where users paste partial IDs. The boolean is false when no block matches,
+// an error is returned when the prefix is empty or matches more than one
+// block. It scans every link, use `BlockForID` on hot paths.
+func (f *ForkDB) BlockForIDPrefix(prefix string) (*Block, bool, error) {
+	if prefix == "" {
+		return nil, false, fmt.Errorf("empty block ID prefix")
+	}
+
+	f.linksLock.Lock()
+	defer f.linksLock.Unlock()
+
+	var matches []string
+	for id := range f.links {
+		if strings.HasPrefix(id, prefix) {
+			matches = append(matches, id)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		id := matches[0]
+		return &Block{
+			BlockID:         id,
+			BlockNum:        f.nums[id],
+			PreviousBlockID: f.links[id],
+			Object:          f.objects[id],
+		}, true, nil
+	}
+
+	sort.Strings(matches)
+	return nil, false, fmt.Errorf("ambiguous block ID prefix %q, matches %d blocks: %s", prefix, len(matches), strings.Join(matches, ", "))
+}
+
 // blockRefForID returns a BlockRef for a given block ID. Used only
 // if you already hold the f.linksLock!
 func (f *ForkDB) blockRefForID(blockID string) bstream.BlockRef {
@@ -549,6 +810,26 @@ func (f *ForkDB) blockRefForID(blockID string) bstream.BlockRef {
 	return nil
 }
 
+// AllBlockRefs returns a ref for every block retained in the ForkDB, sorted
+// by block number then by ID, giving a deterministic view of its content.
+func (f *ForkDB) AllBlockRefs() []bstream.BlockRef {
+	f.linksLock.Lock()
+	defer f.linksLock.Unlock()
+
+	out := make([]bstream.BlockRef, 0, len(f.links))
+	for id := range f.links {
+		out = append(out, bstream.NewBlockRef(id, f.nums[id]))
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Num() != out[j].Num() {
+			return out[i].Num() < out[j].Num()
+		}
+		return out[i].ID() < out[j].ID()
+	})
+	return out
+}
+
 func (f *ForkDB) IterateLinks(callback func(blockID, previousBlockID string, object interface{}) (getNext bool)) {
 	f.linksLock.Lock()
 	defer f.linksLock.Unlock()
@@ -645,28 +926,133 @@ func (f *ForkDB) serializeObject(object any) (*pbforkable.ForkNodeObject, error)
 func (f *ForkDB) Deserialize(data []byte, objectFactory ObjectFactory) error {
 	msg := &pbforkable.ForkDB{}
 	if err := proto.Unmarshal(data, msg); err != nil {
-		return fmt.Errorf("unmarshal: %w", err)
+		return fmt.Errorf("%w: unmarshal: %s", ErrInvalidForkDB, err)
 	}
 
-	// We don't need to lock here, as we are deserializing the whole state
-	// we must therefore be the only one accessing it.
+	libRef := bstream.BlockRefEmpty
+	if msg.LibRef != nil {
+		libRef = bstream.NewBlockRef(msg.LibRef.Id, msg.LibRef.Num)
+	}
 
-	f.links = msg.Links
-	f.nums = msg.Nums
-	f.objects = make(map[string]interface{}, len(msg.Objects))
+	links := msg.Links
+	if links == nil {
+		links = make(map[string]string)
+	}
+	nums := msg.Nums
+	if nums == nil {
+		nums = make(map[string]uint64)
+	}
 
-	var err error
+	if err := validateForkDB(links, nums, libRef); err != nil {
+		return err
+	}
+
+	objects := make(map[string]interface{}, len(msg.Objects))
 	for id, obj := range msg.Objects {
-		f.objects[id], err = f.deserializeObject(obj, objectFactory)
+		if _, found := links[id]; !found {
+			return fmt.Errorf("%w: object of unknown block %q", ErrInvalidForkDB, id)
+		}
+
+		var err error
+		objects[id], err = f.deserializeObject(obj, objectFactory)
 		if err != nil {
-			return fmt.Errorf("deserialize object for block %s: %w", f.blockRefForID(id), err)
+			return fmt.Errorf("deserialize object for block %s: %w", bstream.NewBlockRef(id, nums[id]), err)
 		}
 	}
 
-	if msg.LibRef != nil {
-		f.libRef = bstream.NewBlockRef(msg.LibRef.Id, msg.LibRef.Num)
+	// We don't need to lock here, as we are deserializing the whole state
+	// we must therefore be the only one accessing it. Nothing is changed
+	// until the data is known to be valid, so the ForkDB can still be
+	// bootstrapped another way on error.
+
+	f.links = links
+	f.nums = nums
+	f.objects = objects
+	f.libRef = libRef
+
+	return nil
+}
+
+// ErrInvalidForkDB is wrapped by the errors of ForkDB.Deserialize on data
+// that cannot be decoded or does not form a valid ForkDB, ex: truncated or
+// corrupted on disk.
+var ErrInvalidForkDB = errors.New("invalid forkdb")
+
+// validateForkDB checks that the links form a tree rooted at or below the LIB:
+// every block has a number above the one of its parent, the LIB is a block or
+// the parent of one, and the blocks up to the LIB all lead to the root of the
+// LIB. Blocks above the LIB may lead elsewhere, they are the ones waiting for
+// their parent to link. The blocks are checked in order, the error describes
+// the first inconsistency found.
+func validateForkDB(links map[string]string, nums map[string]uint64, libRef bstream.BlockRef) error {
+	if len(links) == 0 {
+		return nil
+	}
+	if bstream.IsEmpty(libRef) {
+		return fmt.Errorf("%w: %d blocks but no LIB", ErrInvalidForkDB, len(links))
 	}
 
+	ids := make([]string, 0, len(links))
+	for id := range links {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		num, found := nums[id]
+		if !found {
+			return fmt.Errorf("%w: block %q has no number", ErrInvalidForkDB, id)
+		}
+		if parentNum, found := nums[links[id]]; found && parentNum >= num {
+			return fmt.Errorf("%w: block %s has parent %s which is not below it", ErrInvalidForkDB, bstream.NewBlockRef(id, num), bstream.NewBlockRef(links[id], parentNum))
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if nums[ids[i]] != nums[ids[j]] {
+			return nums[ids[i]] < nums[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+
+	// parents being below their children, following them cannot loop
+	roots := make(map[string]string, len(links)) // block ID to the root it leads to
+	for _, id := range ids {
+		cur := id
+		for {
+			if root, found := roots[cur]; found {
+				cur = root
+				break
+			}
+			parent, found := links[cur]
+			if !found {
+				break
+			}
+			cur = parent
+		}
+		roots[id] = cur
+	}
+
+	libRoot, found := roots[libRef.ID()]
+	if !found {
+		libRoot = libRef.ID()
+	}
+
+	for _, id := range ids {
+		if roots[id] != libRoot && nums[id] <= libRef.Num() {
+			return fmt.Errorf("%w: block %s does not link to the root %q of LIB %s", ErrInvalidForkDB, bstream.NewBlockRef(id, nums[id]), libRoot, libRef)
+		}
+	}
+
+	// a LIB set from a reference is not a block, its children link to it
+	_, libFound := links[libRef.ID()]
+	for _, parent := range links {
+		if libFound {
+			break
+		}
+		libFound = parent == libRef.ID()
+	}
+	if !libFound {
+		return fmt.Errorf("%w: LIB %s is not in the forkdb", ErrInvalidForkDB, libRef)
+	}
 	return nil
 }
 
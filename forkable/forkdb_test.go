@@ -19,6 +19,7 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"github.com/streamingfast/bstream"
+	pbforkable "github.com/streamingfast/bstream/forkable/internal/pb/sf/bstream/forkable/v1"
 	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -316,6 +317,110 @@ func TestChainSwitchSegments(t *testing.T) {
 	}
 }
 
+func TestDeserialize_Invalid(t *testing.T) {
+	lib := &pbbstream.BlockRef{Id: "00000002a", Num: 2}
+	serialized := func(links map[string]string, nums map[string]uint64, libRef *pbbstream.BlockRef) []byte {
+		data, err := proto.Marshal(&pbforkable.ForkDB{Links: links, Nums: nums, LibRef: libRef})
+		require.NoError(t, err)
+		return data
+	}
+	valid := serialized(
+		map[string]string{"00000002a": "00000001a", "00000003a": "00000002a", "00000003b": "00000002a", "00000006a": "00000005a"},
+		map[string]uint64{"00000002a": 2, "00000003a": 3, "00000003b": 3, "00000006a": 6},
+		lib,
+	)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		expectError string
+	}{
+		{
+			name:        "truncated",
+			data:        valid[:len(valid)-3],
+			expectError: "unmarshal",
+		},
+		{
+			name:        "no lib",
+			data:        serialized(map[string]string{"00000002a": "00000001a"}, map[string]uint64{"00000002a": 2}, nil),
+			expectError: "1 blocks but no LIB",
+		},
+		{
+			name:        "missing number",
+			data:        serialized(map[string]string{"00000002a": "00000001a", "00000003a": "00000002a"}, map[string]uint64{"00000002a": 2}, lib),
+			expectError: `block "00000003a" has no number`,
+		},
+		{
+			name:        "parent not below",
+			data:        serialized(map[string]string{"00000002a": "00000001a", "00000003a": "00000002a"}, map[string]uint64{"00000002a": 2, "00000003a": 2}, lib),
+			expectError: "block #2 (00000003a) has parent #2 (00000002a) which is not below it",
+		},
+		{
+			name: "second root below lib",
+			data: serialized(
+				map[string]string{"00000002a": "00000001a", "00000003a": "00000002a", "00000002z": "00000001z"},
+				map[string]uint64{"00000002a": 2, "00000003a": 3, "00000002z": 2},
+				lib,
+			),
+			expectError: `block #2 (00000002z) does not link to the root "00000001a" of LIB #2 (00000002a)`,
+		},
+		{
+			name: "lib not present",
+			data: serialized(
+				map[string]string{"00000004a": "00000003a"},
+				map[string]uint64{"00000004a": 4},
+				lib,
+			),
+			expectError: "LIB #2 (00000002a) is not in the forkdb",
+		},
+		{
+			name: "only blocks above lib from another chain",
+			data: serialized(
+				map[string]string{"00000003z": "00000002z"},
+				map[string]uint64{"00000003z": 3},
+				lib,
+			),
+			expectError: "LIB #2 (00000002a) is not in the forkdb",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fdb := NewForkDB()
+			fdb.InitLIB(bRef("00000001a"))
+
+			err := fdb.Deserialize(test.data, nil)
+			require.Error(t, err)
+			assert.ErrorIs(t, err, ErrInvalidForkDB)
+			assert.Contains(t, err.Error(), test.expectError)
+			assert.Equal(t, "00000001a", fdb.LIBID(), "left untouched")
+		})
+	}
+
+	t.Run("valid with lib set from a reference", func(t *testing.T) {
+		fdb := NewForkDB()
+		require.NoError(t, fdb.Deserialize(serialized(
+			map[string]string{"00000003a": "00000002a", "00000004a": "00000003a"},
+			map[string]uint64{"00000003a": 3, "00000004a": 4},
+			lib,
+		), nil))
+		assert.Equal(t, "00000002a", fdb.LIBID())
+	})
+
+	t.Run("valid with pending blocks above lib", func(t *testing.T) {
+		fdb := NewForkDB()
+		require.NoError(t, fdb.Deserialize(valid, nil))
+		assert.Equal(t, "00000002a", fdb.LIBID())
+		assert.Len(t, fdb.links, 4)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		fdb := NewForkDB()
+		require.NoError(t, fdb.Deserialize(nil, nil))
+		fdb.AddLink(bRef("00000002a"), "00000001a", nil)
+	})
+}
+
 func TestSerializeDeserialize(t *testing.T) {
 
 	tests := []struct {
@@ -416,6 +521,33 @@ func TestBlockForID(t *testing.T) {
 	assert.Nil(t, f.BlockForID("ffffffffa"))
 }
 
+func TestBlockForIDPrefix(t *testing.T) {
+	f := NewForkDB()
+	f.InitLIB(bRef("00000001a"))
+
+	f.AddLink(bRef("00000001a"), "", "1a")
+	f.AddLink(bRef("00000002a"), "00000001a", "2a")
+	f.AddLink(bRef("00000002b"), "00000001a", "2b")
+
+	blk, found, err := f.BlockForIDPrefix("00000002b")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, f.BlockForID("00000002b"), blk)
+
+	blk, found, err = f.BlockForIDPrefix("0000000")
+	assert.EqualError(t, err, `ambiguous block ID prefix "0000000", matches 3 blocks: 00000001a, 00000002a, 00000002b`)
+	assert.False(t, found)
+	assert.Nil(t, blk)
+
+	blk, found, err = f.BlockForIDPrefix("ffff")
+	require.NoError(t, err)
+	assert.False(t, found)
+	assert.Nil(t, blk)
+
+	_, _, err = f.BlockForIDPrefix("")
+	assert.Error(t, err)
+}
+
 func TestBlockInCurrentChain(t *testing.T) {
 	f := NewForkDB()
 	f.InitLIB(bRef("00000001a"))
@@ -494,6 +626,168 @@ func TestBlockInCurrentChainNoLib(t *testing.T) {
 	}
 }
 
+func TestIsOnLongestChain(t *testing.T) {
+	f := NewForkDB()
+	f.InitLIB(bRef("00000001a"))
+
+	f.AddLink(bRef("00000002a"), "00000001a", nil)
+	f.AddLink(bRef("00000003a"), "00000002a", nil)
+	f.AddLink(bRef("00000003b"), "00000002a", nil)
+	f.AddLink(bRef("00000004b"), "00000003b", nil)
+	f.AddLink(bRef("00000006x"), "00000005x", nil) // unlinkable
+
+	tests := []struct {
+		id       string
+		expected bool
+	}{
+		{"00000001a", true},
+		{"00000002a", true},
+		{"00000003b", true},
+		{"00000004b", true},
+		{"00000003a", false},
+		{"00000006x", false},
+		{"00000009z", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.id, func(t *testing.T) {
+			assert.Equal(t, test.expected, f.IsOnLongestChain(test.id))
+		})
+	}
+}
+
+func TestForkDB_HeadBlock(t *testing.T) {
+	tests := []struct {
+		name       string
+		lib        bstream.BlockRef
+		links      [][2]string
+		expectedOk bool
+		expected   string
+	}{
+		{
+			name:       "empty",
+			expectedOk: false,
+		},
+		{
+			name:       "only lib",
+			lib:        bRef("00000001a"),
+			expectedOk: true,
+			expected:   "00000001a",
+		},
+		{
+			name:       "single chain",
+			lib:        bRef("00000001a"),
+			links:      [][2]string{{"00000002a", "00000001a"}, {"00000003a", "00000002a"}},
+			expectedOk: true,
+			expected:   "00000003a",
+		},
+		{
+			name:       "equal length forks, lowest ID wins",
+			lib:        bRef("00000001a"),
+			links:      [][2]string{{"00000002b", "00000001a"}, {"00000003b", "00000002b"}, {"00000002a", "00000001a"}, {"00000003a", "00000002a"}},
+			expectedOk: true,
+			expected:   "00000003a",
+		},
+		{
+			name:       "equal length forks, other insertion order",
+			lib:        bRef("00000001a"),
+			links:      [][2]string{{"00000002a", "00000001a"}, {"00000003a", "00000002a"}, {"00000002b", "00000001a"}, {"00000003b", "00000002b"}},
+			expectedOk: true,
+			expected:   "00000003a",
+		},
+		{
+			name:       "unlinkable higher block ignored",
+			lib:        bRef("00000001a"),
+			links:      [][2]string{{"00000002a", "00000001a"}, {"00000006x", "00000005x"}},
+			expectedOk: true,
+			expected:   "00000002a",
+		},
+		{
+			name:       "no lib",
+			links:      [][2]string{{"00000002b", "00000001a"}, {"00000002a", "00000001a"}},
+			expectedOk: true,
+			expected:   "00000002a",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := NewForkDB()
+			if test.lib != nil {
+				f.InitLIB(test.lib)
+			}
+			for _, link := range test.links {
+				f.AddLink(bRef(link[0]), link[1], nil)
+			}
+
+			for i := 0; i < 10; i++ {
+				head, ok := f.HeadBlock()
+				require.Equal(t, test.expectedOk, ok)
+				if test.expectedOk {
+					assert.Equal(t, test.expected, head.ID())
+				}
+			}
+		})
+	}
+}
+
+func TestForkDB_AllBlockRefs(t *testing.T) {
+	f := NewForkDB()
+	assert.Empty(t, f.AllBlockRefs())
+
+	f.InitLIB(bRef("00000001a"))
+	f.AddLink(bRef("00000003b"), "00000002a", nil)
+	f.AddLink(bRef("00000002a"), "00000001a", nil)
+	f.AddLink(bRef("00000004a"), "00000003a", nil)
+	f.AddLink(bRef("00000003a"), "00000002a", nil)
+
+	assert.Equal(t, []bstream.BlockRef{
+		bRef("00000002a"),
+		bRef("00000003a"),
+		bRef("00000003b"),
+		bRef("00000004a"),
+	}, f.AllBlockRefs())
+}
+
+func TestCommonAncestor(t *testing.T) {
+	f := NewForkDB()
+	f.InitLIB(bRef("00000001a"))
+
+	f.AddLink(bRef("00000002a"), "00000001a", nil)
+	f.AddLink(bRef("00000003a"), "00000002a", nil)
+	f.AddLink(bRef("00000004a"), "00000003a", nil)
+	f.AddLink(bRef("00000003b"), "00000002a", nil)
+	f.AddLink(bRef("00000004b"), "00000003b", nil)
+	f.AddLink(bRef("00000002c"), "00000001a", nil)
+	f.AddLink(bRef("00000006x"), "00000005x", nil) // unlinkable
+
+	tests := []struct {
+		name          string
+		idA           string
+		idB           string
+		expectID      string
+		expectSuccess bool
+	}{
+		{"fork", "00000004a", "00000004b", "00000002a", true},
+		{"fork reversed", "00000004b", "00000004a", "00000002a", true},
+		{"fork at LIB", "00000004a", "00000002c", "00000001a", true},
+		{"ancestor", "00000004a", "00000002a", "00000002a", true},
+		{"same block", "00000003b", "00000003b", "00000003b", true},
+		{"lib", "00000001a", "00000004b", "00000001a", true},
+		{"unlinkable", "00000004a", "00000006x", "", false},
+		{"unknown", "00000004a", "00000009z", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, ok := f.CommonAncestor(test.idA, test.idB)
+			assert.Equal(t, test.expectSuccess, ok)
+			assert.Equal(t, test.expectID, id)
+		})
+	}
+}
+
 func TestMoveLIB(t *testing.T) {
 	fdb := NewForkDB()
 	fdb.InitLIB(bRef("00000001a"))
@@ -0,0 +1,81 @@
+package forkable
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"go.uber.org/zap"
+)
+
+// headCache keeps the last head returned by a head getter. The getter can
+// block for up to its timeout, so it is called by `refresh` before the
+// forkable is locked, the logic running under the lock only reads the
+// cached head. A nil headCache never has a head.
+type headCache struct {
+	getter bstream.BlockRefGetter
+	margin uint64 // the head is fetched again once a block is within margin of it
+	logger *zap.Logger
+
+	lock    sync.Mutex
+	head    bstream.BlockRef // nil until fetched
+	stopped bool
+}
+
+func newHeadCache(getter bstream.BlockRefGetter, margin uint64, logger *zap.Logger) *headCache {
+	if getter == nil {
+		return nil
+	}
+	return &headCache{
+		getter: getter,
+		margin: margin,
+		logger: logger,
+	}
+}
+
+// refresh fetches the head on the first call, then again each time `num`
+// gets within the margin of it, to follow it while it moves. On error, the
+// previous head is kept.
+func (c *headCache) refresh(num uint64) {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.stopped || (c.head != nil && num+c.margin < c.head.Num()) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	head, err := c.getter(ctx)
+	cancel()
+	if err != nil {
+		c.logger.Debug("cannot get head, keeping the previous one", zap.Stringer("previous", c.head), zap.Error(err))
+		return
+	}
+	c.head = head
+}
+
+// get returns the last head fetched, nil when none was.
+func (c *headCache) get() bstream.BlockRef {
+	if c == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.head
+}
+
+// stop makes `refresh` a no-op, once the head is not needed anymore.
+func (c *headCache) stop() {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stopped = true
+}
@@ -0,0 +1,43 @@
+package forkable
+
+import (
+	"github.com/streamingfast/bstream"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"go.uber.org/zap"
+)
+
+// headGate sits between the forkable and its handler, see `WithGateUntilHead`.
+type headGate struct {
+	handler bstream.Handler
+	target  bstream.BlockRef
+	logger  *zap.Logger
+
+	opened        bool
+	openedAtBlock uint64
+}
+
+func newHeadGate(h bstream.Handler, target bstream.BlockRef, logger *zap.Logger) *headGate {
+	return &headGate{
+		handler: h,
+		target:  target,
+		logger:  logger,
+	}
+}
+
+func (g *headGate) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
+	if !g.opened {
+		fobj, ok := obj.(*ForkableObject)
+		if !ok || fobj.step != bstream.StepNew || blk.Number < g.target.Num() {
+			return nil
+		}
+
+		g.logger.Info("head reached gate target, opening", zap.Stringer("target", g.target), zap.Stringer("block", blk.AsRef()))
+		g.opened = true
+		g.openedAtBlock = blk.Number
+	}
+
+	if blk.Number < g.openedAtBlock {
+		return nil
+	}
+	return g.handler.ProcessBlock(blk, obj)
+}
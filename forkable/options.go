@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/streamingfast/bstream"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
 	"go.uber.org/zap"
 )
 
@@ -29,6 +30,14 @@ func WithLogger(logger *zap.Logger) Option {
 	}
 }
 
+// WithTracer covers the fork logic of each processed block with a
+// "forkable.process_block" span, nothing is traced when not set.
+func WithTracer(tracer bstream.Tracer) Option {
+	return func(f *Forkable) {
+		f.spanTracer = tracer
+	}
+}
+
 func WithWarnOnUnlinkableBlocks(count int) Option {
 	return func(f *Forkable) {
 		f.warnOnUnlinkableBlocksCount = count
@@ -42,6 +51,27 @@ func WithFailOnUnlinkableBlocks(count int, gracePeriod time.Duration) Option {
 	}
 }
 
+// WithMaxPendingBlocks caps the number of pending blocks, those kept in the
+// ForkDB without linking to LIB while waiting for their parent, so a source
+// streaming a segment disjoint from the head cannot grow memory unbounded.
+// Past `n`, the oldest pending blocks are dropped, a warning is logged: a
+// dropped block is missing if its descendants link later on. See
+// WithStrictMaxPendingBlocks to fail instead.
+func WithMaxPendingBlocks(n int) Option {
+	return func(f *Forkable) {
+		f.maxPendingBlocks = n
+	}
+}
+
+// WithStrictMaxPendingBlocks makes ProcessBlock return an error instead of
+// dropping the oldest pending blocks when there are more than allowed by
+// WithMaxPendingBlocks.
+func WithStrictMaxPendingBlocks() Option {
+	return func(f *Forkable) {
+		f.rejectMaxPendingBlocks = true
+	}
+}
+
 func WithInclusiveLIB(irreversibleBlock bstream.BlockRef) Option {
 	return func(f *Forkable) {
 		f.includeInitialLIB = true
@@ -56,6 +86,108 @@ func WithExclusiveLIB(irreversibleBlock bstream.BlockRef) Option {
 	}
 }
 
+// WithStatsLiveThreshold sets the distance, in blocks, from the head under
+// which the steps emitted for a block received are counted as live rather
+// than catchup in `Stats`. The head is returned by `headGetter`, fetched
+// before the forkable is locked on the first block, then again on every block
+// within `threshold` of it. When `headGetter` is nil, or fails before
+// returning a head, the head of the longest chain of the forkable is used:
+// only the blocks received behind it, like late forks, count as catchup.
+// Defaults to DefaultStatsLiveThreshold with no head getter.
+func WithStatsLiveThreshold(threshold uint64, headGetter bstream.BlockRefGetter) Option {
+	return func(f *Forkable) {
+		f.statsLiveThreshold = threshold
+		f.statsHeadGetter = headGetter
+	}
+}
+
+// WithRedoBatchLimit sends at most `n` redo steps per ProcessBlock call. When
+// a chain switch back to a long, previously undone, branch has more redos,
+// the rest are sent by the next calls, `n` at a time, smoothing the latency
+// spike of the switch. The new blocks of the switch, and the blocks received
+// in the meantime, are processed only once all the redos were sent, so the
+// order of the steps is unchanged, only delayed.
+func WithRedoBatchLimit(n int) Option {
+	return func(f *Forkable) {
+		if n > 0 {
+			f.redoBatchLimit = n
+		}
+	}
+}
+
+// WithStickyHead prefers the chain of `previousHead`, the head before a
+// restart, among forks of equal length: a block matching or descending from
+// it switches the chain to it when it reaches the height of the head sent,
+// instead of being ignored because it arrived second. A longer fork still
+// always wins. This avoids a spurious reorg for consumers when the forks are
+// received in a different order than before the restart. The preference is
+// dropped once the LIB reaches `previousHead`.
+//
+// Without it, the first received fork wins at equal length, not the lowest ID
+// one as in `ForkDB.HeadBlock`. CallWithCanonicalBlocks and BlockIDs use the
+// fork followed by the Forkable, so they agree with the blocks sent.
+func WithStickyHead(previousHead bstream.BlockRef) Option {
+	return func(f *Forkable) {
+		if !bstream.IsEmpty(previousHead) {
+			f.stickyHead = previousHead
+		}
+	}
+}
+
+// WithFirstStreamableAsIrreversible sends the first streamable block of the
+// chain as StepNew then StepIrreversible, exactly once, whatever the LIB
+// initialization: without it, an exclusive LIB on that block (ex: from a
+// cursor) never sends it while an inclusive or no initial LIB does.
+func WithFirstStreamableAsIrreversible() Option {
+	return func(f *Forkable) {
+		f.firstStreamableAsIrreversible = true
+	}
+}
+
+// WithLIBFetcher sets the function used to get the LIB block when the LIB
+// was set from a reference, with WithInclusiveLIB or WithExclusiveLIB (ex:
+// from a cursor LIB), and its block is not the first one received. It is
+// fetched on the first block above LIB and added to the ForkDB, so operations
+// resolving blocks down to LIB, like resuming from a cursor, find it. With
+// WithInclusiveLIB, it is also sent before that first block.
+func WithLIBFetcher(fetcher func(ref bstream.BlockRef) (*pbbstream.Block, error)) Option {
+	return func(f *Forkable) {
+		f.libFetcher = fetcher
+	}
+}
+
+// WithLiveMarker calls `onLive` once, with the first block sent as New that
+// reaches the live head returned by `headGetter`, marking the transition from
+// catching up to live blocks. The head is fetched on the first block, then
+// again each time it is reached, to follow it while it moves during the
+// catch up, before the Forkable is locked. `onLive` is called while the
+// Forkable is locked.
+func WithLiveMarker(headGetter bstream.BlockRefGetter, onLive func(at bstream.BlockRef)) Option {
+	return func(f *Forkable) {
+		f.liveHeadGetter = headGetter
+		f.onLive = onLive
+	}
+}
+
+// WithClock sets the clock of the wall clock based logic: the unlinkable
+// blocks grace period and the finality latency observation. Defaults to `bstream.RealClock`.
+func WithClock(clock bstream.Clock) Option {
+	return func(f *Forkable) {
+		f.clock = clock
+	}
+}
+
+// WithOrphanedSubtreeObserver calls `f` once per fork orphaned by a LIB move:
+// the fork `root`, a sibling of a block that became irreversible, and all its
+// `blocks`, root first, ordered by block number. The blocks of the irreversible
+// range are also sent as StepStalled, `f` gives the structure of what was
+// discarded, including the descendants above the new LIB.
+func WithOrphanedSubtreeObserver(f func(root bstream.BlockRef, blocks []bstream.BlockRef)) Option {
+	return func(fk *Forkable) {
+		fk.orphanedSubtreeObserver = f
+	}
+}
+
 // WithFilters choses the steps we want to pass through the sub handler. It defaults to StepsAll upon creation.
 func WithFilters(steps bstream.StepType) Option {
 	return func(f *Forkable) {
@@ -69,12 +201,202 @@ func HoldBlocksUntilLIB() Option {
 	}
 }
 
+// HoldBlocksUntilDepth only sends a block as New once `depth` descendant
+// blocks are present on the longest chain, a lightweight confirmation model
+// for chains without explicit finality. Emitted cursors use the deepest
+// confirmed block as head block, they stay resumable.
+func HoldBlocksUntilDepth(depth uint64) Option {
+	return func(f *Forkable) {
+		f.holdBlocksUntilDepth = depth
+	}
+}
+
 func WithKeptFinalBlocks(count int) Option {
 	return func(f *Forkable) {
 		f.keptFinalBlocks = count
 	}
 }
 
+// WithKeptFinalBlocksDuration keeps the final blocks whose time is within `d`
+// of the head block time, pruning older ones, so the retained window is the
+// same whatever the block production rate. Block timestamps are considered
+// unreliable when the head block or one of the final blocks has no valid
+// timestamp, or when a final block is more recent than the head: the count
+// set by `WithKeptFinalBlocks` is then used instead (none if not set).
+func WithKeptFinalBlocksDuration(d time.Duration) Option {
+	return func(f *Forkable) {
+		f.keptFinalBlocksDuration = d
+	}
+}
+
+// WithLIBUpdateHandler calls `f` with the new LIB every time it moves, after
+// the irreversible blocks up to it were sent. It is a notification for
+// consumers only tracking LIB progression, StepIrreversible blocks are still
+// delivered to the handler as usual (unless filtered out).
+func WithLIBUpdateHandler(f func(lib bstream.BlockRef)) Option {
+	return func(fk *Forkable) {
+		fk.libUpdateHandler = f
+	}
+}
+
+// WithBelowLIBHandler calls `f` with every block received below LIB once
+// streaming started, those are otherwise silently dropped. They often point
+// to an upstream replay issue.
+func WithBelowLIBHandler(f func(blk *pbbstream.Block)) Option {
+	return func(fk *Forkable) {
+		fk.belowLIBHandler = f
+	}
+}
+
+// WithRejectBelowLIB makes ProcessBlock return an error on blocks received
+// below LIB once streaming started, instead of silently dropping them.
+func WithRejectBelowLIB() Option {
+	return func(f *Forkable) {
+		f.rejectBelowLIB = true
+	}
+}
+
+// WithGateUntilHead suppresses every step until the forkable's head reaches
+// the height of `target`, the gate then opens on the first block sent as New
+// at or above that height. From there on, only steps of blocks at or above the
+// gate block are sent, so a consumer never receives an Undo or Irreversible
+// for a block it never saw as New. Cursors are computed as if no gate was
+// set, they can be used to resume as usual. Only the target number is
+// considered, a fork of the target at that height opens the gate too.
+func WithGateUntilHead(target bstream.BlockRef) Option {
+	return func(f *Forkable) {
+		f.gateUntilHead = target
+	}
+}
+
+// WithFinalityLatencyObserver calls `f` for each block becoming irreversible
+// with the wall-clock times at which it was first sent as New and at which it
+// became irreversible, to measure finality latency. The first-seen time lives
+// with the block in the ForkDB, so it goes away when the block is purged.
+// Blocks that were never sent as New are not reported.
+func WithFinalityLatencyObserver(f func(blk bstream.BlockRef, seen, finalized time.Time)) Option {
+	return func(fk *Forkable) {
+		fk.finalityLatencyObserver = f
+	}
+}
+
+// WithMaxSkipDistance makes ProcessBlock return an error when a block linking
+// to a known block is more than `n` block numbers ahead of the current head,
+// catching a buggy source injecting a block from the far future before it
+// becomes the head. Chains skipping block numbers are accepted as long as the
+// gap stays within `n`. Disabled when 0, the default.
+func WithMaxSkipDistance(n uint64) Option {
+	return func(f *Forkable) {
+		f.maxSkipDistance = n
+	}
+}
+
+// WithSequentialUndoDelivery sends each undone block as its own StepUndo with
+// `StepCount` 1, in strict reverse order of the New steps, and only for blocks
+// that were actually sent as New. A consumer maintaining a reducible state
+// can then apply undos one by one without looking at `StepIndex` and
+// `StepBlocks`. The trade-off is one more callback per undone block with no
+// view of the whole undone segment, so a consumer cannot revert a reorg in a
+// single operation.
+func WithSequentialUndoDelivery() Option {
+	return func(f *Forkable) {
+		f.sequentialUndoDelivery = true
+	}
+}
+
+// WithExpectedChainTag makes ProcessBlock return an error on any block whose
+// tag, as returned by `extract` (a chain or network ID read from the
+// payload for example), is not `tag`. This catches a misconfigured source
+// feeding blocks of another network at the first foreign block, instead of
+// linking them into bizarre reorgs. Disabled by default.
+func WithExpectedChainTag(tag string, extract func(blk *pbbstream.Block) string) Option {
+	return func(f *Forkable) {
+		f.expectedChainTag = tag
+		f.chainTagExtractor = extract
+	}
+}
+
+// WithCoalescedCatchupIrreversible defers the LIB moves while catching up, so
+// irreversible blocks are sent in segments of at least `batchSize` blocks
+// instead of one at a time, reducing the per-block overhead when LIB advances
+// on nearly every block. The forkable is catching up while the block being
+// processed is more than `threshold` blocks below the head returned by
+// `headGetter`. The head is fetched on the first block, then again each time
+// it is approached to follow it while it moves, before the forkable is locked. Once a block is within
+// `threshold` of it, the LIB moves are applied immediately for good, flushing
+// any deferred segment.
+//
+// While deferred, the LIB in cursors and the final blocks kept in memory lag
+// behind by up to `batchSize` blocks. The deferred segment is flushed when the
+// handler stops the stream with `bstream.ErrStopBlockReached`, call
+// `FlushCoalescedIrreversible` when the source completes otherwise. Disabled
+// when `batchSize` is 0, the default.
+func WithCoalescedCatchupIrreversible(batchSize uint64, headGetter bstream.BlockRefGetter, threshold uint64) Option {
+	return func(f *Forkable) {
+		f.coalescedIrreversibleBatchSize = batchSize
+		f.coalescedIrreversibleHeadGetter = headGetter
+		f.coalescedIrreversibleThreshold = threshold
+	}
+}
+
+// WithPreconfirmationHandler calls `f` with every block added to the ForkDB
+// that is not sent as New right away: a block of a shorter fork, a block that
+// cannot be linked yet or a block held by HoldBlocksUntilLIB or
+// HoldBlocksUntilDepth. Latency-sensitive consumers can act on these
+// likely-but-not-certain blocks while still honoring the authoritative steps
+// sent later. A preconfirmed block may never be sent as New, and if it is, it
+// can still be undone like any other block.
+func WithPreconfirmationHandler(f func(blk *pbbstream.Block)) Option {
+	return func(p *Forkable) {
+		p.preconfirmationHandler = f
+	}
+}
+
+// WithLibNumMonotonicityCheck calls `onRegression` with every block whose
+// LibNum is lower than the one of its parent: a chain LIB never moves back, so
+// this points to a bug in the LibNum extraction of the chain. Blocks whose
+// parent is not in the ForkDB are not checked. Observational only, see
+// WithStrictLibNumMonotonicity to reject those blocks.
+func WithLibNumMonotonicityCheck(onRegression func(blk bstream.BlockRef, prevLib, newLib uint64)) Option {
+	return func(p *Forkable) {
+		p.libNumRegressionHandler = onRegression
+	}
+}
+
+// WithStrictLibNumMonotonicity makes ProcessBlock return an error on blocks
+// whose LibNum is lower than the one of their parent, instead of accepting
+// them.
+func WithStrictLibNumMonotonicity() Option {
+	return func(p *Forkable) {
+		p.rejectLibNumRegression = true
+	}
+}
+
+// WithFlushIrreversibleOnComplete sends the blocks above the LIB as
+// irreversible when a bounded stream completes, so batch consumers end with a
+// fully finalized view: once the handler returns `bstream.ErrStopBlockReached`
+// on a New block, the chain up to that block is sent as StepIrreversible
+// before the error is returned. Only meant for bounded streams: those blocks
+// are not truly irreversible, the chain may still reorg them, and the cursors
+// sent with them look final, resuming from one of them skips the undos.
+func WithFlushIrreversibleOnComplete() Option {
+	return func(p *Forkable) {
+		p.flushIrreversibleOnComplete = true
+	}
+}
+
+// WithBlockedIDs is an operator override for security response: the blocks
+// with these IDs are known bad, ProcessBlock drops them without adding them to
+// the ForkDB nor sending them, so the stream can only follow another fork.
+// Their descendants never link and are never sent either. Use BlockIDs to
+// block IDs on a running Forkable, which also switches away from a blocked
+// head.
+func WithBlockedIDs(ids []string) Option {
+	return func(p *Forkable) {
+		p.addBlockedIDs(ids)
+	}
+}
+
 func EnsureBlockFlows(blockRef bstream.BlockRef) Option {
 	return func(f *Forkable) {
 		f.ensureBlockFlows = blockRef
@@ -0,0 +1,96 @@
+package forkable
+
+import (
+	"github.com/streamingfast/bstream"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+)
+
+// DefaultStatsLiveThreshold is the distance, in blocks, from the head under
+// which an emitted step is counted as live in the Forkable stats, see
+// `WithStatsLiveThreshold`.
+const DefaultStatsLiveThreshold = 10
+
+// StepCounts holds the number of steps emitted by a Forkable, per step type.
+type StepCounts struct {
+	New          uint64
+	Undo         uint64
+	Irreversible uint64
+	Stalled      uint64
+}
+
+func (c StepCounts) add(other StepCounts) StepCounts {
+	return StepCounts{
+		New:          c.New + other.New,
+		Undo:         c.Undo + other.Undo,
+		Irreversible: c.Irreversible + other.Irreversible,
+		Stalled:      c.Stalled + other.Stalled,
+	}
+}
+
+// Stats are the steps emitted by a Forkable, split between the catchup phase,
+// while it processes blocks further than the live threshold from the head,
+// and the live phase. Steps are classified by the block received: an irreversible step
+// emitted when a live block moves the LIB is a live one. The reorg rate at
+// the live edge is `Live.Undo` against `Live.New`, undiluted by the replay of
+// historical blocks.
+type Stats struct {
+	Catchup StepCounts
+	Live    StepCounts
+}
+
+// Total returns the step counts of both phases.
+func (s Stats) Total() StepCounts {
+	return s.Catchup.add(s.Live)
+}
+
+// Stats returns the number of steps emitted so far.
+func (p *Forkable) Stats() Stats {
+	p.RLock()
+	defer p.RUnlock()
+	return p.stats.stats
+}
+
+// statsRecorder sits between the forkable and its handler, counting the
+// steps going through. It is called under the forkable lock.
+type statsRecorder struct {
+	handler bstream.Handler
+	// head is nil when no head getter was set, chainHead is then used
+	head      *headCache
+	chainHead func() uint64
+	// the forkable is live when processing a block within liveThreshold blocks of the head
+	liveThreshold uint64
+	live          bool
+
+	stats Stats
+}
+
+// observe classifies the steps emitted while processing `blk`, the block
+// received by the forkable, as live or catchup from its distance to the head.
+func (r *statsRecorder) observe(blk *pbbstream.Block) {
+	headNum := r.chainHead()
+	if head := r.head.get(); head != nil {
+		headNum = head.Num()
+	}
+	r.live = blk.Number+r.liveThreshold >= headNum
+}
+
+func (r *statsRecorder) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
+	if fobj, ok := obj.(*ForkableObject); ok {
+		counts := &r.stats.Catchup
+		if r.live {
+			counts = &r.stats.Live
+		}
+
+		switch fobj.step {
+		case bstream.StepNew:
+			counts.New++
+		case bstream.StepUndo:
+			counts.Undo++
+		case bstream.StepIrreversible:
+			counts.Irreversible++
+		case bstream.StepStalled:
+			counts.Stalled++
+		}
+	}
+	return r.handler.ProcessBlock(blk, obj)
+}
@@ -0,0 +1,89 @@
+package forkable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+)
+
+// NewFromStore creates a Forkable and feeds it the blocks of the merged
+// blocks files of `store`, starting at `fromBlock` and up to the last
+// available bundle, so it is warm and ready to process live blocks. The
+// blocks go through `handler` like any other block, `opts` are the options
+// of `New`.
+//
+// It returns the context error if `ctx` is cancelled while loading. The head
+// and LIB reached are logged, `HeadInfo` returns them.
+func NewFromStore(ctx context.Context, store dstore.Store, fromBlock uint64, handler bstream.Handler, opts ...Option) (*Forkable, error) {
+	f := New(handler, opts...)
+
+	bundleSize := bstream.GetMergedBlocksBundleSize
+	for base := fromBlock - fromBlock%bundleSize; ; base += bundleSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		filename := bstream.MergedFileNameForBlock(base)
+		exists, err := store.FileExists(ctx, filename)
+		if err != nil {
+			return nil, fmt.Errorf("checking merged blocks file %q: %w", filename, err)
+		}
+		if !exists {
+			break
+		}
+
+		if err := f.loadMergedFile(ctx, store, filename, fromBlock); err != nil {
+			return nil, err
+		}
+	}
+
+	if headNum, headID, _, libNum, err := f.HeadInfo(); err == nil {
+		f.logger.Info("forkable loaded from store",
+			zap.Uint64("from_block", fromBlock),
+			zap.Stringer("head", bstream.NewBlockRef(headID, headNum)),
+			zap.Uint64("lib_num", libNum),
+		)
+	} else {
+		f.logger.Info("forkable loaded from store, no block sent", zap.Uint64("from_block", fromBlock))
+	}
+	return f, nil
+}
+
+func (p *Forkable) loadMergedFile(ctx context.Context, store dstore.Store, filename string, fromBlock uint64) error {
+	reader, err := store.OpenObject(ctx, filename)
+	if err != nil {
+		return fmt.Errorf("opening merged blocks file %q: %w", filename, err)
+	}
+	defer reader.Close()
+
+	blockReader, err := bstream.NewDBinBlockReader(reader)
+	if err != nil {
+		return fmt.Errorf("reading merged blocks file %q: %w", filename, err)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		blk, err := blockReader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading merged blocks file %q: %w", filename, err)
+		}
+
+		if blk.Number < fromBlock {
+			continue
+		}
+		if err := p.ProcessBlock(blk, nil); err != nil {
+			return fmt.Errorf("processing block %s: %w", blk.AsRef(), err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package forkable
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mergedFile(t *testing.T, blocks ...*pbbstream.Block) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	writer, err := bstream.NewDBinBlockWriter(buf)
+	require.NoError(t, err)
+	for _, blk := range blocks {
+		require.NoError(t, writer.Write(blk))
+	}
+	return buf.Bytes()
+}
+
+func TestNewFromStore(t *testing.T) {
+	store := dstore.NewMockStore(nil)
+	var bundle []*pbbstream.Block
+	for i := uint64(1); i <= 250; i++ {
+		bundle = append(bundle, bstream.TestBlockWithLIBNum(fmt.Sprintf("%08xa", i), fmt.Sprintf("%08xa", i-1), i-1))
+		if i%100 == 99 || i == 250 {
+			store.SetFile(bstream.MergedFileNameForBlock(i), mergedFile(t, bundle...))
+			bundle = nil
+		}
+	}
+
+	sink := newTestForkableSink(nil, nil)
+	f, err := NewFromStore(context.Background(), store, 150, sink, WithExclusiveLIB(bRef("00000095a")))
+	require.NoError(t, err)
+
+	headNum, headID, _, libNum, err := f.HeadInfo()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(250), headNum)
+	assert.Equal(t, "000000faa", headID)
+	assert.Equal(t, uint64(249), libNum)
+	assert.Equal(t, "00000096a", sink.results[0].block.ID())
+
+	sent := len(sink.results)
+	require.NoError(t, f.ProcessBlock(bstream.TestBlockWithLIBNum("000000fba", "000000faa", 250), nil))
+	require.Greater(t, len(sink.results), sent)
+	assert.Equal(t, bstream.StepNew, sink.results[sent].step)
+	assert.Equal(t, "000000fba", sink.results[sent].block.ID())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewFromStore(ctx, store, 150, sink)
+	assert.ErrorIs(t, err, context.Canceled)
+}
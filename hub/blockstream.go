@@ -32,7 +32,7 @@ type BlockstreamServer struct {
 }
 
 func (s *BlockstreamServer) Launch(serverAddr string) {
-	<-s.hub.Ready
+	<-s.hub.Initialized()
 	zlog.Info("blockstream server hub ready, launching", zap.String("server_addr", serverAddr))
 	go s.dgrpcServer.Launch(serverAddr)
 }
@@ -0,0 +1,137 @@
+package hub
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/streamingfast/bstream"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"go.uber.org/zap"
+)
+
+// ErrCursorUnavailable is returned by `Broadcaster.Attach` when the hub
+// cannot serve the cursor, the client must catch up from another source.
+var ErrCursorUnavailable = errors.New("cursor not available in hub")
+
+// Broadcaster fans the blocks of the hub out to many clients, typically the
+// gRPC streams of a firehose server, without running a source per client:
+// every client is a subscription of the hub single forkable. Each attached
+// client receives the blocks from its cursor forward, from the hub segment
+// first, then live ones as the hub gets them.
+//
+// Slow clients follow the disconnect policy of the hub: a client whose channel
+// is full is detached and its channel closed, it must attach again from its
+// last cursor.
+type Broadcaster struct {
+	hub      *ForkableHub
+	chanSize int
+
+	lock    sync.Mutex
+	clients map[<-chan *bstream.PreprocessedBlock]*broadcastClient
+}
+
+type broadcastClient struct {
+	source bstream.Source
+
+	lock   sync.Mutex
+	blocks chan *bstream.PreprocessedBlock
+	closed bool
+}
+
+func (h *ForkableHub) NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		hub:      h,
+		chanSize: h.sourceChannelSize,
+		clients:  make(map[<-chan *bstream.PreprocessedBlock]*broadcastClient),
+	}
+}
+
+// Attach starts sending the blocks after `cursor` to the returned channel,
+// which is closed when the client is detached, either by `Detach`, because it
+// was too slow, or because the hub terminated.
+func (b *Broadcaster) Attach(cursor *bstream.Cursor) (<-chan *bstream.PreprocessedBlock, error) {
+	client := &broadcastClient{
+		blocks: make(chan *bstream.PreprocessedBlock, b.chanSize),
+	}
+
+	source := b.hub.SourceFromCursor(cursor, bstream.HandlerFunc(client.push))
+	if source == nil {
+		return nil, fmt.Errorf("attaching from cursor %s: %w", cursor, ErrCursorUnavailable)
+	}
+	client.source = source
+
+	b.lock.Lock()
+	b.clients[client.blocks] = client
+	b.lock.Unlock()
+
+	detached := func(err error) {
+		if err != nil {
+			zlog.Debug("broadcast client detached", zap.Error(err))
+		}
+		client.close()
+
+		b.lock.Lock()
+		delete(b.clients, client.blocks)
+		b.lock.Unlock()
+	}
+	source.OnTerminated(detached)
+	if source.IsTerminating() { // the hub may have dropped it before the callback was registered
+		detached(source.Err())
+		return client.blocks, nil
+	}
+	go source.Run()
+
+	return client.blocks, nil
+}
+
+// Detach stops sending blocks to the channel of a client, then closes it.
+// Detaching an unknown or already detached channel is a no-op.
+func (b *Broadcaster) Detach(blocks <-chan *bstream.PreprocessedBlock) {
+	b.lock.Lock()
+	client, found := b.clients[blocks]
+	b.lock.Unlock()
+	if !found {
+		return
+	}
+
+	client.source.Shutdown(nil)
+	if sub, ok := client.source.(*Subscription); ok {
+		b.hub.forkable.Lock()
+		b.hub.unsubscribe(sub)
+		b.hub.forkable.Unlock()
+	}
+}
+
+// Clients returns the number of attached clients
+func (b *Broadcaster) Clients() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.clients)
+}
+
+func (c *broadcastClient) push(blk *pbbstream.Block, obj interface{}) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return fmt.Errorf("client detached")
+	}
+
+	select {
+	case c.blocks <- &bstream.PreprocessedBlock{Block: blk, Obj: obj}:
+		return nil
+	default:
+		return fmt.Errorf("client channel at max capacity")
+	}
+}
+
+func (c *broadcastClient) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.blocks)
+	}
+}
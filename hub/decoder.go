@@ -0,0 +1,97 @@
+package hub
+
+import (
+	"sync"
+
+	"github.com/streamingfast/bstream"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+)
+
+// orderedDecoder decodes blocks on up to `concurrency` goroutines and passes
+// them to the next handler in their arrival order. ProcessBlock returns as
+// soon as the block is queued, call wait once the source is done sending
+// blocks to get them all through and the first error.
+type orderedDecoder struct {
+	decode bstream.PreprocessFunc
+	next   bstream.Handler
+
+	pending chan chan decodedBlock
+	done    chan struct{}
+
+	errLock sync.Mutex
+	err     error
+}
+
+type decodedBlock struct {
+	blk *pbbstream.Block
+	obj interface{}
+	err error
+}
+
+func newOrderedDecoder(decode bstream.PreprocessFunc, concurrency int, next bstream.Handler) *orderedDecoder {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	d := &orderedDecoder{
+		decode:  decode,
+		next:    next,
+		pending: make(chan chan decodedBlock, concurrency),
+		done:    make(chan struct{}),
+	}
+	go d.deliver()
+	return d
+}
+
+func (d *orderedDecoder) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
+	if err := d.failure(); err != nil {
+		return err
+	}
+
+	out := make(chan decodedBlock, 1)
+	d.pending <- out
+
+	go func() {
+		res := decodedBlock{blk: blk}
+		res.err = bstream.NewPreprocessor(d.decode, bstream.HandlerFunc(func(_ *pbbstream.Block, decodedObj interface{}) error {
+			res.obj = decodedObj
+			return nil
+		})).ProcessBlock(blk, obj)
+		out <- res
+	}()
+	return nil
+}
+
+func (d *orderedDecoder) deliver() {
+	defer close(d.done)
+
+	for out := range d.pending {
+		res := <-out
+		if d.failure() != nil {
+			continue // draining
+		}
+
+		err := res.err
+		if err == nil {
+			err = d.next.ProcessBlock(res.blk, res.obj)
+		}
+		if err != nil {
+			d.errLock.Lock()
+			d.err = err
+			d.errLock.Unlock()
+		}
+	}
+}
+
+func (d *orderedDecoder) wait() error {
+	close(d.pending)
+	<-d.done
+	return d.failure()
+}
+
+func (d *orderedDecoder) failure() error {
+	d.errLock.Lock()
+	defer d.errLock.Unlock()
+
+	return d.err
+}
@@ -0,0 +1,115 @@
+package hub
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderedDecoder(t *testing.T) {
+	var received []string
+	decoder := newOrderedDecoder(func(blk *pbbstream.Block) (interface{}, error) {
+		time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+		return "decoded " + blk.Id, nil
+	}, 4, bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		received = append(received, obj.(string))
+		return nil
+	}))
+
+	var expected []string
+	for i := uint64(1); i <= 50; i++ {
+		id := fmt.Sprintf("%08xa", i)
+		expected = append(expected, "decoded "+id)
+		require.NoError(t, decoder.ProcessBlock(bstream.TestBlock(id, fmt.Sprintf("%08xa", i-1)), nil))
+	}
+
+	require.NoError(t, decoder.wait())
+	assert.Equal(t, expected, received)
+}
+
+func TestOrderedDecoder_Error(t *testing.T) {
+	var received []string
+	decoder := newOrderedDecoder(func(blk *pbbstream.Block) (interface{}, error) {
+		if blk.Number == 3 {
+			return nil, fmt.Errorf("cannot decode")
+		}
+		return blk.Id, nil
+	}, 2, bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		received = append(received, obj.(string))
+		return nil
+	}))
+
+	for i := uint64(1); i <= 5; i++ {
+		decoder.ProcessBlock(bstream.TestBlock(fmt.Sprintf("%08xa", i), fmt.Sprintf("%08xa", i-1)), nil)
+	}
+
+	err := decoder.wait()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot decode")
+	assert.Equal(t, []string{"00000001a", "00000002a"}, received)
+}
+
+func TestForkableHub_WithDecodeConcurrency(t *testing.T) {
+	lsf := bstream.NewTestSourceFactory()
+	obsf := bstream.NewTestSourceFactory()
+	fh := NewForkableHubWithOptions(lsf.NewSource, bstream.SourceFromNumFactory(obsf.SourceFromBlockNum), 0,
+		WithDecodeConcurrency(func(blk *pbbstream.Block) (interface{}, error) {
+			time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+			return "decoded " + blk.Id, nil
+		}, 4),
+	)
+
+	go fh.Run()
+	ls := <-lsf.Created
+
+	go func() {
+		obs := <-obsf.Created
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000003", "00000002", 2), nil))
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000004", "00000003", 3), nil))
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000005", "00000004", 3), nil))
+		obs.Shutdown(io.EOF)
+	}()
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000006", "00000005", 3), nil))
+	require.True(t, fh.IsReady())
+
+	var objs []interface{}
+	require.NoError(t, fh.forkable.CallWithBlocksFromNum(3, func(blocks []*bstream.PreprocessedBlock) {
+		for _, blk := range blocks {
+			objs = append(objs, blk.Obj.(bstream.ObjectWrapper).WrappedObject())
+		}
+	}, false))
+	assert.Equal(t, []interface{}{"decoded 00000003", "decoded 00000004", "decoded 00000005", "decoded 00000006"}, objs)
+}
+
+func BenchmarkOrderedDecoder(b *testing.B) {
+	decode := func(blk *pbbstream.Block) (interface{}, error) {
+		time.Sleep(100 * time.Microsecond) // expensive decoding
+		return blk.Id, nil
+	}
+
+	blocks := make([]*pbbstream.Block, 1000)
+	for i := range blocks {
+		blocks[i] = bstream.TestBlock(fmt.Sprintf("%08xa", i+1), fmt.Sprintf("%08xa", i))
+	}
+
+	for _, concurrency := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency_%d", concurrency), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				decoder := newOrderedDecoder(decode, concurrency, bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+					return nil
+				}))
+				for _, blk := range blocks {
+					decoder.ProcessBlock(blk, nil)
+				}
+				require.NoError(b, decoder.wait())
+			}
+		})
+	}
+}
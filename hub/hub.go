@@ -15,8 +15,10 @@
 package hub
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/streamingfast/bstream"
@@ -40,15 +42,40 @@ type ForkableHub struct {
 	subscribers       []*Subscription
 	sourceChannelSize int
 
-	ready bool
-	Ready chan struct{}
+	ready            bool
+	Ready            chan struct{}
+	bootstrapTimeout time.Duration
+
+	oneBlockProcessedCallback func(blk *pbbstream.Block, filename string)
+
+	decodeFunc        bstream.PreprocessFunc
+	decodeConcurrency int
+
+	resumePrunedCursors   bool
+	signalPrunedCursorGap bool
+
+	headChangeLock      sync.Mutex
+	headChangeCallbacks []func(head, lib bstream.BlockRef)
+	lastHeadID          string
+
+	liveSourceLock    sync.Mutex
+	liveSourceFactory bstream.SourceFactory
+	liveSource        bstream.Source
+	swapLock          sync.Mutex
 
-	liveSourceFactory                  bstream.SourceFactory
 	oneBlocksSourceFactory             bstream.SourceFromNumFactory
 	oneBlocksSourceFactoryWithSkipFunc bstream.SourceFromNumFactoryWithSkipFunc
+
+	forkableOptions []forkable.Option // passed to forkable.New, after the ones the hub always sets
 }
 
 func NewForkableHub(liveSourceFactory bstream.SourceFactory, oneBlocksSourceFactory interface{}, keepFinalBlocks int, extraForkableOptions ...forkable.Option) *ForkableHub {
+	return NewForkableHubWithOptions(liveSourceFactory, oneBlocksSourceFactory, keepFinalBlocks, WithForkableOptions(extraForkableOptions...))
+}
+
+// NewForkableHubWithOptions is NewForkableHub taking hub options, forkable
+// options are passed with WithForkableOptions.
+func NewForkableHubWithOptions(liveSourceFactory bstream.SourceFactory, oneBlocksSourceFactory interface{}, keepFinalBlocks int, opts ...Option) *ForkableHub {
 	hub := &ForkableHub{
 		Shutter:           shutter.New(),
 		liveSourceFactory: liveSourceFactory,
@@ -66,14 +93,14 @@ func NewForkableHub(liveSourceFactory bstream.SourceFactory, oneBlocksSourceFact
 		panic("invalid oneBlocksSourceFactory interface")
 	}
 
-	hub.forkable = forkable.New(bstream.HandlerFunc(hub.processBlock),
+	for _, opt := range opts {
+		opt(hub)
+	}
+
+	hub.forkable = forkable.New(bstream.HandlerFunc(hub.processBlock), append([]forkable.Option{
 		forkable.HoldBlocksUntilLIB(),
 		forkable.WithKeptFinalBlocks(keepFinalBlocks),
-	)
-
-	for _, opt := range extraForkableOptions {
-		opt(hub.forkable)
-	}
+	}, hub.forkableOptions...)...)
 
 	hub.OnTerminating(func(err error) {
 		for _, sub := range hub.subscribers {
@@ -124,6 +151,28 @@ func (h *ForkableHub) HeadNum() uint64 {
 	}
 	return 0
 }
+
+// BlocksBehind returns how many blocks the position of cursor `c` is behind
+// the hub head, zero when on the head. The position is the cursor block, or
+// its parent for an undo cursor since that block was undone. It returns false
+// when the hub is not ready, the cursor is empty or ahead of the head.
+func (h *ForkableHub) BlocksBehind(c *bstream.Cursor) (uint64, bool) {
+	if h == nil || !h.ready || c.IsEmpty() {
+		return 0, false
+	}
+
+	position := c.Block.Num()
+	if c.Step.Matches(bstream.StepUndo) && position > 0 {
+		position--
+	}
+
+	headNum := h.forkable.HeadNum()
+	if position > headNum {
+		return 0, false
+	}
+	return headNum - position, true
+}
+
 func (h *ForkableHub) MatchSuffix(req string) bool {
 	ids := h.forkable.AllIDs()
 	for _, id := range ids {
@@ -138,11 +187,53 @@ func (h *ForkableHub) IsReady() bool {
 	return h.ready
 }
 
+// Initialized returns a channel that is closed once the hub has bootstrapped
+// and its forkDB is linked all the way to LIB. Use it to block until the hub
+// is ready to serve sources instead of polling `IsReady()`.
+func (h *ForkableHub) Initialized() <-chan struct{} {
+	return h.Ready
+}
+
+// OnHeadChange registers `f` to be called every time the head of the hub's
+// longest chain changes, either advancing or switching to another fork. It is
+// called once the new head block itself was sent to the subscribers, never for
+// blocks that are buffered without being part of the longest chain. Callbacks
+// are called synchronously while processing blocks and must return quickly.
+func (h *ForkableHub) OnHeadChange(f func(head, lib bstream.BlockRef)) {
+	h.headChangeLock.Lock()
+	defer h.headChangeLock.Unlock()
+
+	h.headChangeCallbacks = append(h.headChangeCallbacks, f)
+}
+
+func (h *ForkableHub) notifyHeadChange(blk *pbbstream.Block, fobj *forkable.ForkableObject) {
+	if !fobj.Step().Matches(bstream.StepNew) {
+		return
+	}
+
+	cursor := fobj.Cursor()
+	if blk.Id != cursor.HeadBlock.ID() {
+		return
+	}
+
+	h.headChangeLock.Lock()
+	defer h.headChangeLock.Unlock()
+
+	if blk.Id == h.lastHeadID {
+		return
+	}
+	h.lastHeadID = blk.Id
+
+	for _, f := range h.headChangeCallbacks {
+		f(cursor.HeadBlock, cursor.LIB)
+	}
+}
+
 func (h *ForkableHub) bootstrapperHandler(blk *pbbstream.Block, obj interface{}) error {
 	if h.ready {
 		return h.forkable.ProcessBlock(blk, obj)
 	}
-	return h.bootstrap(blk)
+	return h.bootstrap(blk, obj)
 }
 
 // subscribe must be called while hub is locked
@@ -205,6 +296,10 @@ func (h *ForkableHub) SourceFromCursor(cursor *bstream.Cursor, handler bstream.H
 	err := h.forkable.CallWithBlocksFromCursor(cursor, func(blocks []*bstream.PreprocessedBlock) { // Running callback func while forkable is locked
 		out = h.subscribe(handler, blocks)
 	})
+	if err != nil && h.resumePrunedCursors && h.forkable.GetBlockByHash(cursor.Block.ID()) == nil {
+		zlog.Debug("cursor block not found, resuming from cursor LIB", zap.Stringer("cursor", cursor), zap.Error(err))
+		return h.sourceFromPrunedCursor(cursor, handler)
+	}
 	if err != nil {
 		zlog.Debug("error getting source_from_cursor", zap.Error(err))
 		return nil
@@ -212,6 +307,135 @@ func (h *ForkableHub) SourceFromCursor(cursor *bstream.Cursor, handler bstream.H
 	return
 }
 
+// PrunedCursorGap is the object of the first block sent from a cursor whose
+// block was pruned, when the hub was created with `WithPrunedCursorResume`
+// and `signalGap`. It acts as the ForkableObject it wraps, the blocks the
+// client received after `PrunedCursor.LIB` may not be on the chain sent.
+type PrunedCursorGap struct {
+	*forkable.ForkableObject
+
+	PrunedCursor *bstream.Cursor
+}
+
+func (h *ForkableHub) sourceFromPrunedCursor(cursor *bstream.Cursor, handler bstream.Handler) (out bstream.Source) {
+	libCursor := &bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     cursor.LIB,
+		HeadBlock: cursor.LIB,
+		LIB:       cursor.LIB,
+	}
+
+	err := h.forkable.CallWithBlocksFromCursor(libCursor, func(blocks []*bstream.PreprocessedBlock) { // Running callback func while forkable is locked
+		if h.signalPrunedCursorGap && len(blocks) != 0 {
+			if fobj, ok := blocks[0].Obj.(*forkable.ForkableObject); ok {
+				blocks[0] = &bstream.PreprocessedBlock{
+					Block: blocks[0].Block,
+					Obj:   &PrunedCursorGap{ForkableObject: fobj, PrunedCursor: cursor},
+				}
+			}
+		}
+		out = h.subscribe(handler, blocks)
+	})
+	if err != nil {
+		zlog.Debug("error getting source_from_cursor from cursor LIB", zap.Error(err))
+		return nil
+	}
+	return
+}
+
+// SourceFromCursorUntilTime is SourceFromCursor stopping at the first block
+// whose timestamp is after `t`: that block is not sent and the source shuts
+// down with `bstream.ErrStopTimeReached`. With a `t` in the future, the source
+// sends the blocks of the hub then the live ones until one is after `t`.
+//
+// Timestamps are not assumed monotonic: the source stops at the first block
+// after `t`, whatever its step, even if following blocks are before `t`. A
+// block with an invalid timestamp stops it too.
+func (h *ForkableHub) SourceFromCursorUntilTime(handler bstream.Handler, cursor *bstream.Cursor, t time.Time) bstream.Source {
+	return h.SourceFromCursor(cursor, bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		if blk.Timestamp.CheckValid() != nil || blk.Timestamp.AsTime().After(t) {
+			return bstream.ErrStopTimeReached
+		}
+		return handler.ProcessBlock(blk, obj)
+	}))
+}
+
+// ErrCursorAheadOfHub is the error of a source from `SourceFromCursorWaiting`
+// when the hub head did not reach the cursor head block in time.
+var ErrCursorAheadOfHub = errors.New("cursor ahead of hub")
+
+// cursorWaitPollInterval is how often a source from `SourceFromCursorWaiting`
+// checks whether the hub caught up with its cursor
+var cursorWaitPollInterval = 50 * time.Millisecond
+
+// SourceFromCursorWaiting is SourceFromCursor for a cursor whose head block
+// may be ahead of the hub, like a client coming from another provider that is
+// a few blocks further. Instead of failing right away, the returned source
+// waits, when run, for the hub head to reach the cursor head block number,
+// then serves the cursor as SourceFromCursor does.
+//
+// The source shuts down with `ErrCursorAheadOfHub` if the hub head did not
+// reach the cursor head within `maxWait`, or with an error if the hub reached
+// it but still cannot serve the cursor, its block being on an unknown fork for
+// example. It returns nil only on a nil hub.
+func (h *ForkableHub) SourceFromCursorWaiting(handler bstream.Handler, cursor *bstream.Cursor, maxWait time.Duration) bstream.Source {
+	if h == nil {
+		return nil
+	}
+
+	return &cursorWaitingSource{
+		Shutter: shutter.New(),
+		hub:     h,
+		handler: handler,
+		cursor:  cursor,
+		maxWait: maxWait,
+	}
+}
+
+type cursorWaitingSource struct {
+	*shutter.Shutter
+
+	hub     *ForkableHub
+	handler bstream.Handler
+	cursor  *bstream.Cursor
+	maxWait time.Duration
+}
+
+func (s *cursorWaitingSource) Run() {
+	s.Shutdown(s.run())
+}
+
+func (s *cursorWaitingSource) run() error {
+	deadline := time.NewTimer(s.maxWait)
+	defer deadline.Stop()
+	ticker := time.NewTicker(cursorWaitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if source := s.hub.SourceFromCursor(s.cursor, s.handler); source != nil {
+			s.OnTerminating(source.Shutdown)
+			if s.IsTerminating() {
+				source.Shutdown(nil)
+				return nil
+			}
+			source.Run()
+			return source.Err()
+		}
+
+		if s.hub.HeadNum() >= s.cursor.HeadBlock.Num() {
+			return fmt.Errorf("hub head reached cursor %s but cannot serve it", s.cursor)
+		}
+
+		select {
+		case <-s.Terminating():
+			return nil
+		case <-deadline.C:
+			return fmt.Errorf("waiting %s for hub head to reach cursor %s: %w", s.maxWait, s.cursor, ErrCursorAheadOfHub)
+		case <-ticker.C:
+		}
+	}
+}
+
 func (h *ForkableHub) SourceThroughCursor(startBlock uint64, cursor *bstream.Cursor, handler bstream.Handler) (out bstream.Source) {
 	if h == nil {
 		return nil
@@ -232,44 +456,78 @@ func (h *ForkableHub) SourceThroughCursor(startBlock uint64, cursor *bstream.Cur
 	return
 }
 
-func (h *ForkableHub) bootstrap(blk *pbbstream.Block) error {
+// ReplayCanonical sends the blocks of the longest chain of the hub, from LIB
+// to head, to `handler` as StepNew, each block once, and returns. Fork blocks
+// are ignored. It rebuilds a downstream from the current hub state without
+// waiting for live blocks, the handler is called outside of the hub lock.
+func (h *ForkableHub) ReplayCanonical(handler bstream.Handler) error {
+	var blocks []*bstream.PreprocessedBlock
+	if err := h.forkable.CallWithCanonicalBlocks(func(blks []*bstream.PreprocessedBlock) {
+		blocks = blks
+	}); err != nil {
+		return fmt.Errorf("getting canonical chain: %w", err)
+	}
+
+	for _, ppBlk := range blocks {
+		if err := handler.ProcessBlock(ppBlk.Block, ppBlk.Obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *ForkableHub) bootstrap(blk *pbbstream.Block, obj interface{}) error {
 	zlog.Info("bootstrapping ForkableHub", zap.Stringer("blk", blk.AsRef()))
 
 	// don't try bootstrapping from one-block-files if we are not at HEAD
 	if blk.Number < h.forkable.HeadNum() {
 		zlog.Info("skip bootstrapping ForkableHub from one-block-files", zap.Stringer("blk", blk.AsRef()), zap.Uint64("forkdb_head_num", h.forkable.HeadNum()))
-		return h.forkable.ProcessBlock(blk, nil)
+		return h.forkable.ProcessBlock(blk, obj)
 	}
 
 	if !h.forkable.Linkable(blk) {
 		startBlock := substractAndRoundDownBlocks(blk.LibNum, uint64(h.keepFinalBlocks))
 		zlog.Info("bootstrapping on un-linkable block", zap.Uint64("start_block", startBlock), zap.Stringer("head_block", blk.AsRef()))
 
+		oneBlocksHandler := h.oneBlocksHandler()
+		var decoder *orderedDecoder
+		if h.decodeFunc != nil {
+			decoder = newOrderedDecoder(h.decodeFunc, h.decodeConcurrency, oneBlocksHandler)
+			oneBlocksHandler = decoder
+		}
+
 		var oneBlocksSource bstream.Source
 		if h.oneBlocksSourceFactoryWithSkipFunc != nil {
 			skipFunc := func(idSuffix string) bool {
 				return h.MatchSuffix(idSuffix)
 			}
-			oneBlocksSource = h.oneBlocksSourceFactoryWithSkipFunc(startBlock, h.forkable, skipFunc)
+			oneBlocksSource = h.oneBlocksSourceFactoryWithSkipFunc(startBlock, oneBlocksHandler, skipFunc)
 		} else {
-			oneBlocksSource = h.oneBlocksSourceFactory(startBlock, h.forkable)
+			oneBlocksSource = h.oneBlocksSourceFactory(startBlock, oneBlocksHandler)
 		}
 
 		if oneBlocksSource == nil {
 			zlog.Debug("no oneBlocksSource from factory, not bootstrapping hub yet")
+			if decoder != nil {
+				decoder.wait()
+			}
 			return nil
 		}
 		zlog.Info("bootstrapping ForkableHub from one-block-files", zap.Uint64("start_block", startBlock), zap.Stringer("head_block", blk.AsRef()))
 		go oneBlocksSource.Run()
 		select {
 		case <-oneBlocksSource.Terminating():
-			break
+			if decoder != nil {
+				if err := decoder.wait(); err != nil {
+					return fmt.Errorf("decoding one-block files: %w", err)
+				}
+			}
 		case <-h.Terminating():
 			return h.Err()
 		}
 	}
 
-	if err := h.forkable.ProcessBlock(blk, nil); err != nil {
+	if err := h.forkable.ProcessBlock(blk, obj); err != nil {
 		return err
 	}
 
@@ -289,12 +547,114 @@ func (h *ForkableHub) bootstrap(blk *pbbstream.Block) error {
 	return nil
 }
 
+// oneBlocksHandler returns the handler receiving the one-block files blocks,
+// calling the oneBlockProcessedCallback after the forkable linked them.
+func (h *ForkableHub) oneBlocksHandler() bstream.Handler {
+	if h.oneBlockProcessedCallback == nil {
+		return h.forkable
+	}
+
+	return bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		if err := h.forkable.ProcessBlock(blk, obj); err != nil {
+			return err
+		}
+		if h.forkable.GetBlockByHash(blk.Id) == nil {
+			return nil
+		}
+
+		filenames, _ := bstream.AttachmentsFromObject(obj)[bstream.OneBlockFilenamesAttachment].([]string)
+		for _, filename := range filenames {
+			h.oneBlockProcessedCallback(blk, filename)
+		}
+		return nil
+	})
+}
+
+// decodingHandler decodes the live blocks before passing them to `handler`
+// when WithDecodeConcurrency is set.
+func (h *ForkableHub) decodingHandler(handler bstream.Handler) bstream.Handler {
+	if h.decodeFunc == nil {
+		return handler
+	}
+	return bstream.NewPreprocessor(h.decodeFunc, handler)
+}
+
 func (h *ForkableHub) Run() {
-	liveSource := h.liveSourceFactory(bstream.HandlerFunc(h.bootstrapperHandler))
-	liveSource.OnTerminating(h.reconnect)
+	if h.bootstrapTimeout > 0 {
+		go h.enforceBootstrapTimeout(h.bootstrapTimeout)
+	}
+
+	h.liveSourceLock.Lock()
+	liveSource := h.liveSourceFactory(h.decodingHandler(bstream.HandlerFunc(h.bootstrapperHandler)))
+	h.liveSource = liveSource
+	h.liveSourceLock.Unlock()
+
+	liveSource.OnTerminating(func(err error) {
+		if h.isLiveSource(liveSource) {
+			h.reconnect(err)
+		}
+	})
 	liveSource.Run()
 }
 
+// ErrLiveSourceSwapped is the error the live source is shut down with when
+// replaced by `SwapLiveSource`.
+var ErrLiveSourceSwapped = errors.New("live source swapped")
+
+// SwapLiveSource replaces the live source of a running hub by one created
+// from `factory`, to change the upstream block provider without restarting
+// and bootstrapping the hub again. The current live source is shut down
+// with ErrLiveSourceSwapped, then the new one is started and handled like
+// after a disconnection: its blocks already in the forkdb are dropped, so
+// none is sent twice, and it must link to the hub head within a minute,
+// otherwise the hub shuts down. The factory is also used by the later
+// reconnections.
+func (h *ForkableHub) SwapLiveSource(factory bstream.SourceFactory) error {
+	if !h.ready {
+		return fmt.Errorf("cannot swap live source: hub not ready")
+	}
+	if h.IsTerminating() {
+		return fmt.Errorf("cannot swap live source: hub is terminating")
+	}
+
+	h.swapLock.Lock()
+	defer h.swapLock.Unlock()
+
+	h.liveSourceLock.Lock()
+	previous := h.liveSource
+	h.liveSource = nil
+	h.liveSourceFactory = factory
+	h.liveSourceLock.Unlock()
+
+	if previous != nil {
+		previous.Shutdown(ErrLiveSourceSwapped)
+		<-previous.Terminated()
+	}
+
+	zlog.Info("swapping hub live source", zap.Uint64("head_num", h.forkable.HeadNum()))
+	h.reconnect(ErrLiveSourceSwapped)
+	return nil
+}
+
+func (h *ForkableHub) isLiveSource(src bstream.Source) bool {
+	h.liveSourceLock.Lock()
+	defer h.liveSourceLock.Unlock()
+	return h.liveSource == src
+}
+
+func (h *ForkableHub) enforceBootstrapTimeout(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-h.Ready:
+	case <-h.Terminating():
+	case <-timer.C:
+		zlog.Warn("hub did not become ready in time, shutting down", zap.Duration("bootstrap_timeout", timeout))
+		h.Shutdown(fmt.Errorf("hub not ready after bootstrap timeout of %s: live blocks never linked to one-block-files up to LIB (forkdb head: %d)", timeout, h.forkable.HeadNum()))
+	}
+}
+
 func (h *ForkableHub) reconnect(err error) {
 	failFunc := func() {
 		h.Shutdown(fmt.Errorf("cannot link new blocks to chain after a reconnection"))
@@ -312,8 +672,15 @@ func (h *ForkableHub) reconnect(err error) {
 		zap.Uint64("current_head_block_num", rh.previousHeadBlock),
 		zap.Error(err))
 
-	liveSource := h.liveSourceFactory(rh)
+	h.liveSourceLock.Lock()
+	liveSource := h.liveSourceFactory(h.decodingHandler(rh))
+	h.liveSource = liveSource
+	h.liveSourceLock.Unlock()
+
 	liveSource.OnTerminating(func(err error) {
+		if !h.isLiveSource(liveSource) {
+			return
+		}
 		if rh.success {
 			h.reconnect(err)
 			return
@@ -330,7 +697,7 @@ func substractAndRoundDownBlocks(blknum, sub uint64) uint64 {
 	} else {
 		out = blknum - sub
 	}
-	out = out / 100 * 100
+	out = out / bstream.GetMergedBlocksBundleSize * bstream.GetMergedBlocksBundleSize
 
 	if out < bstream.GetProtocolFirstStreamableBlock {
 		return bstream.GetProtocolFirstStreamableBlock
@@ -353,6 +720,8 @@ func (h *ForkableHub) processBlock(blk *pbbstream.Block, obj interface{}) error
 		}
 
 	}
+
+	h.notifyHeadChange(blk, obj.(*forkable.ForkableObject))
 	return nil
 }
 
@@ -1,8 +1,10 @@
 package hub
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"sync"
 	"testing"
 	"time"
 
@@ -148,6 +150,12 @@ func TestForkableHub_Bootstrap(t *testing.T) {
 				require.NoError(t, ls.Push(blk, nil))
 			}
 			assert.Equal(t, test.expectReadyAfter, fh.ready)
+			select {
+			case <-fh.Initialized():
+				assert.True(t, test.expectReadyAfter, "initialized channel closed but hub is not expected to be ready")
+			default:
+				assert.False(t, test.expectReadyAfter, "initialized channel not closed but hub is expected to be ready")
+			}
 
 			if test.expectBlocksInCurrentChain != nil {
 				var seenBlockNums []uint64
@@ -167,6 +175,306 @@ func TestForkableHub_Bootstrap(t *testing.T) {
 	}
 }
 
+func TestForkableHub_BootstrapTimeout(t *testing.T) {
+	lsf := bstream.NewTestSourceFactory()
+	obsf := bstream.NewTestSourceFactory()
+	fh := NewForkableHubWithOptions(lsf.NewSource, bstream.SourceFromNumFactory(obsf.SourceFromBlockNum), 0,
+		WithBootstrapTimeout(50*time.Millisecond),
+		WithForkableOptions(forkable.WithLogger(zlog)),
+	)
+
+	go fh.Run()
+	ls := <-lsf.Created
+
+	go func() {
+		obs := <-obsf.Created
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000003", "00000002", 2), nil))
+		obs.Shutdown(io.EOF)
+	}()
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000009", "00000008", 3), nil))
+
+	select {
+	case <-fh.Terminated():
+		assert.False(t, fh.IsReady())
+		require.Error(t, fh.Err())
+		assert.Contains(t, fh.Err().Error(), "bootstrap timeout")
+	case <-time.After(time.Second):
+		t.Fatal("hub not shut down after bootstrap timeout")
+	}
+}
+
+func TestForkableHub_BootstrapTimeoutCancelledWhenReady(t *testing.T) {
+	lsf := bstream.NewTestSourceFactory()
+	obsf := bstream.NewTestSourceFactory()
+	fh := NewForkableHubWithOptions(lsf.NewSource, bstream.SourceFromNumFactory(obsf.SourceFromBlockNum), 0, WithBootstrapTimeout(50*time.Millisecond))
+
+	go fh.Run()
+	ls := <-lsf.Created
+
+	go func() {
+		obs := <-obsf.Created
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000003", "00000002", 2), nil))
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000004", "00000003", 3), nil))
+		obs.Shutdown(io.EOF)
+	}()
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000005", "00000004", 3), nil))
+	require.True(t, fh.IsReady())
+
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, fh.IsTerminating())
+}
+
+func TestForkableHub_OnHeadChange(t *testing.T) {
+	lsf := bstream.NewTestSourceFactory()
+	obsf := bstream.NewTestSourceFactory()
+	fh := NewForkableHub(lsf.NewSource, bstream.SourceFromNumFactory(obsf.SourceFromBlockNum), 0)
+
+	var heads []string
+	fh.OnHeadChange(func(head, lib bstream.BlockRef) {
+		heads = append(heads, fmt.Sprintf("%s/%d", head.ID(), lib.Num()))
+	})
+
+	go fh.Run()
+	ls := <-lsf.Created
+
+	go func() {
+		obs := <-obsf.Created
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000003", "00000002", 2), nil))
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000004", "00000003", 3), nil))
+		obs.Shutdown(io.EOF)
+	}()
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000005", "00000004", 3), nil))
+	require.True(t, fh.IsReady())
+
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000006a", "00000005", 3), nil))
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000006b", "00000005", 3), nil)) // not longest chain
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000007b", "00000006b", 4), nil))
+
+	assert.Equal(t, []string{"00000004/3", "00000005/3", "00000006a/3", "00000007b/3"}, heads)
+}
+
+func TestForkableHub_WithForkableOptions(t *testing.T) {
+	lsf := bstream.NewTestSourceFactory()
+	obsf := bstream.NewTestSourceFactory()
+	fh := NewForkableHubWithOptions(lsf.NewSource, bstream.SourceFromNumFactory(obsf.SourceFromBlockNum), 0,
+		WithForkableOptions(
+			forkable.WithGateUntilHead(bstream.NewBlockRefFromID("00000005")),
+			forkable.WithStatsLiveThreshold(1, func(context.Context) (bstream.BlockRef, error) {
+				return bstream.NewBlockRefFromID("00000006"), nil
+			}),
+		),
+	)
+
+	var heads []string
+	fh.OnHeadChange(func(head, lib bstream.BlockRef) {
+		heads = append(heads, head.ID())
+	})
+
+	go fh.Run()
+	ls := <-lsf.Created
+
+	go func() {
+		obs := <-obsf.Created
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000003", "00000002", 2), nil))
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000004", "00000003", 3), nil))
+		obs.Shutdown(io.EOF)
+	}()
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000005", "00000004", 3), nil))
+	require.True(t, fh.IsReady())
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000006", "00000005", 4), nil))
+
+	assert.Equal(t, []string{"00000005", "00000006"}, heads, "blocks below the gate are not sent")
+
+	stats := fh.forkable.Stats()
+	assert.Equal(t, uint64(1), stats.Catchup.New, "stats count the steps before the gate")
+	assert.Equal(t, uint64(2), stats.Live.New)
+}
+
+func TestForkableHub_SwapLiveSource(t *testing.T) {
+	lsf := bstream.NewTestSourceFactory()
+	obsf := bstream.NewTestSourceFactory()
+	fh := NewForkableHub(lsf.NewSource, bstream.SourceFromNumFactory(obsf.SourceFromBlockNum), 0)
+
+	require.Error(t, fh.SwapLiveSource(lsf.NewSource), "hub not ready")
+
+	go fh.Run()
+	ls := <-lsf.Created
+
+	go func() {
+		obs := <-obsf.Created
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000003", "00000002", 2), nil))
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000004", "00000003", 3), nil))
+		obs.Shutdown(io.EOF)
+	}()
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000005", "00000004", 3), nil))
+	require.True(t, fh.IsReady())
+
+	received := make(chan string, 10)
+	source := fh.SourceFromBlockNum(5, bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		if obj.(*forkable.ForkableObject).Step() == bstream.StepNew {
+			received <- blk.Id
+		}
+		return nil
+	}))
+	require.NotNil(t, source)
+	go source.Run()
+
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000006", "00000005", 4), nil))
+
+	otherFactory := bstream.NewTestSourceFactory()
+	require.NoError(t, fh.SwapLiveSource(otherFactory.NewSource))
+	assert.ErrorIs(t, ls.Err(), ErrLiveSourceSwapped)
+
+	other := <-otherFactory.Created
+	require.NoError(t, other.Push(bstream.TestBlockWithLIBNum("00000006", "00000005", 4), nil)) // already received from the previous source
+	require.NoError(t, other.Push(bstream.TestBlockWithLIBNum("00000007", "00000006", 5), nil))
+	require.NoError(t, other.Push(bstream.TestBlockWithLIBNum("00000008", "00000007", 6), nil))
+
+	var got []string
+	for len(got) < 4 {
+		select {
+		case id := <-received:
+			got = append(got, id)
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for blocks, got %v", got)
+		}
+	}
+	assert.Equal(t, []string{"00000005", "00000006", "00000007", "00000008"}, got)
+	assert.Len(t, received, 0)
+	assert.False(t, fh.IsTerminating())
+	assert.Len(t, lsf.Created, 0, "swapped out source must not reconnect")
+}
+
+func TestForkableHub_WithOneBlockProcessedCallback(t *testing.T) {
+	lsf := bstream.NewTestSourceFactory()
+	obsf := bstream.NewTestSourceFactory()
+
+	var processed []string
+	fh := NewForkableHubWithOptions(lsf.NewSource, bstream.SourceFromNumFactory(obsf.SourceFromBlockNum), 0,
+		WithOneBlockProcessedCallback(func(blk *pbbstream.Block, filename string) {
+			processed = append(processed, fmt.Sprintf("%s:%s", blk.Id, filename))
+		}),
+	)
+
+	go fh.Run()
+	ls := <-lsf.Created
+
+	oneBlockObj := func(filenames ...string) interface{} {
+		return bstream.NewAttachedObject(nil, bstream.Attachments{bstream.OneBlockFilenamesAttachment: filenames})
+	}
+	go func() {
+		obs := <-obsf.Created
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000003", "00000002", 2), oneBlockObj("0000000003-3-2-2-a", "0000000003-3-2-2-b")))
+		require.NoError(t, obs.Push(bstream.TestBlockWithLIBNum("00000004", "00000003", 3), oneBlockObj("0000000004-4-3-3-a")))
+		obs.Shutdown(io.EOF)
+	}()
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000005", "00000004", 3), nil))
+	require.True(t, fh.IsReady())
+
+	assert.Equal(t, []string{
+		"00000003:0000000003-3-2-2-a",
+		"00000003:0000000003-3-2-2-b",
+		"00000004:0000000004-4-3-3-a",
+	}, processed)
+}
+
+func TestForkableHub_ReplayCanonical(t *testing.T) {
+	fh := &ForkableHub{
+		Shutter: shutter.New(),
+	}
+	fh.forkable = forkable.New(bstream.HandlerFunc(fh.processBlock),
+		forkable.HoldBlocksUntilLIB(),
+		forkable.WithKeptFinalBlocks(100),
+	)
+	fh.ready = true
+
+	for _, blk := range []*pbbstream.Block{
+		bstream.TestBlockWithLIBNum("00000003a", "00000002a", 2),
+		bstream.TestBlockWithLIBNum("00000004a", "00000003a", 3),
+		bstream.TestBlockWithLIBNum("00000005a", "00000004a", 3),
+		bstream.TestBlockWithLIBNum("00000005b", "00000004b", 3), // not linkable yet
+		bstream.TestBlockWithLIBNum("00000006b", "00000005b", 3),
+		bstream.TestBlockWithLIBNum("00000004b", "00000003a", 3),
+	} {
+		require.NoError(t, fh.forkable.ProcessBlock(blk, nil))
+	}
+
+	var seen []string
+	require.NoError(t, fh.ReplayCanonical(bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		cursor := obj.(*forkable.ForkableObject).Cursor()
+		assert.Equal(t, bstream.StepNew, cursor.Step)
+		assert.Equal(t, "00000006b", cursor.HeadBlock.ID())
+		seen = append(seen, fmt.Sprintf("%s (lib %d)", blk.Id, cursor.LIB.Num()))
+		return nil
+	})))
+
+	assert.Equal(t, []string{
+		"00000003a (lib 3)",
+		"00000004b (lib 3)",
+		"00000005b (lib 3)",
+		"00000006b (lib 3)",
+	}, seen)
+
+	err := fh.ReplayCanonical(bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		return fmt.Errorf("failing")
+	}))
+	assert.EqualError(t, err, "failing")
+}
+
+func TestForkableHub_BlocksBehind(t *testing.T) {
+	fh := &ForkableHub{
+		Shutter: shutter.New(),
+	}
+	fh.forkable = forkable.New(bstream.HandlerFunc(fh.processBlock),
+		forkable.HoldBlocksUntilLIB(),
+		forkable.WithKeptFinalBlocks(100),
+	)
+
+	cursorAt := func(id string, step bstream.StepType) *bstream.Cursor {
+		return &bstream.Cursor{
+			Step:      step,
+			Block:     bstream.NewBlockRefFromID(id),
+			HeadBlock: bstream.NewBlockRefFromID(id),
+			LIB:       bstream.NewBlockRefFromID("00000003"),
+		}
+	}
+
+	_, ok := fh.BlocksBehind(cursorAt("00000004", bstream.StepNew))
+	assert.False(t, ok, "hub not ready")
+
+	fh.ready = true
+	for _, blk := range []*pbbstream.Block{
+		bstream.TestBlockWithLIBNum("00000003", "00000002", 2),
+		bstream.TestBlockWithLIBNum("00000004", "00000003", 3),
+		bstream.TestBlockWithLIBNum("00000005", "00000004", 3),
+		bstream.TestBlockWithLIBNum("00000006", "00000005", 3),
+	} {
+		require.NoError(t, fh.forkable.ProcessBlock(blk, nil))
+	}
+
+	tests := []struct {
+		name           string
+		cursor         *bstream.Cursor
+		expectedBehind uint64
+		expectedOK     bool
+	}{
+		{"behind", cursorAt("00000004", bstream.StepNew), 2, true},
+		{"on head", cursorAt("00000006", bstream.StepNew), 0, true},
+		{"undo", cursorAt("00000006", bstream.StepUndo), 1, true},
+		{"below lib", cursorAt("00000001", bstream.StepIrreversible), 5, true},
+		{"ahead", cursorAt("00000007", bstream.StepNew), 0, false},
+		{"empty", nil, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			behind, ok := fh.BlocksBehind(test.cursor)
+			assert.Equal(t, test.expectedOK, ok)
+			assert.Equal(t, test.expectedBehind, behind)
+		})
+	}
+}
+
 type expectedBlock struct {
 	block        *pbbstream.Block
 	step         bstream.StepType
@@ -584,6 +892,252 @@ func TestForkableHub_SourceFromCursor(t *testing.T) {
 	}
 }
 
+func TestForkableHub_SourceFromPrunedCursor(t *testing.T) {
+	newHub := func(opts ...Option) *ForkableHub {
+		fh := &ForkableHub{
+			Shutter: shutter.New(),
+		}
+		fh.forkable = forkable.New(bstream.HandlerFunc(fh.processBlock),
+			forkable.HoldBlocksUntilLIB(),
+			forkable.WithKeptFinalBlocks(100),
+		)
+		for _, opt := range opts {
+			opt(fh)
+		}
+		fh.ready = true
+
+		for _, blk := range []*pbbstream.Block{
+			bstream.TestBlockWithLIBNum("00000003", "00000002", 2),
+			bstream.TestBlockWithLIBNum("00000004", "00000003", 3),
+			bstream.TestBlockWithLIBNum("00000005", "00000004", 3),
+			bstream.TestBlockWithLIBNum("00000006", "00000005", 3),
+		} {
+			require.NoError(t, fh.forkable.ProcessBlock(blk, nil))
+		}
+		return fh
+	}
+
+	prunedCursor := &bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     bstream.NewBlockRefFromID("00000005b"),
+		HeadBlock: bstream.NewBlockRefFromID("00000005b"),
+		LIB:       bstream.NewBlockRefFromID("00000003"),
+	}
+
+	type seenBlock struct {
+		id    string
+		step  bstream.StepType
+		isGap bool
+	}
+	run := func(t *testing.T, source bstream.Source) {
+		t.Helper()
+		require.NotNil(t, source)
+		go source.Run()
+		select {
+		case <-source.Terminating():
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for blocks")
+		}
+	}
+	collect := func(seen *[]seenBlock, count int) bstream.Handler {
+		return bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			_, isGap := obj.(*PrunedCursorGap)
+			*seen = append(*seen, seenBlock{blk.Id, obj.(bstream.Stepable).Step(), isGap})
+			if len(*seen) == count {
+				return fmt.Errorf("done")
+			}
+			return nil
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		assert.Nil(t, newHub().SourceFromCursor(prunedCursor, bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error { return nil })))
+	})
+
+	t.Run("resumed from LIB with gap signal", func(t *testing.T) {
+		fh := newHub(WithPrunedCursorResume(true))
+		var seen []seenBlock
+		run(t, fh.SourceFromCursor(prunedCursor, collect(&seen, 3)))
+
+		assert.Equal(t, []seenBlock{
+			{"00000004", bstream.StepNew, true},
+			{"00000005", bstream.StepNew, false},
+			{"00000006", bstream.StepNew, false},
+		}, seen)
+	})
+
+	t.Run("resumed from LIB without gap signal", func(t *testing.T) {
+		fh := newHub(WithPrunedCursorResume(false))
+		var seen []seenBlock
+		run(t, fh.SourceFromCursor(prunedCursor, collect(&seen, 3)))
+
+		assert.Equal(t, []seenBlock{
+			{"00000004", bstream.StepNew, false},
+			{"00000005", bstream.StepNew, false},
+			{"00000006", bstream.StepNew, false},
+		}, seen)
+	})
+
+	t.Run("cursor LIB not retained", func(t *testing.T) {
+		cursor := *prunedCursor
+		cursor.LIB = bstream.NewBlockRefFromID("00000001")
+		assert.Nil(t, newHub(WithPrunedCursorResume(true)).SourceFromCursor(&cursor, bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error { return nil })))
+	})
+}
+
+func TestForkableHub_SourceFromCursorUntilTime(t *testing.T) {
+	fh := &ForkableHub{
+		Shutter: shutter.New(),
+	}
+	fh.forkable = forkable.New(bstream.HandlerFunc(fh.processBlock),
+		forkable.HoldBlocksUntilLIB(),
+		forkable.WithKeptFinalBlocks(100),
+	)
+	fh.ready = true
+
+	for _, blk := range []*pbbstream.Block{
+		bstream.TestBlockFromJSON(`{"id":"00000003","prev":"00000002","libnum":2,"time":"2024-01-01T00:00:03"}`),
+		bstream.TestBlockFromJSON(`{"id":"00000004","prev":"00000003","libnum":3,"time":"2024-01-01T00:00:04"}`),
+		bstream.TestBlockFromJSON(`{"id":"00000005","prev":"00000004","libnum":3,"time":"2024-01-01T00:00:05"}`),
+		bstream.TestBlockFromJSON(`{"id":"00000006","prev":"00000005","libnum":3,"time":"2024-01-01T00:00:06"}`),
+		bstream.TestBlockFromJSON(`{"id":"00000007","prev":"00000006","libnum":3,"time":"2024-01-01T00:00:04"}`), // before the stop time, but after a block that is not
+	} {
+		require.NoError(t, fh.forkable.ProcessBlock(blk, nil))
+	}
+
+	cursor := &bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     bstream.NewBlockRefFromID("00000003"),
+		HeadBlock: bstream.NewBlockRefFromID("00000003"),
+		LIB:       bstream.NewBlockRefFromID("00000003"),
+	}
+
+	var seenLock sync.Mutex
+	var seen []string
+	collect := bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		seenLock.Lock()
+		defer seenLock.Unlock()
+		seen = append(seen, blk.Id)
+		return nil
+	})
+	seenIDs := func() []string {
+		seenLock.Lock()
+		defer seenLock.Unlock()
+		return append([]string(nil), seen...)
+	}
+
+	source := fh.SourceFromCursorUntilTime(collect, cursor, time.Date(2024, 1, 1, 0, 0, 5, 0, time.UTC))
+	require.NotNil(t, source)
+	go source.Run()
+	select {
+	case <-source.Terminated():
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for source to stop")
+	}
+	assert.ErrorIs(t, source.Err(), bstream.ErrStopTimeReached)
+	assert.Equal(t, []string{"00000004", "00000005"}, seenIDs())
+
+	seenLock.Lock()
+	seen = nil
+	seenLock.Unlock()
+	source = fh.SourceFromCursorUntilTime(collect, cursor, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NotNil(t, source)
+	go source.Run()
+	require.Eventually(t, func() bool { return len(seenIDs()) == 4 }, time.Second, 5*time.Millisecond)
+	assert.False(t, source.IsTerminating(), "keeps waiting for live blocks")
+	source.Shutdown(nil)
+}
+
+func TestForkableHub_SourceFromCursorWaiting(t *testing.T) {
+	newHub := func() *ForkableHub {
+		fh := &ForkableHub{
+			Shutter:           shutter.New(),
+			sourceChannelSize: 10,
+		}
+		fh.forkable = forkable.New(bstream.HandlerFunc(fh.processBlock),
+			forkable.HoldBlocksUntilLIB(),
+			forkable.WithKeptFinalBlocks(100),
+		)
+		fh.ready = true
+
+		require.NoError(t, fh.forkable.ProcessBlock(bstream.TestBlockWithLIBNum("00000003", "00000002", 2), nil))
+		require.NoError(t, fh.forkable.ProcessBlock(bstream.TestBlockWithLIBNum("00000004", "00000003", 3), nil))
+		return fh
+	}
+
+	cursor := &bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     bstream.NewBlockRefFromID("00000005"),
+		HeadBlock: bstream.NewBlockRefFromID("00000005"),
+		LIB:       bstream.NewBlockRefFromID("00000003"),
+	}
+
+	t.Run("hub catches up", func(t *testing.T) {
+		fh := newHub()
+
+		seen := make(chan string, 10)
+		source := fh.SourceFromCursorWaiting(bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			seen <- blk.Id
+			return nil
+		}), cursor, time.Second)
+		require.NotNil(t, source)
+		go source.Run()
+		defer source.Shutdown(nil)
+
+		time.Sleep(2 * cursorWaitPollInterval)
+		assert.False(t, source.IsTerminating(), "waits for the hub")
+
+		require.NoError(t, fh.forkable.ProcessBlock(bstream.TestBlockWithLIBNum("00000005", "00000004", 3), nil))
+		require.Eventually(t, func() bool { return fh.HeadNum() == 5 }, time.Second, 5*time.Millisecond)
+		time.Sleep(2 * cursorWaitPollInterval) // source subscribed from the cursor
+		require.NoError(t, fh.forkable.ProcessBlock(bstream.TestBlockWithLIBNum("00000006", "00000005", 3), nil))
+
+		select {
+		case id := <-seen:
+			assert.Equal(t, "00000006", id)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for block")
+		}
+		assert.False(t, source.IsTerminating())
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		fh := newHub()
+
+		source := fh.SourceFromCursorWaiting(bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			return nil
+		}), cursor, 100*time.Millisecond)
+		require.NotNil(t, source)
+		go source.Run()
+
+		select {
+		case <-source.Terminated():
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for source to stop")
+		}
+		assert.ErrorIs(t, source.Err(), ErrCursorAheadOfHub)
+	})
+
+	t.Run("head reached on another fork", func(t *testing.T) {
+		fh := newHub()
+		require.NoError(t, fh.forkable.ProcessBlock(bstream.TestBlockFromJSON(`{"id":"00000005b","prev":"00000004","number":5,"libnum":3}`), nil))
+
+		source := fh.SourceFromCursorWaiting(bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			return nil
+		}), cursor, time.Second)
+		require.NotNil(t, source)
+		go source.Run()
+
+		select {
+		case <-source.Terminated():
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for source to stop")
+		}
+		require.Error(t, source.Err())
+		assert.NotErrorIs(t, source.Err(), ErrCursorAheadOfHub)
+	})
+}
+
 func TestForkableHub_SourceThroughCursor(t *testing.T) {
 
 	tests := []struct {
@@ -895,3 +1449,90 @@ func TestForkableHub_SourceThroughCursor(t *testing.T) {
 		})
 	}
 }
+
+func TestForkableHub_Broadcaster(t *testing.T) {
+	fh := &ForkableHub{
+		Shutter:           shutter.New(),
+		sourceChannelSize: 2,
+	}
+	fh.forkable = forkable.New(bstream.HandlerFunc(fh.processBlock),
+		forkable.HoldBlocksUntilLIB(),
+		forkable.WithKeptFinalBlocks(100),
+	)
+	fh.ready = true
+
+	for _, blk := range []*pbbstream.Block{
+		bstream.TestBlockWithLIBNum("00000003", "00000002", 2),
+		bstream.TestBlockWithLIBNum("00000004", "00000003", 3),
+		bstream.TestBlockWithLIBNum("00000005", "00000004", 3),
+	} {
+		require.NoError(t, fh.forkable.ProcessBlock(blk, nil))
+	}
+
+	cursor := &bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     bstream.NewBlockRefFromID("00000004"),
+		HeadBlock: bstream.NewBlockRefFromID("00000004"),
+		LIB:       bstream.NewBlockRefFromID("00000003"),
+	}
+
+	b := fh.NewBroadcaster()
+	_, err := b.Attach(&bstream.Cursor{
+		Step:      bstream.StepNew,
+		Block:     bstream.NewBlockRefFromID("00000009"),
+		HeadBlock: bstream.NewBlockRefFromID("00000009"),
+		LIB:       bstream.NewBlockRefFromID("00000008"),
+	})
+	assert.ErrorIs(t, err, ErrCursorUnavailable)
+
+	fast, err := b.Attach(cursor)
+	require.NoError(t, err)
+	slow, err := b.Attach(cursor)
+	require.NoError(t, err)
+	detached, err := b.Attach(cursor)
+	require.NoError(t, err)
+	assert.Equal(t, 3, b.Clients())
+
+	next := func(ch <-chan *bstream.PreprocessedBlock) string {
+		select {
+		case ppblk, ok := <-ch:
+			if !ok {
+				return "closed"
+			}
+			return ppblk.Block.Id
+		case <-time.After(time.Second):
+			return "timeout"
+		}
+	}
+
+	assert.Equal(t, "00000005", next(fast))
+	b.Detach(detached)
+	id := next(detached)
+	if id == "00000005" { // it may have been sent before it was detached
+		id = next(detached)
+	}
+	assert.Equal(t, "closed", id)
+
+	for _, blk := range []*pbbstream.Block{
+		bstream.TestBlockWithLIBNum("00000006", "00000005", 4),
+		bstream.TestBlockWithLIBNum("00000007", "00000006", 4),
+		bstream.TestBlockWithLIBNum("00000008", "00000007", 4),
+	} {
+		require.NoError(t, fh.forkable.ProcessBlock(blk, nil))
+		if blk.Id == "00000006" {
+			assert.Equal(t, "00000006", next(fast))
+			assert.Equal(t, "00000004", next(fast), "irreversible")
+		} else {
+			assert.Equal(t, blk.Id, next(fast))
+		}
+	}
+
+	// the slow client, never reading, is detached once its channel is full
+	require.Eventually(t, func() bool { return b.Clients() == 1 }, time.Second, 5*time.Millisecond)
+	got := []string{}
+	for id := next(slow); id != "closed"; id = next(slow) {
+		require.NotEqual(t, "timeout", id)
+		got = append(got, id)
+	}
+	assert.Equal(t, []string{"00000005", "00000006"}[:len(got)], got)
+}
@@ -0,0 +1,68 @@
+package hub
+
+import (
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/bstream/forkable"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+)
+
+type Option func(h *ForkableHub)
+
+// WithForkableOptions passes `opts` to the creation of the forkable of the
+// hub, after the ones the hub always sets.
+func WithForkableOptions(opts ...forkable.Option) Option {
+	return func(h *ForkableHub) {
+		h.forkableOptions = append(h.forkableOptions, opts...)
+	}
+}
+
+// WithBootstrapTimeout shuts the hub down with an error if it is not ready
+// within `timeout` after `Run()` is called, instead of waiting forever for a
+// live block linkable to the one-block-files. Disabled when 0.
+func WithBootstrapTimeout(timeout time.Duration) Option {
+	return func(h *ForkableHub) {
+		h.bootstrapTimeout = timeout
+	}
+}
+
+// WithOneBlockProcessedCallback calls `f` for each one-block file consumed
+// while bootstrapping, once its block is linked in the hub's forkable, so an
+// operator can archive or delete the files the hub no longer needs. It is
+// called once per file name when several files hold the same block. Only
+// blocks pushed by the one-blocks source with their file names attached under
+// `bstream.OneBlockFilenamesAttachment` trigger it: create that source with
+// `bstream.OneBlocksSourceWithFilenamesAttachment()`.
+func WithOneBlockProcessedCallback(f func(blk *pbbstream.Block, filename string)) Option {
+	return func(h *ForkableHub) {
+		h.oneBlockProcessedCallback = f
+	}
+}
+
+// WithDecodeConcurrency decodes the blocks with `decode` before they reach
+// the forkable, the result being the object of the blocks sent by the hub.
+// When bootstrapping from one-block files, where decoding is usually the
+// bottleneck, up to `n` blocks are decoded concurrently and fed to the
+// forkable in their original order. Live blocks arrive one at a time and are
+// decoded as they come. A decoding failure fails the bootstrap attempt.
+func WithDecodeConcurrency(decode bstream.PreprocessFunc, n int) Option {
+	return func(h *ForkableHub) {
+		h.decodeFunc = decode
+		h.decodeConcurrency = n
+	}
+}
+
+// WithPrunedCursorResume resumes the sources requested from a cursor whose
+// block is not in the hub anymore, usually a fork block that was pruned, from
+// the cursor LIB instead of failing, as long as that LIB is still in the hub.
+// The blocks following the cursor LIB on the canonical chain are sent as
+// StepNew, but the blocks sent to the client after its LIB cannot be undone:
+// with `signalGap`, the first block sent carries a `*PrunedCursorGap` object
+// so the client can reset its state above its LIB.
+func WithPrunedCursorResume(signalGap bool) Option {
+	return func(h *ForkableHub) {
+		h.resumePrunedCursors = true
+		h.signalPrunedCursorGap = signalGap
+	}
+}
@@ -27,11 +27,31 @@ import (
 
 var stopSourceOnJoin = errors.New("stopping source on join")
 
+type JoiningSourceOption = func(s *JoiningSource)
+
+// JoiningSourceWithHandoffDedupWindow sets how many of the last blocks sent
+// from the file source are remembered at the handoff: the live source blocks
+// with one of those IDs are dropped, up to its first new block. Disabled by
+// default: the handler receives the blocks sent by both sources.
+func JoiningSourceWithHandoffDedupWindow(n int) JoiningSourceOption {
+	return func(s *JoiningSource) {
+		s.handoffDedupWindow = n
+	}
+}
+
 // JoiningSource joins an irreversible-only source (file) to a fork-aware source close to HEAD (live)
 // 1) it tries to get the source from LiveSourceFactory (using startblock or cursor)
 // 2) if it can't, it will ask the FileSourceFactory for a source of those blocks.
 // 3) when it receives blocks from Filesource, it looks at LiveSource
 // the JoiningSource will instantiate and run an 'initialSource' until it can bridge the gap
+//
+// Joining the live source is checked inline, from the file source handler, on every block at or
+// above the lowest block available live: there is no background tracker goroutine, so the join
+// point only depends on the blocks received, which keeps it deterministic in tests.
+//
+// Shutting down the JoiningSource shuts down its sub-sources, `Terminated()` fires once both
+// of them are terminated. It does not wait for their `Run` to return, so it can be done from
+// the handler. `Run` only returns once neither of them is running anymore.
 type JoiningSource struct {
 	*shutter.Shutter
 
@@ -39,6 +59,7 @@ type JoiningSource struct {
 	liveSourceFactory ForkableSourceFactory
 
 	lowestLiveBlockNum uint64
+	fileSource         Source
 	liveSource         Source
 	sourcesLock        sync.Mutex
 
@@ -46,6 +67,10 @@ type JoiningSource struct {
 
 	lastBlockProcessed *pbbstream.Block
 
+	handoffDedupWindow int
+	fileBlockIDs       []string // last IDs sent from the file source, up to handoffDedupWindow
+	handoffDone        bool
+
 	startBlockNum  uint64 // overriden by cursor if it exists, unless we are in cursorIsTarget mode
 	cursor         *Cursor
 	cursorIsTarget bool
@@ -60,7 +85,8 @@ func NewJoiningSource(
 	startBlockNum uint64,
 	cursor *Cursor,
 	cursorIsTarget bool,
-	logger *zap.Logger) *JoiningSource {
+	logger *zap.Logger,
+	opts ...JoiningSourceOption) *JoiningSource {
 	logger.Info("creating new joining source", zap.Stringer("cursor", cursor), zap.Uint64("start_block_num", startBlockNum))
 
 	s := &JoiningSource{
@@ -73,21 +99,75 @@ func NewJoiningSource(
 		cursorIsTarget:    cursorIsTarget,
 		logger:            logger,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.OnTerminating(s.shutdownSubSources)
 
 	return s
 }
 
+// Run returns once the sub-sources are done running, which may be after
+// `Terminated()` fired when the JoiningSource was shut down from outside.
 func (s *JoiningSource) Run() {
 	s.Shutdown(s.run())
 }
 
+// SubSourceErrors returns the error each sub-source shut down with, in the
+// order they were started: the file source, if one was needed, then the live
+// source. The file source error is internal when it was stopped to join the
+// live source. A nil entry is a sub-source still running or that completed
+// without error.
+func (s *JoiningSource) SubSourceErrors() (out []error) {
+	s.sourcesLock.Lock()
+	defer s.sourcesLock.Unlock()
+
+	for _, src := range []Source{s.fileSource, s.liveSource} {
+		if src == nil {
+			continue
+		}
+		out = append(out, src.Err())
+	}
+	return out
+}
+
+// trackSource sets `src` as the file or live sub-source, so it is shut down
+// with the JoiningSource. It returns false, and shuts `src` down, when the
+// JoiningSource is already terminating.
+func (s *JoiningSource) trackSource(field *Source, src Source) bool {
+	s.sourcesLock.Lock()
+	defer s.sourcesLock.Unlock()
+
+	if s.IsTerminating() {
+		src.Shutdown(s.Err())
+		return false
+	}
+	*field = src
+	return true
+}
+
+func (s *JoiningSource) shutdownSubSources(err error) {
+	s.sourcesLock.Lock()
+	subSources := []Source{s.fileSource, s.liveSource}
+	s.sourcesLock.Unlock()
+
+	for _, src := range subSources {
+		if src != nil {
+			src.Shutdown(err)
+			// when the sub-source was already shutting down on its own,
+			// Shutdown returned right away
+			<-src.Terminated()
+		}
+	}
+}
+
 func (s *JoiningSource) run() error {
 
 	// if liveSource works, no need for fileSource or wrapped handler
 	if src := s.tryGetSource(s.handler, s.liveSourceFactory); src != nil {
-		s.liveSource = src
-
-		s.OnTerminating(s.liveSource.Shutdown)
+		if !s.trackSource(&s.liveSource, src) {
+			return nil
+		}
 		s.liveSource.Run()
 		return s.liveSource.Err()
 	}
@@ -103,14 +183,18 @@ func (s *JoiningSource) run() error {
 			s.cursor.String())
 	}
 
-	s.OnTerminating(fileSrc.Shutdown)
+	if !s.trackSource(&s.fileSource, fileSrc) {
+		return nil
+	}
 	fileSrc.Run()
 
 	if s.liveSource == nil { // got stopped before joining
 		return fileSrc.Err()
 	}
 
-	s.OnTerminating(s.liveSource.Shutdown)
+	if s.IsTerminating() {
+		return nil
+	}
 	s.liveSource.Run()
 	return s.liveSource.Err()
 
@@ -132,21 +216,63 @@ func (s *JoiningSource) fileSourceHandler(blk *pbbstream.Block, obj interface{})
 	}
 
 	if blk.Number >= s.lowestLiveBlockNum {
+		liveHandler := s.handler
+		if s.handoffDedupWindow > 0 {
+			liveHandler = HandlerFunc(s.liveSourceHandler)
+		}
+
+		var src Source
 		if s.cursorIsTarget {
-			if src := s.liveSourceFactory.SourceThroughCursor(blk.Number, s.cursor, s.handler); src != nil {
-				s.liveSource = src
-				return stopSourceOnJoin
-			}
+			src = s.liveSourceFactory.SourceThroughCursor(blk.Number, s.cursor, liveHandler)
 		} else {
-			if src := s.liveSourceFactory.SourceFromBlockNum(blk.Number, s.handler); src != nil {
-				s.liveSource = src
-				return stopSourceOnJoin
-			}
+			src = s.liveSourceFactory.SourceFromBlockNum(blk.Number, liveHandler)
+		}
+		if src != nil {
+			s.trackSource(&s.liveSource, src)
+			return stopSourceOnJoin
 		}
 		if lowestBlockGetter, ok := s.liveSourceFactory.(LowSourceLimitGetter); ok {
 			s.lowestLiveBlockNum = lowestBlockGetter.LowestBlockNum()
 		}
 	}
 
+	if err := s.handler.ProcessBlock(blk, obj); err != nil {
+		return err
+	}
+
+	if s.handoffDedupWindow > 0 {
+		s.fileBlockIDs = append(s.fileBlockIDs, blk.Id)
+		if len(s.fileBlockIDs) > s.handoffDedupWindow {
+			s.fileBlockIDs = s.fileBlockIDs[1:]
+		}
+	}
+	return nil
+}
+
+// liveSourceHandler drops the blocks the live source starts with that were
+// already sent from the file source, undos excepted.
+func (s *JoiningSource) liveSourceHandler(blk *pbbstream.Block, obj interface{}) error {
+	if !s.handoffDone {
+		if s.sentFromFile(blk.Id) && !isUndo(obj) {
+			s.logger.Debug("dropping block already sent from file source", zap.Stringer("block", blk.AsRef()))
+			return nil
+		}
+		s.handoffDone = true
+		s.fileBlockIDs = nil
+	}
 	return s.handler.ProcessBlock(blk, obj)
 }
+
+func (s *JoiningSource) sentFromFile(id string) bool {
+	for _, fileID := range s.fileBlockIDs {
+		if fileID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func isUndo(obj interface{}) bool {
+	stepable, ok := obj.(Stepable)
+	return ok && stepable.Step().Matches(StepUndo)
+}
@@ -17,6 +17,7 @@ package bstream
 import (
 	"errors"
 	"testing"
+	"time"
 
 	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
 
@@ -213,3 +214,196 @@ func TestJoiningSource_lowerLimitBackoff(t *testing.T) {
 	assert.Equal(t, 3, liveSourceFactoryCalls)
 
 }
+
+// slowStoppingSource returns from Run a bit after being shut down
+type slowStoppingSource struct {
+	*TestSource
+	returned chan struct{}
+}
+
+func (s *slowStoppingSource) Run() {
+	s.TestSource.Run()
+	time.Sleep(10 * time.Millisecond)
+	close(s.returned)
+}
+
+func TestJoiningSource_RunWaitsForSubSources(t *testing.T) {
+	fileSF := NewTestSourceFactory()
+	liveSF := NewTestSourceFactory()
+	liveSF.FromBlockNumFunc = func(num uint64, h Handler) Source { return nil }
+
+	var fileSrc *slowStoppingSource
+	created := make(chan struct{})
+	fileSF.FromBlockNumFunc = func(num uint64, h Handler) Source {
+		fileSrc = &slowStoppingSource{TestSource: NewTestSource(h), returned: make(chan struct{})}
+		close(created)
+		return fileSrc
+	}
+
+	handler, _ := testHandler(0)
+	joiningSource := NewJoiningSource(fileSF, liveSF, handler, 2, nil, false, zlog)
+	runReturned := make(chan struct{})
+	go func() {
+		joiningSource.Run()
+		close(runReturned)
+	}()
+
+	<-created
+	<-fileSrc.running
+	require.NoError(t, fileSrc.Push(TestBlock("00000002a", "00000001a"), nil))
+
+	joiningSource.Shutdown(errTestMock)
+	<-runReturned
+
+	select {
+	case <-fileSrc.returned:
+	default:
+		t.Fatal("file source still running after the joining source Run returned")
+	}
+	assert.Equal(t, []error{errTestMock}, joiningSource.SubSourceErrors())
+}
+
+func TestJoiningSource_ShutdownFromHandler(t *testing.T) {
+	fileSF := NewTestSourceFactory()
+	liveSF := NewTestSourceFactory()
+	liveSF.FromBlockNumFunc = func(num uint64, h Handler) Source { return nil }
+
+	var joiningSource *JoiningSource
+	handler := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		joiningSource.Shutdown(errTestMock)
+		return nil
+	})
+	joiningSource = NewJoiningSource(fileSF, liveSF, handler, 2, nil, false, zlog)
+	go joiningSource.Run()
+
+	fileSrc := <-fileSF.Created
+	<-fileSrc.running
+
+	pushed := make(chan error)
+	go func() { pushed <- fileSrc.Push(TestBlock("00000002a", "00000001a"), nil) }()
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatal("shutting down from the handler blocked")
+	}
+	<-joiningSource.Terminated()
+	assert.Equal(t, errTestMock, joiningSource.Err())
+}
+
+func TestJoiningSource_SubSourceErrors(t *testing.T) {
+	fileSF := NewTestSourceFactory()
+	liveSF := NewTestSourceFactory()
+
+	var liveSrc *TestSource
+	liveSF.FromBlockNumFunc = func(num uint64, h Handler) Source {
+		if num == 3 {
+			liveSrc = NewTestSource(h)
+			return liveSrc
+		}
+		return nil
+	}
+
+	handler, _ := testHandler(4)
+	joiningSource := NewJoiningSource(fileSF, liveSF, handler, 2, nil, false, zlog)
+	go joiningSource.Run()
+
+	fileSrc := <-fileSF.Created
+	<-fileSrc.running
+	assert.Equal(t, []error{nil}, joiningSource.SubSourceErrors())
+
+	require.NoError(t, fileSrc.Push(TestBlock("00000002a", "00000001a"), nil))
+	require.Error(t, fileSrc.Push(TestBlock("00000003a", "00000002a"), nil))
+
+	<-liveSrc.running
+	require.Error(t, liveSrc.Push(TestBlock("00000004a", "00000003a"), nil))
+	<-joiningSource.Terminated()
+
+	assert.Equal(t, []error{stopSourceOnJoin, errTestMock}, joiningSource.SubSourceErrors())
+	assert.Equal(t, errTestMock, joiningSource.Err())
+}
+
+func TestJoiningSource_handoffDedup(t *testing.T) {
+	run := func(t *testing.T, opts ...JoiningSourceOption) (received []string) {
+		fileSF := NewTestSourceFactory()
+		liveSF := NewTestSourceFactory()
+
+		var liveSrc *TestSource
+		liveSF.FromBlockNumFunc = func(num uint64, h Handler) Source {
+			if num == 4 {
+				liveSrc = NewTestSource(h)
+				return liveSrc
+			}
+			return nil
+		}
+
+		handler, out := testHandler(0)
+		joiningSource := NewJoiningSource(fileSF, liveSF, handler, 2, nil, false, zlog, opts...)
+		go joiningSource.Run()
+
+		fileSrc := <-fileSF.Created
+		<-fileSrc.running
+		require.NoError(t, fileSrc.Push(TestBlock("00000002a", "00000001a"), nil))
+		require.NoError(t, fileSrc.Push(TestBlock("00000003a", "00000002a"), nil))
+		require.Error(t, fileSrc.Push(TestBlock("00000004a", "00000003a"), nil))
+
+		<-liveSrc.running
+		// live source starting a bit before the join block
+		require.NoError(t, liveSrc.Push(TestBlock("00000003a", "00000002a"), nil))
+		require.NoError(t, liveSrc.Push(TestBlock("00000004a", "00000003a"), nil))
+		require.NoError(t, liveSrc.Push(TestBlock("00000005a", "00000004a"), nil))
+		joiningSource.Shutdown(nil)
+
+		close(out)
+		for ppBlk := range out {
+			received = append(received, ppBlk.Block.Id)
+		}
+		return received
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		assert.Equal(t, []string{"00000002a", "00000003a", "00000004a", "00000005a"}, run(t, JoiningSourceWithHandoffDedupWindow(10)))
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		assert.Equal(t, []string{"00000002a", "00000003a", "00000003a", "00000004a", "00000005a"}, run(t))
+	})
+}
+
+func TestJoiningSource_TerminatedAfterSubSources(t *testing.T) {
+	fileSF := NewTestSourceFactory()
+	liveSF := NewTestSourceFactory()
+	liveSF.FromBlockNumFunc = func(num uint64, h Handler) Source { return nil }
+
+	joiningSource := NewJoiningSource(fileSF, liveSF, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error { return nil }), 2, nil, false, zlog)
+	go joiningSource.Run()
+
+	fileSrc := <-fileSF.Created
+	<-fileSrc.running
+
+	// the file source is already shutting down on its own, slowly
+	release := make(chan struct{})
+	fileSrc.OnTerminating(func(error) { <-release })
+	go fileSrc.Shutdown(errTestMock)
+	<-fileSrc.Terminating()
+
+	go joiningSource.Shutdown(nil)
+	<-joiningSource.Terminating()
+
+	select {
+	case <-joiningSource.Terminated():
+		t.Fatal("joining source terminated before its file source")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-joiningSource.Terminated():
+	case <-time.After(time.Second):
+		t.Fatal("joining source not terminated after its file source")
+	}
+	select {
+	case <-fileSrc.Terminated():
+	default:
+		t.Fatal("file source not terminated")
+	}
+}
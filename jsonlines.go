@@ -0,0 +1,104 @@
+package bstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// jsonLine is the object written by the JSON Lines sink for each block
+type jsonLine struct {
+	ID          string          `json:"id"`
+	Number      uint64          `json:"number"`
+	ParentID    string          `json:"prev"`
+	LIBNum      uint64          `json:"libnum"`
+	Timestamp   string          `json:"timestamp,omitempty"`
+	Step        string          `json:"step,omitempty"`
+	Cursor      string          `json:"cursor,omitempty"`
+	Protocol    json.RawMessage `json:"protocol,omitempty"`
+	DecodeError string          `json:"decode_error,omitempty"`
+}
+
+// NewJSONLinesSink returns a handler writing one JSON object per block to
+// `w`, for inspecting or exporting a stream: the block id, number, parent id,
+// LIB number and timestamp, plus the step and cursor when the object carries
+// them. With `decode`, the decompressed chain specific payload is added as
+// `protocol`, in its protobuf JSON form.
+//
+// A payload that cannot be decoded does not stop the stream, the line gets a
+// `decode_error` instead. The handler fails only when `w` cannot be written.
+func NewJSONLinesSink(w io.Writer, decode bool) Handler {
+	var lock sync.Mutex
+
+	return HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		line := &jsonLine{
+			ID:       blk.Id,
+			Number:   blk.Number,
+			ParentID: blk.ParentId,
+			LIBNum:   blk.LibNum,
+		}
+		if blk.Timestamp.CheckValid() == nil {
+			line.Timestamp = blk.Timestamp.AsTime().Format(time.RFC3339Nano)
+		}
+		if stepable, ok := obj.(Stepable); ok {
+			line.Step = stepable.Step().String()
+		}
+		if cursorable, ok := obj.(Cursorable); ok && !cursorable.Cursor().IsEmpty() {
+			line.Cursor = cursorable.Cursor().String()
+		}
+		if decode {
+			protocol, err := protocolJSON(blk)
+			if err != nil {
+				line.DecodeError = err.Error()
+			}
+			line.Protocol = protocol
+		}
+
+		data, err := json.Marshal(line)
+		if err != nil {
+			return fmt.Errorf("marshalling block %s to json: %w", blk.AsRef(), err)
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("writing block %s: %w", blk.AsRef(), err)
+		}
+		return nil
+	})
+}
+
+// protocolJSON decodes the payload like `ToProtocol` does, without knowing its
+// type: with the decoder of the block payload version when there is one.
+func protocolJSON(blk *pbbstream.Block) (json.RawMessage, error) {
+	if decoded, found, err := decodeByVersion(blk); found {
+		if err != nil {
+			return nil, err
+		}
+		msg, ok := decoded.(proto.Message)
+		if !ok {
+			return nil, fmt.Errorf("payload version %d decoded as %T, not a protobuf message", blk.PayloadVersion, decoded)
+		}
+		return protojson.Marshal(msg)
+	}
+
+	payload, err := DecompressedPayload(blk)
+	if err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		return nil, fmt.Errorf("block has no payload")
+	}
+
+	msg, err := payload.UnmarshalNew()
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling payload: %w", err)
+	}
+	return protojson.Marshal(msg)
+}
@@ -0,0 +1,77 @@
+package bstream
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestJSONLinesSink(t *testing.T) {
+	blk := TestBlockWithLIBNum("00000003a", "00000002a", 1)
+	require.NoError(t, SetBlockPayload(blk, &pbbstream.BlockMeta{Id: "payload"}))
+	undecodable := TestBlockWithLIBNum("00000004a", "00000003a", 1)
+	undecodable.Payload = &anypb.Any{TypeUrl: "type.googleapis.com/unknown.Type"}
+
+	cursor := &Cursor{
+		Step:      StepNew,
+		Block:     blk.AsRef(),
+		HeadBlock: blk.AsRef(),
+		LIB:       NewBlockRef("00000001a", 1),
+	}
+
+	buf := &bytes.Buffer{}
+	h := NewJSONLinesSink(buf, true)
+	require.NoError(t, h.ProcessBlock(blk, &wrappedObject{cursor: cursor}))
+	require.NoError(t, h.ProcessBlock(undecodable, nil))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{
+		"id": "00000003a",
+		"number": 3,
+		"prev": "00000002a",
+		"libnum": 1,
+		"timestamp": "`+blk.Timestamp.AsTime().Format(time.RFC3339Nano)+`",
+		"step": "new",
+		"cursor": "`+cursor.String()+`",
+		"protocol": {"id": "payload"}
+	}`, lines[0])
+	assert.Contains(t, lines[1], `"id":"00000004a"`)
+	assert.Contains(t, lines[1], `"decode_error":"unmarshalling payload`)
+	assert.NotContains(t, lines[1], `"step"`)
+}
+
+func TestJSONLinesSink_DecoderByVersionAndInvalidTimestamp(t *testing.T) {
+	defer func(previous map[int32]BlockDecoderFunc) { GetBlockDecoderByVersion = previous }(GetBlockDecoderByVersion)
+	GetBlockDecoderByVersion = map[int32]BlockDecoderFunc{
+		1: func(blk *pbbstream.Block) (interface{}, error) {
+			ref := &pbbstream.BlockRef{}
+			if err := blk.Payload.UnmarshalTo(ref); err != nil {
+				return nil, err
+			}
+			return &pbbstream.BlockMeta{Id: ref.Id, Number: ref.Num}, nil
+		},
+	}
+
+	blk := TestBlock("00000002a", "00000001a")
+	blk.PayloadVersion = 1
+	blk.Timestamp = &timestamppb.Timestamp{Seconds: 1, Nanos: -1}
+	require.NoError(t, SetBlockPayload(blk, &pbbstream.BlockRef{Id: "old", Num: 2}))
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, NewJSONLinesSink(buf, true).ProcessBlock(blk, nil))
+	assert.JSONEq(t, `{
+		"id": "00000002a",
+		"number": 2,
+		"prev": "00000001a",
+		"libnum": 0,
+		"protocol": {"id": "old", "number": "2"}
+	}`, buf.String())
+}
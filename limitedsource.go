@@ -0,0 +1,56 @@
+package bstream
+
+import (
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/shutter"
+)
+
+// LimitedSource wraps the source created by a SourceFactory and shuts it down
+// once `maxBlocks` blocks were sent to the handler, for "the first N blocks
+// from wherever it starts" without computing a stop block. It then shuts
+// down with `ErrLimitReached`, a normal end for `IsNormalSourceEnd`.
+type LimitedSource struct {
+	*shutter.Shutter
+
+	source    Source
+	handler   Handler
+	maxBlocks int
+	sent      int
+}
+
+func NewLimitedSource(sf SourceFactory, maxBlocks int, h Handler) *LimitedSource {
+	s := &LimitedSource{
+		Shutter:   shutter.New(),
+		handler:   h,
+		maxBlocks: maxBlocks,
+	}
+	s.source = sf(HandlerFunc(s.processBlock))
+	s.OnTerminating(func(err error) {
+		s.source.Shutdown(err)
+	})
+
+	return s
+}
+
+func (s *LimitedSource) Run() {
+	if s.maxBlocks <= 0 {
+		s.Shutdown(ErrLimitReached)
+		return
+	}
+
+	go s.source.Run()
+	<-s.source.Terminated()
+	s.Shutdown(s.source.Err())
+}
+
+func (s *LimitedSource) processBlock(blk *pbbstream.Block, obj interface{}) error {
+	if err := s.handler.ProcessBlock(blk, obj); err != nil {
+		return err
+	}
+
+	s.sent++
+	if s.sent >= s.maxBlocks {
+		return ErrLimitReached
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package bstream
+
+import (
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitedSource(t *testing.T) {
+	sf := NewTestSourceFactory()
+
+	var received []string
+	src := NewLimitedSource(sf.NewSource, 2, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		received = append(received, blk.Id)
+		return nil
+	}))
+	go src.Run()
+
+	inner := <-sf.Created
+	<-inner.running
+	require.NoError(t, inner.Push(TestBlock("00000002a", "00000001a"), nil))
+	assert.ErrorIs(t, inner.Push(TestBlock("00000003a", "00000002a"), nil), ErrLimitReached)
+
+	<-src.Terminated()
+	assert.True(t, inner.IsTerminated())
+	assert.Equal(t, []string{"00000002a", "00000003a"}, received)
+	assert.ErrorIs(t, src.Err(), ErrLimitReached)
+	assert.True(t, SourceEnded(src))
+}
+
+func TestLimitedSource_HandlerError(t *testing.T) {
+	sf := NewTestSourceFactory()
+
+	src := NewLimitedSource(sf.NewSource, 2, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		return errTestMock
+	}))
+	go src.Run()
+
+	inner := <-sf.Created
+	<-inner.running
+	assert.ErrorIs(t, inner.Push(TestBlock("00000002a", "00000001a"), nil), errTestMock)
+
+	<-src.Terminated()
+	assert.ErrorIs(t, src.Err(), errTestMock)
+	assert.False(t, SourceEnded(src))
+}
@@ -0,0 +1,129 @@
+package bstream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/streamingfast/dstore"
+)
+
+// MergedFileNameForBlock returns the name of the merged blocks file holding
+// `blockNum`: its base block number, zero-padded to 10 digits. Bundles are
+// `GetMergedBlocksBundleSize` blocks long.
+func MergedFileNameForBlock(blockNum uint64) string {
+	return mergedFileName(lowBoundary(blockNum, GetMergedBlocksBundleSize))
+}
+
+// BlockRangeForMergedFile is the inverse of `MergedFileNameForBlock`, it
+// returns the inclusive range of block numbers held by the merged blocks file
+// `name`. A directory and a file extension (ex: `.dbin.zst`) are accepted.
+func BlockRangeForMergedFile(name string) (low, high uint64, err error) {
+	baseName, _, _ := strings.Cut(path.Base(name), ".")
+	if len(baseName) != 10 {
+		return 0, 0, fmt.Errorf("invalid merged blocks filename %q: expected 10 digits", name)
+	}
+	low, err = strconv.ParseUint(baseName, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid merged blocks filename %q: %w", name, err)
+	}
+	if low%GetMergedBlocksBundleSize != 0 {
+		return 0, 0, fmt.Errorf("invalid merged blocks filename %q: %d is not a multiple of bundle size %d", name, low, GetMergedBlocksBundleSize)
+	}
+	return low, low + GetMergedBlocksBundleSize - 1, nil
+}
+
+func mergedFileName(baseBlockNum uint64) string {
+	return fmt.Sprintf("%010d", baseBlockNum)
+}
+
+// VerifyStoreContinuity reads the blocks of the merged blocks files of `store`
+// covering [from, to] and returns the ranges, excluding their end, of the block
+// numbers missing from them, a missing file being a gap of its whole bundle. Block
+// numbers the chain legitimately skips are not gaps when `skipped` returns
+// true for them, `skipped` may be nil. Unlike an index, the actual block data
+// is checked. Files are read one at a time and only the block numbers of the
+// current bundle are held in memory.
+func VerifyStoreContinuity(ctx context.Context, store dstore.Store, from, to uint64, skipped func(blockNum uint64) bool) ([]*Range, error) {
+	if to < from {
+		return nil, fmt.Errorf("invalid range: end block %d is below start block %d", to, from)
+	}
+
+	var gaps []*Range
+	var gapStart uint64
+	inGap := false
+	closeGap := func(end uint64) {
+		if inGap {
+			gaps = append(gaps, NewRangeExcludingEnd(gapStart, end+1))
+			inGap = false
+		}
+	}
+
+	bundleSize := GetMergedBlocksBundleSize
+	for base := lowBoundary(from, bundleSize); base <= to; base += bundleSize {
+		present, err := mergedFileBlockNums(ctx, store, base, bundleSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for num := base; num < base+bundleSize && num <= to; num++ {
+			if num < from {
+				continue
+			}
+			if present[num-base] || (skipped != nil && skipped(num)) {
+				if num > 0 {
+					closeGap(num - 1)
+				}
+				continue
+			}
+			if !inGap {
+				gapStart = num
+				inGap = true
+			}
+		}
+	}
+	closeGap(to)
+
+	return gaps, nil
+}
+
+// mergedFileBlockNums returns which block numbers of the bundle starting at
+// `base` are in its merged blocks file, none if the file does not exist.
+func mergedFileBlockNums(ctx context.Context, store dstore.Store, base, bundleSize uint64) ([]bool, error) {
+	present := make([]bool, bundleSize)
+
+	filename := mergedFileName(base)
+	exists, err := store.FileExists(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("checking %s exists: %w", filename, err)
+	}
+	if !exists {
+		return present, nil
+	}
+
+	reader, err := store.OpenObject(ctx, filename)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s from block store: %w", filename, err)
+	}
+	defer reader.Close()
+
+	blockReader, err := NewDBinBlockReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create block reader for %s: %w", filename, err)
+	}
+	for {
+		meta, err := blockReader.ReadAsBlockMeta()
+		if err == io.EOF {
+			return present, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", filename, err)
+		}
+		if meta.Number >= base && meta.Number < base+bundleSize {
+			present[meta.Number-base] = true
+		}
+	}
+}
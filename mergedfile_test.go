@@ -0,0 +1,114 @@
+package bstream
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergedFileNameForBlock(t *testing.T) {
+	tests := []struct {
+		blockNum uint64
+		expected string
+	}{
+		{0, "0000000000"},
+		{99, "0000000000"},
+		{100, "0000000100"},
+		{101, "0000000100"},
+		{12345699, "0012345600"},
+		{9999999999, "9999999900"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			assert.Equal(t, test.expected, MergedFileNameForBlock(test.blockNum))
+		})
+	}
+}
+
+func TestBlockRangeForMergedFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		expectedLow  uint64
+		expectedHigh uint64
+		expectedErr  string
+	}{
+		{"0000000000", 0, 99, ""},
+		{"0000000100", 100, 199, ""},
+		{"some/path/0012345600.dbin.zst", 12345600, 12345699, ""},
+		{"0000000150", 0, 0, "not a multiple of bundle size 100"},
+		{"000000100", 0, 0, "expected 10 digits"},
+		{"00000001aa", 0, 0, "invalid syntax"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			low, high, err := BlockRangeForMergedFile(test.name)
+			if test.expectedErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectedLow, low)
+			assert.Equal(t, test.expectedHigh, high)
+			assert.Equal(t, MergedFileNameForBlock(test.expectedHigh), MergedFileNameForBlock(low))
+		})
+	}
+}
+
+func TestVerifyStoreContinuity(t *testing.T) {
+	bundle := func(from, to uint64, missing ...uint64) []byte {
+		var blocks []*pbbstream.Block
+	next:
+		for num := from; num <= to; num++ {
+			for _, m := range missing {
+				if num == m {
+					continue next
+				}
+			}
+			blocks = append(blocks, TestBlockWithNumbers(fmt.Sprintf("%08da", num), fmt.Sprintf("%08da", num-1), num, num-1))
+		}
+		return testBlocks(blocks...)
+	}
+
+	store := dstore.NewMockStore(nil)
+	store.SetFile(base(0), bundle(1, 99, 5, 6, 99))
+	// 100 is missing
+	store.SetFile(base(200), bundle(200, 299, 250, 251))
+	store.SetFile(base(300), bundle(300, 399))
+
+	skipped := func(num uint64) bool { return num == 250 }
+
+	tests := []struct {
+		name     string
+		from, to uint64
+		expected []string
+	}{
+		{"whole store", 1, 399, []string{"[5, 7)", "[99, 200)", "[251, 252)"}},
+		{"clipped", 6, 150, []string{"[6, 7)", "[99, 151)"}},
+		{"no gap", 300, 399, nil},
+		{"past last file", 350, 450, []string{"[400, 451)"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gaps, err := VerifyStoreContinuity(context.Background(), store, test.from, test.to, skipped)
+			require.NoError(t, err)
+
+			var got []string
+			for _, gap := range gaps {
+				got = append(got, gap.String())
+			}
+			assert.Equal(t, test.expected, got)
+		})
+	}
+
+	_, err := VerifyStoreContinuity(context.Background(), store, 10, 5, nil)
+	assert.Error(t, err)
+}
@@ -21,6 +21,10 @@ import (
 
 var Metrics = dmetrics.NewSet(dmetrics.PrefixNameWith("bstream"))
 
+// FileSourceSlowBlocks counts the blocks processed slower than the deadline
+// of FileSourceWithPerBlockDeadline
+var FileSourceSlowBlocks = Metrics.NewCounter("file_source_slow_blocks", "Number of blocks the file source handler took more than its per-block deadline to process")
+
 func WithHeadMetrics(h Handler, blkNum *dmetrics.HeadBlockNum, blkDrift *dmetrics.HeadTimeDrift) Handler {
 	return HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
 		blkDrift.SetBlockTime(blk.Time())
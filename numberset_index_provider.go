@@ -0,0 +1,46 @@
+package bstream
+
+import (
+	"sort"
+)
+
+var _ BlockIndexProvider = (*NumberSetIndexProvider)(nil)
+
+// NumberSetIndexProvider is a BlockIndexProvider matching an explicit set of
+// block numbers, use it with `FileSourceWithBlockIndexProvider` to stream only
+// those blocks out of the merged blocks files.
+//
+// No block matches past the highest number of the set, the file source would
+// then only send progress blocks: set its stop block to the highest number.
+type NumberSetIndexProvider struct {
+	nums []uint64 // sorted and unique
+}
+
+func NewNumberSetIndexProvider(nums []uint64) *NumberSetIndexProvider {
+	sorted := make([]uint64, len(nums))
+	copy(sorted, nums)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	unique := sorted[:0]
+	for i, num := range sorted {
+		if i > 0 && num == sorted[i-1] {
+			continue
+		}
+		unique = append(unique, num)
+	}
+
+	return &NumberSetIndexProvider{
+		nums: unique,
+	}
+}
+
+func (p *NumberSetIndexProvider) BlocksInRange(baseBlockNum, bundleSize uint64) (out []uint64, err error) {
+	exclusiveUpperBound := baseBlockNum + bundleSize
+	for i := sort.Search(len(p.nums), func(i int) bool { return p.nums[i] >= baseBlockNum }); i < len(p.nums); i++ {
+		if p.nums[i] >= exclusiveUpperBound {
+			break
+		}
+		out = append(out, p.nums[i])
+	}
+	return out, nil
+}
@@ -0,0 +1,61 @@
+package bstream
+
+import (
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNumberSetIndexProvider_BlocksInRange(t *testing.T) {
+	p := NewNumberSetIndexProvider([]uint64{250, 5, 99, 100, 5, 199})
+
+	tests := []struct {
+		name     string
+		base     uint64
+		expected []uint64
+	}{
+		{"first bundle", 0, []uint64{5, 99}},
+		{"boundaries", 100, []uint64{100, 199}},
+		{"last bundle", 200, []uint64{250}},
+		{"past the set", 300, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := p.BlocksInRange(test.base, 100)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out)
+		})
+	}
+}
+
+func TestNumberSetIndexProvider_FileSource(t *testing.T) {
+	bs := dstore.NewMockStore(nil)
+	bs.SetFile(base(0), testBlocks(
+		TestBlockWithNumbers("1a", "00", 1, 0),
+		TestBlockWithNumbers("2a", "1a", 2, 0),
+		TestBlockWithNumbers("3a", "2a", 3, 0),
+	))
+	bs.SetFile(base(100), testBlocks(
+		TestBlockWithNumbers("103a", "3a", 103, 0),
+		TestBlockWithNumbers("104a", "103a", 104, 0),
+	))
+
+	var received []uint64
+	handler := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		received = append(received, blk.Number)
+		return nil
+	})
+
+	fs := NewFileSource(bs, 1, handler, zlog,
+		FileSourceWithBlockIndexProvider(NewNumberSetIndexProvider([]uint64{104, 2})),
+		FileSourceWithStopBlock(104),
+	)
+	fs.Run()
+
+	assert.ErrorIs(t, fs.Err(), ErrStopBlockReached)
+	assert.Equal(t, []uint64{1, 2, 104}, received)
+}
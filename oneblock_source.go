@@ -5,13 +5,20 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"sort"
 	"time"
 
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
 	"github.com/streamingfast/dstore"
 	"github.com/streamingfast/shutter"
 	"go.uber.org/zap"
 )
 
+// OneBlockFilenamesAttachment is the attachment key under which the one-blocks
+// source attaches the names of the one-block files a block was read from, as
+// a sorted `[]string`, see OneBlocksSourceWithFilenamesAttachment.
+const OneBlockFilenamesAttachment = "bstream.one_block_filenames"
+
 type oneBlocksSource struct {
 	*shutter.Shutter
 	oneBlockFiles []*OneBlockFile
@@ -19,6 +26,9 @@ type oneBlocksSource struct {
 	handler       Handler
 	ctx           context.Context
 	skipperFunc   func(idSuffix string) bool
+
+	onConflictingBlock func(num uint64, filenameA, filenameB string)
+	attachFilenames    bool
 }
 
 type OneBlocksSourceOption func(*oneBlocksSource)
@@ -30,6 +40,29 @@ func OneBlocksSourceWithSkipperFunc(f func(string) bool) OneBlocksSourceOption {
 	}
 }
 
+// OneBlocksSourceWithConflictingBlockCallback calls `f` with the block number
+// and the names of the two files when one-block files of the same block ID
+// hold different blocks, which points to a misbehaving one-block producer.
+// Files of the same number with different IDs are forks, they are not
+// reported. Without it, conflicts are logged. To compare them, the duplicates
+// of a block read by the source are downloaded even when the skipper function
+// skips them, they are not sent to the handler.
+func OneBlocksSourceWithConflictingBlockCallback(f func(num uint64, filenameA, filenameB string)) OneBlocksSourceOption {
+	return func(s *oneBlocksSource) {
+		s.onConflictingBlock = f
+	}
+}
+
+// OneBlocksSourceWithFilenamesAttachment pushes each block with the names of
+// the one-block files it was read from, under OneBlockFilenamesAttachment,
+// instead of a nil object. Use it to feed a hub created with
+// `hub.WithOneBlockProcessedCallback`.
+func OneBlocksSourceWithFilenamesAttachment() OneBlocksSourceOption {
+	return func(s *oneBlocksSource) {
+		s.attachFilenames = true
+	}
+}
+
 func NewOneBlocksSource(
 	lowestBlockNum uint64,
 	store dstore.Store,
@@ -59,6 +92,9 @@ func NewOneBlocksSource(
 				cancel()
 			}),
 		),
+		onConflictingBlock: func(num uint64, filenameA, filenameB string) {
+			zlog.Warn("one-block files of the same block hold different blocks", zap.Uint64("block_num", num), zap.String("filename_a", filenameA), zap.String("filename_b", filenameB))
+		},
 	}
 	for _, opt := range options {
 		opt(src)
@@ -72,8 +108,14 @@ func (s *oneBlocksSource) Run() {
 }
 
 func (s *oneBlocksSource) run() error {
+	// first file read of the current block, its duplicates are compared to it
+	var first *OneBlockFile
+	var firstBlk *pbbstream.Block
+
 	for _, file := range s.oneBlockFiles {
-		if s.skipperFunc != nil && s.skipperFunc(file.ID) {
+		duplicate := first != nil && file.Num == first.Num && file.ID == first.ID
+		skip := s.skipperFunc != nil && s.skipperFunc(file.ID)
+		if skip && !duplicate {
 			continue
 		}
 
@@ -93,7 +135,28 @@ func (s *oneBlocksSource) run() error {
 			return fmt.Errorf("block reader failed: %w", err)
 		}
 
-		if err := s.handler.ProcessBlock(blk, nil); err != nil {
+		if duplicate {
+			if equal, _ := BlocksEqual(firstBlk, blk); !equal {
+				s.onConflictingBlock(file.Num, oneBlockFilename(first), oneBlockFilename(file))
+			}
+			if skip {
+				continue
+			}
+		} else {
+			first = file
+			firstBlk = blk
+		}
+
+		var obj interface{}
+		if s.attachFilenames {
+			filenames := make([]string, 0, len(file.Filenames))
+			for filename := range file.Filenames {
+				filenames = append(filenames, filename)
+			}
+			sort.Strings(filenames)
+			obj = NewAttachedObject(nil, Attachments{OneBlockFilenamesAttachment: filenames})
+		}
+		if err := s.handler.ProcessBlock(blk, obj); err != nil {
 			return err
 		}
 
@@ -102,6 +165,16 @@ func (s *oneBlocksSource) run() error {
 	return nil
 }
 
+// oneBlockFilename returns the lowest of the names of `file`
+func oneBlockFilename(file *OneBlockFile) (out string) {
+	for filename := range file.Filenames {
+		if out == "" || filename < out {
+			out = filename
+		}
+	}
+	return
+}
+
 func listOneBlocks(ctx context.Context, from uint64, to uint64, store dstore.Store) (out []*OneBlockFile, err error) {
 	fromStr := fmt.Sprintf("%010d", from)
 	err = store.WalkFrom(ctx, "", fromStr, func(filename string) error {
@@ -0,0 +1,83 @@
+package bstream
+
+import (
+	"fmt"
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOneBlocksSource_ConflictingBlocks(t *testing.T) {
+	withPayload := func(blk *pbbstream.Block, content string) *pbbstream.Block {
+		require.NoError(t, SetBlockPayload(blk, &pbbstream.BlockMeta{Id: content}))
+		return blk
+	}
+
+	store := dstore.NewMockStore(nil)
+	store.SetFile("0000000002-00000002a-00000001a-1-producer1", testBlocks(withPayload(TestBlockWithNumbers("00000002a", "00000001a", 2, 1), "good")))
+	store.SetFile("0000000002-00000002a-00000001a-1-producer2", testBlocks(withPayload(TestBlockWithNumbers("00000002a", "00000001a", 2, 1), "bad")))
+	store.SetFile("0000000003-00000003a-00000002a-1-producer1", testBlocks(withPayload(TestBlockWithNumbers("00000003a", "00000002a", 3, 2), "good")))
+	store.SetFile("0000000003-00000003a-00000002a-1-producer2", testBlocks(withPayload(TestBlockWithNumbers("00000003a", "00000002a", 3, 2), "good")))
+	store.SetFile("0000000003-00000003b-00000002a-1-producer1", testBlocks(withPayload(TestBlockWithNumbers("00000003b", "00000002a", 3, 2), "fork")))
+
+	run := func(skipSent bool, skipped string) (sent []string, conflicts []string) {
+		src, err := NewOneBlocksSource(0, store, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			sent = append(sent, blk.Id)
+			return nil
+		}), OneBlocksSourceWithSkipperFunc(func(id string) bool {
+			for _, sentID := range sent {
+				if skipSent && sentID == id {
+					return true
+				}
+			}
+			return id == skipped
+		}), OneBlocksSourceWithConflictingBlockCallback(func(num uint64, filenameA, filenameB string) {
+			conflicts = append(conflicts, fmt.Sprintf("%d:%s:%s", num, filenameA, filenameB))
+		}))
+		require.NoError(t, err)
+
+		src.Run()
+		require.NoError(t, src.Err())
+		return
+	}
+
+	expectedConflicts := []string{"2:0000000002-00000002a-00000001a-1-producer1:0000000002-00000002a-00000001a-1-producer2"}
+
+	sent, conflicts := run(false, "")
+	assert.Equal(t, []string{"00000002a", "00000002a", "00000003a", "00000003a", "00000003b"}, sent)
+	assert.Equal(t, expectedConflicts, conflicts)
+
+	sent, conflicts = run(true, "")
+	assert.Equal(t, []string{"00000002a", "00000003a", "00000003b"}, sent)
+	assert.Equal(t, expectedConflicts, conflicts, "skipped duplicates are still compared")
+
+	sent, conflicts = run(false, "00000002a")
+	assert.Equal(t, []string{"00000003a", "00000003a", "00000003b"}, sent)
+	assert.Empty(t, conflicts, "skipped blocks are not downloaded")
+}
+
+func TestOneBlocksSource_FilenamesAttachment(t *testing.T) {
+	store := dstore.NewMockStore(nil)
+	store.SetFile("0000000002-00000002a-00000001a-1-producer1", testBlocks(TestBlockWithNumbers("00000002a", "00000001a", 2, 1)))
+
+	run := func(opts ...OneBlocksSourceOption) (objs []interface{}) {
+		src, err := NewOneBlocksSource(0, store, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			objs = append(objs, obj)
+			return nil
+		}), opts...)
+		require.NoError(t, err)
+
+		src.Run()
+		require.NoError(t, src.Err())
+		return
+	}
+
+	assert.Equal(t, []interface{}{nil}, run(), "no attachment by default")
+
+	objs := run(OneBlocksSourceWithFilenamesAttachment())
+	require.Len(t, objs, 1)
+	assert.Equal(t, []string{"0000000002-00000002a-00000001a-1-producer1"}, AttachmentsFromObject(objs[0])[OneBlockFilenamesAttachment])
+}
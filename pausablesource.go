@@ -0,0 +1,93 @@
+package bstream
+
+import (
+	"fmt"
+	"sync"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/shutter"
+)
+
+// PausableSource wraps the source created by a SourceFactory so its delivery
+// to the handler can be paused and resumed without tearing it down, e.g. for
+// a brief maintenance. The block in flight when paused is held and delivered
+// first on resume, so the handler sees the exact same sequence of blocks.
+//
+// Nothing is buffered while paused: the handler call of the wrapped source
+// blocks, which in turn stops it from reading further blocks. Memory stays
+// bounded, but the wrapped source's own upstream (a live connection for
+// example) may buffer or time out during a long pause, so keep them short.
+type PausableSource struct {
+	*shutter.Shutter
+
+	source  Source
+	handler Handler
+
+	lock    sync.Mutex
+	resumed chan struct{} // non-nil while paused, closed on resume
+}
+
+func NewPausableSource(sf SourceFactory, h Handler) *PausableSource {
+	s := &PausableSource{
+		Shutter: shutter.New(),
+		handler: h,
+	}
+	s.source = sf(HandlerFunc(s.processBlock))
+	s.OnTerminating(func(err error) {
+		s.source.Shutdown(err)
+	})
+
+	return s
+}
+
+func (s *PausableSource) Run() {
+	go s.source.Run()
+	<-s.source.Terminated()
+	s.Shutdown(s.source.Err())
+}
+
+// Pause stops the delivery of blocks to the handler, the block being handled
+// when called, if any, completes normally. Pausing a paused source is a no-op.
+func (s *PausableSource) Pause() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.resumed == nil {
+		s.resumed = make(chan struct{})
+	}
+}
+
+// Resume continues the delivery of blocks where it stopped. Resuming a source
+// that is not paused is a no-op.
+func (s *PausableSource) Resume() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.resumed != nil {
+		close(s.resumed)
+		s.resumed = nil
+	}
+}
+
+func (s *PausableSource) IsPaused() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.resumed != nil
+}
+
+func (s *PausableSource) processBlock(blk *pbbstream.Block, obj interface{}) error {
+	s.lock.Lock()
+	resumed := s.resumed
+	s.lock.Unlock()
+
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-s.Terminating():
+			return fmt.Errorf("source terminated while paused on block %s", blk.AsRef())
+		}
+	}
+
+	return s.handler.ProcessBlock(blk, obj)
+}
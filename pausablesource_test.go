@@ -0,0 +1,85 @@
+package bstream
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPausableSource(t *testing.T) {
+	blocks := make(chan *pbbstream.Block)
+
+	var lock sync.Mutex
+	var received []string
+	src := NewPausableSource(func(h Handler) Source {
+		return NewChannelSource(blocks, h)
+	}, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		lock.Lock()
+		defer lock.Unlock()
+		received = append(received, blk.Id)
+		return nil
+	}))
+	receivedIDs := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string{}, received...)
+	}
+
+	go src.Run()
+
+	blocks <- TestBlock("00000001a", "00000000a")
+	require.Eventually(t, func() bool { return len(receivedIDs()) == 1 }, time.Second, time.Millisecond)
+
+	src.Pause()
+	assert.True(t, src.IsPaused())
+	blocks <- TestBlock("00000002a", "00000001a")
+
+	sent := make(chan struct{})
+	go func() {
+		blocks <- TestBlock("00000003a", "00000002a")
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+		t.Fatal("upstream should be blocked while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, []string{"00000001a"}, receivedIDs())
+
+	src.Resume()
+	assert.False(t, src.IsPaused())
+	<-sent
+	close(blocks)
+
+	<-src.Terminated()
+	assert.Equal(t, io.EOF, src.Err())
+	assert.Equal(t, []string{"00000001a", "00000002a", "00000003a"}, receivedIDs())
+}
+
+func TestPausableSource_ShutdownWhilePaused(t *testing.T) {
+	blocks := make(chan *pbbstream.Block, 1)
+	src := NewPausableSource(func(h Handler) Source {
+		return NewChannelSource(blocks, h)
+	}, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		return fmt.Errorf("should not be called")
+	}))
+
+	src.Pause()
+	blocks <- TestBlock("00000001a", "00000000a")
+	go src.Run()
+
+	src.Shutdown(fmt.Errorf("maintenance over"))
+	select {
+	case <-src.Terminated():
+		assert.EqualError(t, src.Err(), "maintenance over")
+	case <-time.After(time.Second):
+		t.Fatal("paused source not terminated")
+	}
+}
@@ -0,0 +1,226 @@
+package bstream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+type PayloadCompression byte
+
+const (
+	PayloadCompressionNone PayloadCompression = iota
+	PayloadCompressionGzip
+	PayloadCompressionZstd
+)
+
+func (c PayloadCompression) String() string {
+	switch c {
+	case PayloadCompressionNone:
+		return "none"
+	case PayloadCompressionGzip:
+		return "gzip"
+	case PayloadCompressionZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(c))
+}
+
+// CompressedPayloadTypeURL is the type of the compressed block payloads: a
+// consumer unaware of compression gets an unknown type instead of garbage when
+// unmarshalling one. Its value is the protobuf encoding of
+//
+//	message CompressedPayload {
+//	  string type_url = 1;    // type of the payload once decompressed
+//	  uint32 compression = 2; // PayloadCompression
+//	  bytes value = 3;        // compressed payload value
+//	}
+//
+// `DecompressedPayload` unwraps it, `PayloadTypeURL` gives the original type.
+const CompressedPayloadTypeURL = "type.googleapis.com/sf.bstream.v1.CompressedPayload"
+
+var zstdOnce sync.Once
+var zstdEncoder *zstd.Encoder
+var zstdDecoder *zstd.Decoder
+
+// zstdCodec lazily creates the shared zstd encoder and decoder, both are safe
+// for concurrent use through `EncodeAll` and `DecodeAll`.
+func zstdCodec() (*zstd.Encoder, *zstd.Decoder) {
+	zstdOnce.Do(func() {
+		var err error
+		if zstdEncoder, err = zstd.NewWriter(nil); err != nil {
+			panic(fmt.Errorf("creating zstd encoder: %w", err))
+		}
+		if zstdDecoder, err = zstd.NewReader(nil); err != nil {
+			panic(fmt.Errorf("creating zstd decoder: %w", err))
+		}
+	})
+	return zstdEncoder, zstdDecoder
+}
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// SetBlockPayload sets `payload` as the block payload, compressed with
+// `GetPayloadCompression`.
+func SetBlockPayload(blk *pbbstream.Block, payload proto.Message) error {
+	anyPayload, err := anypb.New(payload)
+	if err != nil {
+		return fmt.Errorf("wrapping payload: %w", err)
+	}
+	blk.Payload = anyPayload
+
+	return CompressBlockPayload(blk, GetPayloadCompression)
+}
+
+// CompressBlockPayload compresses the payload value of `blk` in place, it is a
+// no-op if the payload is empty or already compressed. The payload then has
+// the CompressedPayloadTypeURL type until `ToProtocol` or `DecompressedPayload`
+// is called: it is written to merged and one-block files and sent to clients
+// that way, so only compress the payloads of blocks whose consumers
+// decompress them.
+func CompressBlockPayload(blk *pbbstream.Block, compression PayloadCompression) error {
+	if compression == PayloadCompressionNone || blk.Payload == nil || len(blk.Payload.Value) == 0 {
+		return nil
+	}
+	if blk.Payload.TypeUrl == CompressedPayloadTypeURL {
+		return nil
+	}
+
+	var compressed []byte
+	switch compression {
+	case PayloadCompressionGzip:
+		buf := &bytes.Buffer{}
+		writer := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(writer)
+
+		writer.Reset(buf)
+		if _, err := writer.Write(blk.Payload.Value); err != nil {
+			return fmt.Errorf("gzip payload of block %s: %w", blk.AsRef(), err)
+		}
+		if err := writer.Close(); err != nil {
+			return fmt.Errorf("gzip payload of block %s: %w", blk.AsRef(), err)
+		}
+		compressed = buf.Bytes()
+	case PayloadCompressionZstd:
+		encoder, _ := zstdCodec()
+		compressed = encoder.EncodeAll(blk.Payload.Value, nil)
+	default:
+		return fmt.Errorf("unsupported payload compression %s", compression)
+	}
+
+	var out []byte
+	out = protowire.AppendTag(out, 1, protowire.BytesType)
+	out = protowire.AppendString(out, blk.Payload.TypeUrl)
+	out = protowire.AppendTag(out, 2, protowire.VarintType)
+	out = protowire.AppendVarint(out, uint64(compression))
+	out = protowire.AppendTag(out, 3, protowire.BytesType)
+	out = protowire.AppendBytes(out, compressed)
+
+	blk.Payload = &anypb.Any{TypeUrl: CompressedPayloadTypeURL, Value: out}
+	return nil
+}
+
+// DecompressedPayload returns the payload of `blk` with its value
+// decompressed and its original type, the block itself is left untouched
+// since it may be shared.
+func DecompressedPayload(blk *pbbstream.Block) (*anypb.Any, error) {
+	if blk.Payload == nil {
+		return nil, nil
+	}
+	if blk.Payload.TypeUrl != CompressedPayloadTypeURL {
+		return blk.Payload, nil
+	}
+
+	typeURL, compression, value, err := unwrapCompressedPayload(blk.Payload.Value)
+	if err != nil {
+		return nil, fmt.Errorf("compressed payload of block %s: %w", blk.AsRef(), err)
+	}
+
+	var out []byte
+	switch compression {
+	case PayloadCompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(value))
+		if err != nil {
+			return nil, fmt.Errorf("gunzip payload of block %s: %w", blk.AsRef(), err)
+		}
+		defer reader.Close()
+
+		out, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("gunzip payload of block %s: %w", blk.AsRef(), err)
+		}
+	case PayloadCompressionZstd:
+		_, decoder := zstdCodec()
+
+		out, err = decoder.DecodeAll(value, nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd decode payload of block %s: %w", blk.AsRef(), err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported payload compression %s on block %s", compression, blk.AsRef())
+	}
+
+	return &anypb.Any{TypeUrl: typeURL, Value: out}, nil
+}
+
+// PayloadTypeURL returns the type of the payload of `blk`, the one before
+// compression for a compressed payload. Empty when the block has no payload.
+func PayloadTypeURL(blk *pbbstream.Block) string {
+	if blk.Payload.GetTypeUrl() != CompressedPayloadTypeURL {
+		return blk.Payload.GetTypeUrl()
+	}
+
+	typeURL, _, _, err := unwrapCompressedPayload(blk.Payload.Value)
+	if err != nil {
+		return blk.Payload.TypeUrl
+	}
+	return typeURL
+}
+
+// PayloadSize returns the size of the payload value as stored in the block,
+// `compressed` tells if that is the compressed size.
+func PayloadSize(blk *pbbstream.Block) (size int, compressed bool) {
+	if blk.Payload == nil {
+		return 0, false
+	}
+
+	return len(blk.Payload.Value), blk.Payload.TypeUrl == CompressedPayloadTypeURL
+}
+
+// unwrapCompressedPayload decodes the fields of a CompressedPayloadTypeURL
+// value, see its doc for the layout.
+func unwrapCompressedPayload(data []byte) (typeURL string, compression PayloadCompression, value []byte, err error) {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return "", 0, nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			typeURL, n = protowire.ConsumeString(data)
+		case num == 2 && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(data)
+			compression = PayloadCompression(v)
+		case num == 3 && typ == protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return "", 0, nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return typeURL, compression, value, nil
+}
@@ -0,0 +1,57 @@
+package bstream
+
+import (
+	"strings"
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+func TestPayloadCompression_RoundTrip(t *testing.T) {
+	payload := &pbbstream.BlockMeta{
+		Number:   10,
+		Id:       strings.Repeat("a", 512),
+		ParentId: strings.Repeat("b", 512),
+	}
+	plain, err := proto.Marshal(payload)
+	require.NoError(t, err)
+
+	for _, compression := range []PayloadCompression{PayloadCompressionNone, PayloadCompressionGzip, PayloadCompressionZstd} {
+		t.Run(compression.String(), func(t *testing.T) {
+			defer func(previous PayloadCompression) { GetPayloadCompression = previous }(GetPayloadCompression)
+			GetPayloadCompression = compression
+
+			blk := TestBlock("0000000aa", "00000009a")
+			require.NoError(t, SetBlockPayload(blk, payload))
+
+			size, compressed := PayloadSize(blk)
+			assert.Equal(t, compression != PayloadCompressionNone, compressed)
+			if compressed {
+				assert.Less(t, size, len(plain))
+			} else {
+				assert.Equal(t, len(plain), size)
+			}
+
+			require.NoError(t, CompressBlockPayload(blk, compression), "compressing twice is a no-op")
+
+			decompressed, err := DecompressedPayload(blk)
+			require.NoError(t, err)
+			assert.Equal(t, plain, decompressed.Value)
+			assert.Equal(t, "type.googleapis.com/sf.bstream.v1.BlockMeta", decompressed.TypeUrl)
+			assert.Equal(t, "type.googleapis.com/sf.bstream.v1.BlockMeta", PayloadTypeURL(blk))
+
+			if compressed {
+				assert.Equal(t, CompressedPayloadTypeURL, blk.Payload.TypeUrl)
+				_, err := blk.Payload.UnmarshalNew()
+				assert.ErrorIs(t, err, protoregistry.NotFound, "raw consumers see an unknown type, not corrupt data")
+			}
+
+			out := ToProtocol[*pbbstream.BlockMeta](blk)
+			assert.True(t, proto.Equal(payload, out))
+		})
+	}
+}
@@ -44,6 +44,26 @@ func (b *Block) ToBlocKMeta() *BlockMeta {
 	}
 }
 
+// Header returns the header fields of the block, without its payload. The time
+// is zero when the block has no valid timestamp.
+func (b *Block) Header() BlockHeader {
+	if b == nil {
+		return BlockHeader{}
+	}
+
+	header := BlockHeader{
+		ID:        b.Id,
+		Number:    b.Number,
+		ParentID:  b.ParentId,
+		ParentNum: b.ParentNum,
+		LibNum:    b.LibNum,
+	}
+	if b.Timestamp.CheckValid() == nil {
+		header.Time = b.Timestamp.AsTime()
+	}
+	return header
+}
+
 func (b *Block) GetFirehoseBlockID() string           { return b.Id }
 func (b *Block) GetFirehoseBlockNumber() uint64       { return b.Number }
 func (b *Block) GetFirehoseBlockParentID() string     { return b.ParentId }
@@ -64,3 +84,25 @@ func (e BasicBlockRef) String() string {
 
 	return fmt.Sprintf("#%d (%s)", e.num, e.id)
 }
+
+// BlockHeader is a lightweight value copy of the header fields of a Block, to
+// pass around cheaply without retaining the payload.
+type BlockHeader struct {
+	ID        string
+	Number    uint64
+	ParentID  string
+	ParentNum uint64
+	LibNum    uint64
+	Time      time.Time
+}
+
+func (h BlockHeader) AsRef() BasicBlockRef {
+	return BasicBlockRef{h.ID, h.Number}
+}
+
+func (h BlockHeader) PreviousRef() *BasicBlockRef {
+	if h.ParentNum == 0 || h.ParentID == "" {
+		return &BasicBlockRef{"", 0}
+	}
+	return &BasicBlockRef{h.ParentID, h.ParentNum}
+}
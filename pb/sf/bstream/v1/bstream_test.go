@@ -0,0 +1,42 @@
+package pbbstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestBlock_Header(t *testing.T) {
+	blkTime := time.Date(2024, 1, 1, 0, 0, 5, 0, time.UTC)
+	blk := &Block{
+		Id:        "00000005a",
+		Number:    5,
+		ParentId:  "00000004a",
+		ParentNum: 4,
+		LibNum:    3,
+		Timestamp: timestamppb.New(blkTime),
+		Payload:   &anypb.Any{TypeUrl: "type.googleapis.com/some.Block", Value: []byte{0x01}},
+	}
+
+	header := blk.Header()
+	assert.Equal(t, BlockHeader{
+		ID:        "00000005a",
+		Number:    5,
+		ParentID:  "00000004a",
+		ParentNum: 4,
+		LibNum:    3,
+		Time:      blkTime,
+	}, header)
+	assert.Equal(t, BasicBlockRef{"00000005a", 5}, header.AsRef())
+	assert.Equal(t, &BasicBlockRef{"00000004a", 4}, header.PreviousRef())
+
+	blk.Timestamp = nil
+	assert.True(t, blk.Header().Time.IsZero(), "invalid timestamp gives a zero time")
+
+	var nilBlk *Block
+	assert.Equal(t, BlockHeader{}, nilBlk.Header())
+	assert.Equal(t, &BasicBlockRef{"", 0}, BlockHeader{ID: "00000001a", Number: 1}.PreviousRef())
+}
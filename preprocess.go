@@ -41,6 +41,13 @@ func (p *Preprocessor) ProcessBlock(blk *pbbstream.Block, obj interface{}) (err
 			return err
 		}
 	}
+	if attachedObj, ok := obj.(*AttachedObject); ok && attachedObj.Obj == nil {
+		newObj, err := p.preprocFunc(blk)
+		if err != nil {
+			return err
+		}
+		obj = NewAttachedObject(newObj, attachedObj.Attachments())
+	}
 	if forkableObj, ok := obj.(ForkableObject); ok {
 		if wrappedObj := forkableObj.WrappedObject(); wrappedObj == nil {
 			newWrappedObj, err := p.preprocFunc(blk)
@@ -51,6 +58,7 @@ func (p *Preprocessor) ProcessBlock(blk *pbbstream.Block, obj interface{}) (err
 				step:               forkableObj.Step(),
 				cursor:             forkableObj.Cursor(),
 				reorgJunctionBlock: forkableObj.ReorgJunctionBlock(),
+				attachments:        AttachmentsFromObject(forkableObj),
 				obj:                newWrappedObj,
 			}
 		}
@@ -62,6 +70,7 @@ type preprocessedForkableObject struct {
 	cursor             *Cursor
 	step               StepType
 	reorgJunctionBlock BlockRef
+	attachments        Attachments
 	obj                interface{}
 }
 
@@ -77,6 +86,10 @@ func (fobj *preprocessedForkableObject) Cursor() *Cursor {
 	return fobj.cursor
 }
 
+func (fobj *preprocessedForkableObject) Attachments() Attachments {
+	return fobj.attachments
+}
+
 func (fobj *preprocessedForkableObject) ReorgJunctionBlock() BlockRef {
 	return fobj.reorgJunctionBlock
 }
@@ -15,6 +15,7 @@
 package bstream
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -26,6 +27,11 @@ import (
 	"google.golang.org/protobuf/types/known/anypb"
 )
 
+// ErrCorruptBlock is wrapped by the errors of the block readers when a block
+// record was read but cannot be decoded, the reader is then positioned on the
+// next record and reading can go on.
+var ErrCorruptBlock = errors.New("corrupt block")
+
 // DBinBlockReader reads the dbin format where each element is assumed to be a `Block`.
 type DBinBlockReader struct {
 	src    *dbin.Reader
@@ -60,11 +66,11 @@ func (l *DBinBlockReader) Read() (*pbbstream.Block, error) {
 	return readMessage(l, func(message []byte) (*pbbstream.Block, error) {
 		blk := new(pbbstream.Block)
 		if err := proto.Unmarshal(message, blk); err != nil {
-			return nil, fmt.Errorf("unable to read block proto: %s", err)
+			return nil, fmt.Errorf("unable to read block proto: %s: %w", err, ErrCorruptBlock)
 		}
 
 		if err := supportLegacy(blk); err != nil {
-			return nil, fmt.Errorf("support legacy block: %s", err)
+			return nil, fmt.Errorf("support legacy block: %s: %w", err, ErrCorruptBlock)
 		}
 
 		return blk, nil
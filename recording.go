@@ -0,0 +1,214 @@
+package bstream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/shutter"
+	"google.golang.org/protobuf/proto"
+)
+
+// Recordings capture the exact sequence of blocks and steps received by a
+// handler, to replay it later when reproducing an issue:
+//
+//	header: "bsrc" | version (1 byte)
+//	record: cursor length (4 bytes) | cursor | junction length (4 bytes) | junction | block length (4 bytes) | block proto
+//
+// Integers are big endian. The cursor is in its `Cursor.String()` form and the
+// reorg junction block is `<num>:<id>`, both are empty when the recorded
+// object did not carry them.
+var recordingMagic = []byte("bsrc")
+
+const recordingVersion = 1
+
+// maxRecordingFieldLength protects against allocating huge buffers when
+// reading a corrupted recording.
+const maxRecordingFieldLength = 1 << 30
+
+// NewRecordingHandler returns a handler writing each block it receives to
+// `w`, along with its cursor and reorg junction block when the object carries
+// them, before passing it to `inner`. Read the recording back with a
+// ReplaySource. The handler fails if the recording cannot be written.
+//
+// The object itself is not recorded, replayed blocks carry a plain object
+// with the recorded step and cursor.
+func NewRecordingHandler(inner Handler, w io.Writer) Handler {
+	var lock sync.Mutex
+	wroteHeader := false
+
+	return HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		var record []byte
+		if !wroteHeader {
+			record = append(append(record, recordingMagic...), recordingVersion)
+		}
+
+		var cursor, junction string
+		if cursorable, ok := obj.(Cursorable); ok && !cursorable.Cursor().IsEmpty() {
+			cursor = cursorable.Cursor().String()
+		}
+		if stepable, ok := obj.(Stepable); ok {
+			if ref := stepable.ReorgJunctionBlock(); !IsEmpty(ref) {
+				junction = fmt.Sprintf("%d:%s", ref.Num(), ref.ID())
+			}
+		}
+
+		message, err := proto.Marshal(blk)
+		if err != nil {
+			return fmt.Errorf("unable to marshal proto block: %w", err)
+		}
+
+		record = appendRecordingField(record, []byte(cursor))
+		record = appendRecordingField(record, []byte(junction))
+		record = appendRecordingField(record, message)
+		if _, err := w.Write(record); err != nil {
+			return fmt.Errorf("unable to record block %s: %w", blk.AsRef(), err)
+		}
+		wroteHeader = true
+
+		return inner.ProcessBlock(blk, obj)
+	})
+}
+
+func appendRecordingField(record, field []byte) []byte {
+	record = binary.BigEndian.AppendUint32(record, uint32(len(field)))
+	return append(record, field...)
+}
+
+// ReplaySource sends the blocks of a recording made by a recording handler
+// to its handler, in the recorded order. Blocks recorded with a cursor are
+// sent with an object exposing that cursor, its step and the recorded reorg
+// junction block, the others with a nil object.
+//
+// The source shuts down with `io.EOF` once the whole recording was replayed.
+type ReplaySource struct {
+	*shutter.Shutter
+
+	reader  io.Reader
+	handler Handler
+}
+
+func NewReplaySource(r io.Reader, handler Handler) *ReplaySource {
+	return &ReplaySource{
+		Shutter: shutter.New(),
+		reader:  r,
+		handler: handler,
+	}
+}
+
+func (s *ReplaySource) Run() {
+	s.Shutdown(s.run())
+}
+
+func (s *ReplaySource) run() error {
+	src := bufio.NewReader(s.reader)
+
+	header := make([]byte, len(recordingMagic)+1)
+	if _, err := io.ReadFull(src, header); err != nil {
+		if err == io.EOF {
+			return io.EOF // empty recording, nothing was handled
+		}
+		return fmt.Errorf("unable to read recording header: %w", err)
+	}
+	if !bytes.Equal(header[:len(recordingMagic)], recordingMagic) {
+		return fmt.Errorf("not a blocks recording, invalid magic %q", header[:len(recordingMagic)])
+	}
+	if version := header[len(recordingMagic)]; version != recordingVersion {
+		return fmt.Errorf("unsupported blocks recording version %d", version)
+	}
+
+	for i := 0; ; i++ {
+		if s.IsTerminating() {
+			return nil
+		}
+
+		blk, obj, err := readRecord(src)
+		if err == io.EOF {
+			return io.EOF
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
+		}
+
+		if err := s.handler.ProcessBlock(blk, obj); err != nil {
+			return err
+		}
+	}
+}
+
+func readRecord(src *bufio.Reader) (*pbbstream.Block, interface{}, error) {
+	cursor, err := readRecordingField(src)
+	if err != nil {
+		if err == io.EOF {
+			return nil, nil, io.EOF
+		}
+		return nil, nil, fmt.Errorf("unable to read cursor: %w", err)
+	}
+	junction, err := readRecordingField(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read reorg junction block: %w", noEOF(err))
+	}
+	message, err := readRecordingField(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read block: %w", noEOF(err))
+	}
+
+	blk := new(pbbstream.Block)
+	if err := proto.Unmarshal(message, blk); err != nil {
+		return nil, nil, fmt.Errorf("unable to read block proto: %w", err)
+	}
+
+	if len(cursor) == 0 {
+		return blk, nil, nil
+	}
+
+	obj := &wrappedObject{}
+	if obj.cursor, err = FromString(string(cursor)); err != nil {
+		return nil, nil, fmt.Errorf("block %s: %w", blk.AsRef(), err)
+	}
+	if len(junction) != 0 {
+		numStr, id, _ := strings.Cut(string(junction), ":")
+		num, err := strconv.ParseUint(numStr, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("block %s: invalid reorg junction block num: %w", blk.AsRef(), err)
+		}
+		obj.reorgJunctionBlock = NewBlockRef(id, num)
+	}
+	return blk, obj, nil
+}
+
+func readRecordingField(src *bufio.Reader) ([]byte, error) {
+	lengthBytes := make([]byte, 4)
+	if _, err := io.ReadFull(src, lengthBytes); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(lengthBytes)
+	if length > maxRecordingFieldLength {
+		return nil, fmt.Errorf("field length %d too large", length)
+	}
+
+	field := make([]byte, length)
+	if _, err := io.ReadFull(src, field); err != nil {
+		return nil, noEOF(err)
+	}
+	return field, nil
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF, for reads in the middle of a
+// record.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package bstream
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRecordingHandler_Replay(t *testing.T) {
+	type handled struct {
+		blk *pbbstream.Block
+		obj interface{}
+	}
+
+	undoObj := &wrappedObject{
+		cursor:             testCursorObj(StepUndo, "00000003a", "00000001a").Cursor(),
+		reorgJunctionBlock: NewBlockRef("00000002a", 2),
+	}
+	input := []handled{
+		{TestBlockWithLIBNum("00000002a", "00000001a", 1), testCursorObj(StepNew, "00000002a", "00000001a")},
+		{TestBlockWithLIBNum("00000003a", "00000002a", 1), testCursorObj(StepNew, "00000003a", "00000001a")},
+		{TestBlockWithLIBNum("00000003a", "00000002a", 1), undoObj},
+		{TestBlockWithLIBNum("00000003b", "00000002a", 1), nil},
+	}
+
+	var recorded []handled
+	buf := bytes.NewBuffer(nil)
+	recorder := NewRecordingHandler(HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		recorded = append(recorded, handled{blk, obj})
+		return nil
+	}), buf)
+	for _, in := range input {
+		require.NoError(t, recorder.ProcessBlock(in.blk, in.obj))
+	}
+	assert.Equal(t, input, recorded, "inner handler receives the original blocks")
+
+	var replayed []handled
+	src := NewReplaySource(bytes.NewReader(buf.Bytes()), HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		replayed = append(replayed, handled{blk, obj})
+		return nil
+	}))
+	src.Run()
+	require.Equal(t, io.EOF, src.Err())
+
+	require.Len(t, replayed, len(input))
+	for i, in := range input {
+		assert.True(t, proto.Equal(in.blk, replayed[i].blk), "block %d", i)
+		if in.obj == nil {
+			assert.Nil(t, replayed[i].obj)
+			continue
+		}
+
+		expected, actual := in.obj.(ForkableObject), replayed[i].obj.(ForkableObject)
+		assert.Equal(t, expected.Step(), actual.Step())
+		assert.True(t, expected.Cursor().Equals(actual.Cursor()), "cursor %d", i)
+		assert.Equal(t, expected.Cursor().String(), actual.Cursor().String())
+	}
+	assert.Equal(t, "00000002a", replayed[2].obj.(Stepable).ReorgJunctionBlock().ID())
+	assert.Equal(t, uint64(2), replayed[2].obj.(Stepable).ReorgJunctionBlock().Num())
+}
+
+func TestReplaySource_Errors(t *testing.T) {
+	tests := []struct {
+		name          string
+		in            []byte
+		expectedError string
+	}{
+		{"empty", nil, ""},
+		{"invalid magic", []byte("dbin\x01"), "invalid magic"},
+		{"unknown version", []byte("bsrc\x02"), "unsupported blocks recording version 2"},
+		{"truncated record", []byte("bsrc\x01\x00\x00\x00\x00\x00"), "unexpected EOF"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := NewReplaySource(bytes.NewReader(test.in), HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+				return nil
+			}))
+			src.Run()
+
+			if test.expectedError == "" {
+				assert.Equal(t, io.EOF, src.Err())
+				return
+			}
+			require.Error(t, src.Err())
+			assert.Contains(t, src.Err().Error(), test.expectedError)
+		})
+	}
+}
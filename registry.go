@@ -1,16 +1,49 @@
 package bstream
 
+import (
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+)
+
 // bstreams.NewDBinBlockReader
 // var GetBlockReaderFactory BlockReaderFactory
 // bstream.NewDBinBlockWriter
 // var GetBlockWriterFactory BlockWriterFactory
 // var GetBlockWriterHeaderLen int
+
+// The variables below are the whole chain specific configuration of bstream,
+// chains set them once at startup. Block payloads need no setter nor decoder:
+// they are carried as `anypb.Any` and decoded with `ToProtocol`, only blocks
+// written under an older `PayloadVersion` may need `GetBlockDecoderByVersion`.
+
+// GetProtocolFirstStreamableBlock is the lowest block number of the chain that can be streamed
 var GetProtocolFirstStreamableBlock = uint64(0)
 var GetMaxNormalLIBDistance = uint64(1000)
+
+// GetMergedBlocksBundleSize is the number of blocks held by each merged blocks
+// file, it is the default bundle size of the FileSource
+var GetMergedBlocksBundleSize = uint64(100)
 var NormalizeBlockID = func(in string) string { // some chains have block IDs that optionally start with 0x or are case insensitive
 	return in
 }
 
+// GetBlockIDVerifier computes the ID of a block from its content, it is used
+// by `FileSourceWithIDVerification`, which fails when none is registered.
+var GetBlockIDVerifier func(blk *pbbstream.Block) (computedID string, err error)
+
+// GetBlockDecoderByVersion holds the decoders of the blocks whose payload
+// cannot be unmarshalled as is, keyed by the block `PayloadVersion`. During a
+// protocol upgrade, it lets `ToProtocol` read a store mixing blocks written
+// before and after the change: blocks of a registered version go through
+// their decoder, the others are unmarshalled from their payload. Decoders get
+// the block with its payload decompressed.
+var GetBlockDecoderByVersion = map[int32]BlockDecoderFunc{}
+
+// GetPayloadCompression is the compression applied to block payloads by
+// `SetBlockPayload`, none by default. Compressed payloads are stored, sent and
+// read back with the CompressedPayloadTypeURL type: once enabled, consumers of
+// `Block.Payload` must go through `DecompressedPayload` or `ToProtocol`.
+var GetPayloadCompression = PayloadCompressionNone
+
 func ValidateRegistry() error {
 
 	//if GetBlockReaderFactory == nil {
@@ -0,0 +1,77 @@
+package bstream
+
+import (
+	"fmt"
+	"sync"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+)
+
+type SamplingHandlerOption = func(h *SamplingHandler)
+
+// SamplingHandlerWithAllOtherSteps forwards every step that is not New (undo,
+// irreversible, stalled) to the inner handler, only New blocks are sampled.
+// Without it, those steps are dropped.
+func SamplingHandlerWithAllOtherSteps() SamplingHandlerOption {
+	return func(h *SamplingHandler) {
+		h.forwardOtherSteps = true
+	}
+}
+
+// SamplingHandler forwards only one New block out of `n` to its inner
+// handler, for cheap monitoring like liveness probes on a busy stream.
+// Objects that are not `Stepable` are treated as New.
+//
+// Since blocks are skipped, the cursors seen by the inner handler cannot be
+// used to resume a stream: resuming from a sampled cursor skips every block
+// that was not forwarded, and undo steps may refer to blocks it never saw.
+type SamplingHandler struct {
+	sync.Mutex
+
+	handler           Handler
+	n                 int
+	forwardOtherSteps bool
+
+	seenNew int
+}
+
+// NewSamplingHandler returns a handler forwarding the first New block it
+// receives, then every `n`th one.
+func NewSamplingHandler(inner Handler, n int, opts ...SamplingHandlerOption) *SamplingHandler {
+	if n < 1 {
+		panic(fmt.Errorf("invalid sampling rate %d, must be at least 1", n))
+	}
+
+	h := &SamplingHandler{
+		handler: inner,
+		n:       n,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *SamplingHandler) ProcessBlock(blk *pbbstream.Block, obj interface{}) error {
+	step := StepNew
+	if stepable, ok := obj.(Stepable); ok {
+		step = stepable.Step()
+	}
+
+	if !step.Matches(StepNew) {
+		if h.forwardOtherSteps {
+			return h.handler.ProcessBlock(blk, obj)
+		}
+		return nil
+	}
+
+	h.Lock()
+	sampled := h.seenNew%h.n == 0
+	h.seenNew++
+	h.Unlock()
+
+	if !sampled {
+		return nil
+	}
+	return h.handler.ProcessBlock(blk, obj)
+}
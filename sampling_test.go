@@ -0,0 +1,53 @@
+package bstream
+
+import (
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamplingHandler(t *testing.T) {
+	objs := []interface{}{
+		testCursorObj(StepNew, "00000001a", "00000001a"),
+		testCursorObj(StepNew, "00000002a", "00000002a"),
+		testCursorObj(StepIrreversible, "00000001a", "00000002a"),
+		testCursorObj(StepNew, "00000003a", "00000003a"),
+		testCursorObj(StepUndo, "00000003a", "00000003a"),
+		nil,
+		testCursorObj(StepNewIrreversible, "00000005a", "00000005a"),
+	}
+
+	run := func(t *testing.T, opts ...SamplingHandlerOption) (out []string) {
+		t.Helper()
+		h := NewSamplingHandler(HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			step := "none"
+			if obj != nil {
+				step = obj.(Stepable).Step().String()
+			}
+			out = append(out, step+":"+blk.Id)
+			return nil
+		}), 2, opts...)
+
+		for i, obj := range objs {
+			id := "none"
+			if obj != nil {
+				id = obj.(Cursorable).Cursor().Block.ID()
+			}
+			require.NoError(t, h.ProcessBlock(TestBlock(id, "x"), obj), "object %d", i)
+		}
+		return
+	}
+
+	assert.Equal(t, []string{"new:00000001a", "new:00000003a", "new,irreversible:00000005a"}, run(t))
+	assert.Equal(t, []string{
+		"new:00000001a",
+		"irreversible:00000001a",
+		"new:00000003a",
+		"undo:00000003a",
+		"new,irreversible:00000005a",
+	}, run(t, SamplingHandlerWithAllOtherSteps()))
+
+	assert.Panics(t, func() { NewSamplingHandler(nil, 0) })
+}
@@ -0,0 +1,98 @@
+package bstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/streamingfast/dstore"
+	"github.com/streamingfast/shutter"
+	"go.uber.org/zap"
+)
+
+// SingleFileSource streams the blocks of exactly one merged blocks file, then
+// shuts down with `io.EOF`. It never moves on to the next file, which makes it
+// handy to reprocess or debug a specific bundle.
+type SingleFileSource struct {
+	*shutter.Shutter
+
+	store    dstore.Store
+	filename string
+	handler  Handler
+	ctx      context.Context
+	logger   *zap.Logger
+}
+
+func NewSingleFileSource(store dstore.Store, filename string, handler Handler, logger *zap.Logger) *SingleFileSource {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &SingleFileSource{
+		store:    store,
+		filename: filename,
+		handler:  handler,
+		ctx:      ctx,
+		logger:   logger,
+		Shutter: shutter.New(
+			shutter.RegisterOnTerminating(func(_ error) {
+				cancel()
+			}),
+		),
+	}
+}
+
+func (s *SingleFileSource) Run() {
+	s.Shutdown(s.run())
+}
+
+func (s *SingleFileSource) run() error {
+	exists, err := s.store.FileExists(s.ctx, s.filename)
+	if err != nil {
+		return fmt.Errorf("checking merged blocks file %q: %w", s.filename, err)
+	}
+	if !exists {
+		return fmt.Errorf("merged blocks file %q not found", s.filename)
+	}
+
+	reader, err := s.store.OpenObject(s.ctx, s.filename)
+	if err != nil {
+		return fmt.Errorf("opening merged blocks file %q: %w", s.filename, err)
+	}
+	defer reader.Close()
+
+	blockReader, err := NewDBinBlockReader(reader)
+	if err != nil {
+		return fmt.Errorf("unable to create block reader for %q: %w", s.filename, err)
+	}
+
+	count := 0
+	for {
+		if s.IsTerminating() {
+			return nil
+		}
+
+		blk, err := blockReader.Read()
+		if blk != nil {
+			obj := &wrappedObject{
+				cursor: &Cursor{
+					Step:      StepNewIrreversible,
+					Block:     blk.AsRef(),
+					LIB:       blk.AsRef(),
+					HeadBlock: blk.AsRef(),
+				},
+			}
+			if err := s.handler.ProcessBlock(blk, obj); err != nil {
+				return err
+			}
+			count++
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				s.logger.Debug("single file source finished sending blocks", zap.String("filename", s.filename), zap.Int("count", count))
+				return io.EOF
+			}
+			return fmt.Errorf("reading merged blocks file %q: %w", s.filename, err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package bstream
+
+import (
+	"io"
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingleFileSource(t *testing.T) {
+	bs := dstore.NewMockStore(nil)
+	bs.SetFile(base(0), testBlocks(
+		TestBlockWithNumbers("1a", "00", 1, 0),
+		TestBlockWithNumbers("2a", "1a", 2, 0),
+	))
+	bs.SetFile(base(100), testBlocks(
+		TestBlockWithNumbers("103a", "2a", 103, 0),
+	))
+
+	var received []uint64
+	handler := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		require.Equal(t, StepNewIrreversible, obj.(Cursorable).Cursor().Step)
+		received = append(received, blk.Number)
+		return nil
+	})
+
+	src := NewSingleFileSource(bs, base(0), handler, zlog)
+	src.Run()
+
+	assert.Equal(t, io.EOF, src.Err())
+	assert.True(t, SourceEnded(src))
+	assert.Equal(t, []uint64{1, 2}, received)
+
+	missing := NewSingleFileSource(bs, base(200), handler, zlog)
+	missing.Run()
+	assert.Error(t, missing.Err())
+	assert.False(t, SourceEnded(missing))
+}
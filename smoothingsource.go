@@ -0,0 +1,155 @@
+package bstream
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/shutter"
+)
+
+// SmoothingSource wraps the source created by a SourceFactory, usually a live
+// one, and evens out the bursts of blocks it delivers after a hiccup, so the
+// handler sees a steadier flow.
+//
+// Blocks are sent in order. Each waiting block is sent `targetInterval / n`
+// after the previous one, `n` being the number of blocks waiting with it: a
+// burst is spread over the time the next block is expected, faster when more
+// blocks pile up, and a block arriving alone long enough after the previous
+// one is sent right away. To never fall behind the head, a block is never held
+// longer than `targetInterval`: once the oldest waiting block reaches that
+// lag, every waiting block is flushed at once. The added latency is then
+// bounded by `targetInterval`.
+//
+// When the wrapped source ends, the waiting blocks are flushed before the
+// SmoothingSource shuts down with the same error.
+type SmoothingSource struct {
+	*shutter.Shutter
+
+	source         Source
+	handler        Handler
+	targetInterval time.Duration
+
+	lock    sync.Mutex
+	waiting []*smoothedBlock
+	arrived chan struct{}
+}
+
+type smoothedBlock struct {
+	blk       *pbbstream.Block
+	obj       interface{}
+	arrivedAt time.Time
+}
+
+func NewSmoothingSource(sf SourceFactory, targetInterval time.Duration, h Handler) *SmoothingSource {
+	s := &SmoothingSource{
+		Shutter:        shutter.New(),
+		handler:        h,
+		targetInterval: targetInterval,
+		arrived:        make(chan struct{}, 1),
+	}
+	s.source = sf(HandlerFunc(s.processBlock))
+	s.OnTerminating(func(err error) {
+		s.source.Shutdown(err)
+	})
+
+	return s
+}
+
+func (s *SmoothingSource) Run() {
+	go s.source.Run()
+	s.Shutdown(s.release())
+}
+
+func (s *SmoothingSource) processBlock(blk *pbbstream.Block, obj interface{}) error {
+	if s.IsTerminating() {
+		return fmt.Errorf("smoothing source terminated, dropping block %s", blk.AsRef())
+	}
+
+	s.lock.Lock()
+	s.waiting = append(s.waiting, &smoothedBlock{blk: blk, obj: obj, arrivedAt: time.Now()})
+	s.lock.Unlock()
+
+	select {
+	case s.arrived <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// release sends the waiting blocks to the handler at their due time until the
+// wrapped source ends, then flushes the remaining ones.
+func (s *SmoothingSource) release() error {
+	var lastSent time.Time
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		next, due := s.nextDue(lastSent)
+		if next != nil && !due.After(time.Now()) {
+			s.lock.Lock()
+			s.waiting = s.waiting[1:]
+			s.lock.Unlock()
+
+			if err := s.handler.ProcessBlock(next.blk, next.obj); err != nil {
+				return err
+			}
+			lastSent = time.Now()
+			continue
+		}
+
+		var wakeUp <-chan time.Time
+		if next != nil {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(time.Until(due))
+			wakeUp = timer.C
+		}
+
+		select {
+		case <-s.Terminating():
+			return nil
+		case <-s.source.Terminated():
+			return s.flush(s.source.Err())
+		case <-s.arrived:
+		case <-wakeUp:
+		}
+	}
+}
+
+// nextDue returns the first waiting block, nil if none, and when it must be
+// sent.
+func (s *SmoothingSource) nextDue(lastSent time.Time) (*smoothedBlock, time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.waiting) == 0 {
+		return nil, time.Time{}
+	}
+
+	next := s.waiting[0]
+	due := lastSent.Add(s.targetInterval / time.Duration(len(s.waiting)))
+	if latest := next.arrivedAt.Add(s.targetInterval); due.After(latest) {
+		due = latest
+	}
+	return next, due
+}
+
+func (s *SmoothingSource) flush(sourceErr error) error {
+	s.lock.Lock()
+	waiting := s.waiting
+	s.waiting = nil
+	s.lock.Unlock()
+
+	for _, next := range waiting {
+		if err := s.handler.ProcessBlock(next.blk, next.obj); err != nil {
+			return err
+		}
+	}
+	return sourceErr
+}
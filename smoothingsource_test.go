@@ -0,0 +1,89 @@
+package bstream
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSmoothingSource(t *testing.T) {
+	blocks := make(chan *pbbstream.Block, 10)
+	interval := 200 * time.Millisecond
+
+	var lock sync.Mutex
+	var received []string
+	var receivedAt []time.Time
+	src := NewSmoothingSource(func(h Handler) Source {
+		return NewChannelSource(blocks, h)
+	}, interval, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		lock.Lock()
+		defer lock.Unlock()
+		received = append(received, blk.Id)
+		receivedAt = append(receivedAt, time.Now())
+		return nil
+	}))
+	receivedCount := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(received)
+	}
+
+	go src.Run()
+
+	burst := time.Now()
+	blocks <- TestBlock("00000001a", "00000000a")
+	blocks <- TestBlock("00000002a", "00000001a")
+	blocks <- TestBlock("00000003a", "00000002a")
+	blocks <- TestBlock("00000004a", "00000003a")
+	require.Eventually(t, func() bool { return receivedCount() == 4 }, time.Second, time.Millisecond)
+
+	lock.Lock()
+	assert.Equal(t, []string{"00000001a", "00000002a", "00000003a", "00000004a"}, received)
+	assert.Less(t, receivedAt[0].Sub(burst), interval/4, "first block of a burst is sent right away")
+	assert.Greater(t, receivedAt[3].Sub(burst), interval/2, "burst should be spread")
+	assert.Less(t, receivedAt[3].Sub(burst), interval+100*time.Millisecond, "no block is held longer than the interval")
+	lock.Unlock()
+
+	time.Sleep(interval)
+	alone := time.Now()
+	blocks <- TestBlock("00000005a", "00000004a")
+	require.Eventually(t, func() bool { return receivedCount() == 5 }, time.Second, time.Millisecond)
+	lock.Lock()
+	assert.Less(t, receivedAt[4].Sub(alone), interval/4, "block arriving alone is sent right away")
+	lock.Unlock()
+
+	close(blocks)
+	<-src.Terminated()
+	assert.Equal(t, io.EOF, src.Err())
+}
+
+func TestSmoothingSource_FlushOnSourceEnd(t *testing.T) {
+	blocks := make(chan *pbbstream.Block, 10)
+
+	var received []string
+	src := NewSmoothingSource(func(h Handler) Source {
+		return NewChannelSource(blocks, h)
+	}, time.Hour, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		received = append(received, blk.Id)
+		return nil
+	}))
+
+	blocks <- TestBlock("00000001a", "00000000a")
+	blocks <- TestBlock("00000002a", "00000001a")
+	blocks <- TestBlock("00000003a", "00000002a")
+	close(blocks)
+	go src.Run()
+
+	select {
+	case <-src.Terminated():
+	case <-time.After(time.Second):
+		t.Fatal("waiting blocks should be flushed when the source ends")
+	}
+	assert.Equal(t, io.EOF, src.Err())
+	assert.Equal(t, []string{"00000001a", "00000002a", "00000003a"}, received)
+}
@@ -0,0 +1,100 @@
+package bstream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+)
+
+// DefaultStoreHealthCheckInterval is how often `FileSourceWithStoreHealth`
+// rechecks the stores when no interval is given.
+const DefaultStoreHealthCheckInterval = 30 * time.Second
+
+// FileSourceWithSecondaryStores adds mirrors of the blocks store, in order of
+// preference after it. Each merged blocks file is read from the first healthy
+// store, see `FileSourceWithStoreHealth`: without a health checker, every store
+// is considered healthy and the blocks store always serves the reads.
+func FileSourceWithSecondaryStores(stores ...dstore.Store) FileSourceOption {
+	return func(s *FileSource) {
+		s.secondaryStores = append(s.secondaryStores, stores...)
+	}
+}
+
+// FileSourceWithStoreHealth skips the stores for which `checker` returns
+// false, the next healthy one in order of preference serves the reads instead
+// of failing every attempt against a down mirror. The stores are checked once
+// when the source starts, then rechecked out-of-band every `interval`, or
+// every `DefaultStoreHealthCheckInterval` when it is 0. When no store is
+// healthy, the source waits for the retry delay instead of reading.
+//
+// Health is binary and the order of preference fixed: a slow but healthy
+// store keeps serving the reads over a faster one after it.
+func FileSourceWithStoreHealth(interval time.Duration, checker func(store dstore.Store) bool) FileSourceOption {
+	return func(s *FileSource) {
+		if interval <= 0 {
+			interval = DefaultStoreHealthCheckInterval
+		}
+		s.storeHealthChecker = checker
+		s.storeHealthInterval = interval
+	}
+}
+
+// storeHealth tracks which of the stores of a FileSource are healthy
+type storeHealth struct {
+	lock    sync.Mutex
+	stores  []dstore.Store
+	healthy []bool
+}
+
+func newStoreHealth(stores []dstore.Store) *storeHealth {
+	healthy := make([]bool, len(stores))
+	for i := range healthy {
+		healthy[i] = true
+	}
+	return &storeHealth{
+		stores:  stores,
+		healthy: healthy,
+	}
+}
+
+// preferred returns the first healthy store, nil if none is
+func (h *storeHealth) preferred() dstore.Store {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, store := range h.stores {
+		if h.healthy[i] {
+			return store
+		}
+	}
+	return nil
+}
+
+func (h *storeHealth) check(checker func(store dstore.Store) bool, logger *zap.Logger) {
+	for i, store := range h.stores {
+		healthy := checker(store)
+
+		h.lock.Lock()
+		if healthy != h.healthy[i] {
+			logger.Info("blocks store health changed", zap.Int("store_index", i), zap.Bool("healthy", healthy))
+		}
+		h.healthy[i] = healthy
+		h.lock.Unlock()
+	}
+}
+
+func (s *FileSource) watchStoreHealth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.Terminating():
+			return
+		case <-ticker.C:
+			s.storeHealth.check(s.storeHealthChecker, s.logger)
+		}
+	}
+}
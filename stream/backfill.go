@@ -0,0 +1,55 @@
+package stream
+
+// RangeAssignment is the inclusive block range a backfill worker streams,
+// use `StartBlock` as the start block of `New` and `StopBlock` with
+// `WithStopBlock`.
+type RangeAssignment struct {
+	StartBlock uint64
+	StopBlock  uint64
+}
+
+// PlanBackfill divides the inclusive range `[start, stop]` between at most
+// `workers` workers. Ranges are made of whole bundles of `bundleSize` blocks,
+// so no merged blocks file is read by two workers, except for the first and
+// last ones which are cut at `start` and `stop`. Bundles are spread evenly,
+// the first workers getting one more bundle when they do not divide evenly,
+// and there are fewer assignments than workers when there are fewer bundles.
+//
+// It returns nil when `stop` is below `start`, or when `bundleSize` or
+// `workers` is zero.
+func PlanBackfill(start, stop, bundleSize uint64, workers int) (out []RangeAssignment) {
+	if stop < start || bundleSize == 0 || workers <= 0 {
+		return nil
+	}
+
+	firstBundle := start / bundleSize
+	bundleCount := stop/bundleSize - firstBundle + 1
+	if uint64(workers) > bundleCount {
+		workers = int(bundleCount)
+	}
+
+	perWorker := bundleCount / uint64(workers)
+	remainder := bundleCount % uint64(workers)
+
+	bundle := firstBundle
+	for i := uint64(0); i < uint64(workers); i++ {
+		count := perWorker
+		if i < remainder {
+			count++
+		}
+
+		assignment := RangeAssignment{
+			StartBlock: bundle * bundleSize,
+			StopBlock:  (bundle+count)*bundleSize - 1,
+		}
+		if assignment.StartBlock < start {
+			assignment.StartBlock = start
+		}
+		if assignment.StopBlock > stop {
+			assignment.StopBlock = stop
+		}
+		out = append(out, assignment)
+		bundle += count
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanBackfill(t *testing.T) {
+	cases := []struct {
+		name        string
+		start, stop uint64
+		bundleSize  uint64
+		workers     int
+		expected    []RangeAssignment
+	}{
+		{
+			name:       "even division",
+			start:      0,
+			stop:       399,
+			bundleSize: 100,
+			workers:    2,
+			expected:   []RangeAssignment{{0, 199}, {200, 399}},
+		},
+		{
+			name:       "uneven division",
+			start:      150,
+			stop:       849,
+			bundleSize: 100,
+			workers:    3,
+			expected:   []RangeAssignment{{150, 399}, {400, 699}, {700, 849}},
+		},
+		{
+			name:       "range smaller than one bundle",
+			start:      110,
+			stop:       120,
+			bundleSize: 100,
+			workers:    4,
+			expected:   []RangeAssignment{{110, 120}},
+		},
+		{
+			name:       "fewer bundles than workers",
+			start:      99,
+			stop:       100,
+			bundleSize: 100,
+			workers:    4,
+			expected:   []RangeAssignment{{99, 99}, {100, 100}},
+		},
+		{
+			name:       "stop before start",
+			start:      100,
+			stop:       99,
+			bundleSize: 100,
+			workers:    4,
+		},
+		{
+			name:       "no worker",
+			start:      0,
+			stop:       99,
+			bundleSize: 100,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, PlanBackfill(c.start, c.stop, c.bundleSize, c.workers))
+		})
+	}
+}
@@ -1,8 +1,9 @@
 package stream
 
 import (
-	"errors"
 	"fmt"
+
+	"github.com/streamingfast/bstream"
 )
 
 type ErrInvalidArg struct {
@@ -19,4 +20,6 @@ func (e *ErrInvalidArg) Error() string {
 	return e.message
 }
 
-var ErrStopBlockReached = errors.New("stop block reached")
+// ErrStopBlockReached is the same error as `bstream.ErrStopBlockReached` so that
+// `bstream.IsNormalSourceEnd` classifies it as a normal completion.
+var ErrStopBlockReached = bstream.ErrStopBlockReached
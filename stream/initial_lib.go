@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"fmt"
+
+	"github.com/streamingfast/bstream"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"go.uber.org/zap"
+)
+
+// initialLIBObject is the object of the StepIrreversible event sent for the
+// initial LIB block, see `WithEmitInitialLIB`
+type initialLIBObject struct {
+	cursor *bstream.Cursor
+	obj    interface{}
+}
+
+func (o *initialLIBObject) Step() bstream.StepType               { return bstream.StepIrreversible }
+func (o *initialLIBObject) FinalBlockHeight() uint64             { return o.cursor.LIB.Num() }
+func (o *initialLIBObject) ReorgJunctionBlock() bstream.BlockRef { return nil }
+func (o *initialLIBObject) Cursor() *bstream.Cursor              { return o.cursor }
+func (o *initialLIBObject) WrappedObject() interface{}           { return o.obj }
+
+// emitInitialLIBHandler sends the LIB of the first block it receives as a
+// StepIrreversible event before it, unless that first block is already final.
+func (s *Stream) emitInitialLIBHandler(h bstream.Handler) bstream.Handler {
+	first := true
+	return bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		if !first {
+			return h.ProcessBlock(blk, obj)
+		}
+		first = false
+
+		stepable, ok := obj.(bstream.Stepable)
+		if !ok || stepable.Step().Matches(bstream.StepIrreversible) {
+			return h.ProcessBlock(blk, obj)
+		}
+		cursorable, ok := obj.(bstream.Cursorable)
+		if !ok || cursorable.Cursor().IsEmpty() {
+			return h.ProcessBlock(blk, obj)
+		}
+
+		cursor := cursorable.Cursor()
+		libBlock := s.blockGetter(cursor.LIB.Num(), cursor.LIB.ID())
+		if libBlock == nil {
+			s.logger.Warn("cannot find initial LIB block, not emitting it", zap.Stringer("lib", cursor.LIB))
+			return h.ProcessBlock(blk, obj)
+		}
+
+		var libObj interface{}
+		if s.preprocessFunc != nil {
+			var err error
+			if libObj, err = s.preprocessFunc(libBlock); err != nil {
+				return fmt.Errorf("preprocess initial LIB block %s: %w", libBlock.AsRef(), err)
+			}
+		}
+
+		libCursor := &bstream.Cursor{
+			Step:      bstream.StepIrreversible,
+			Block:     cursor.LIB,
+			HeadBlock: cursor.HeadBlock,
+			LIB:       cursor.LIB,
+		}
+		if err := h.ProcessBlock(libBlock, &initialLIBObject{cursor: libCursor, obj: libObj}); err != nil {
+			return err
+		}
+		return h.ProcessBlock(blk, obj)
+	})
+}
@@ -7,6 +7,10 @@ import (
 
 const DefaultPreprocessFuncThreadNumber = 4
 
+// DefaultHandoffDedupWindow is the number of last blocks from the merged
+// blocks files that are not sent again if the live blocks start with them.
+const DefaultHandoffDedupWindow = 10
+
 type Option = func(s *Stream)
 
 func WithPreprocessFunc(pp bstream.PreprocessFunc, threads int) Option {
@@ -61,3 +65,33 @@ func WithStopBlock(stopBlockNum uint64) Option { //inclusive
 		s.stopBlockNum = stopBlockNum
 	}
 }
+
+// WithTracer covers the preprocessing and the handling of each block with
+// spans, nothing is traced when not set.
+func WithTracer(tracer bstream.Tracer) Option {
+	return func(s *Stream) {
+		s.spanTracer = tracer
+	}
+}
+
+// WithEmitInitialLIB sends the LIB of the first block of the stream as a
+// StepIrreversible event before it, giving a fresh consumer a known final
+// starting point. Nothing is added when the first block is already final.
+// The LIB block is taken from the hub, it goes through the preprocess func
+// but bypasses the step filters, its cursor has the head block of the first
+// block cursor so it is coherent with the following ones.
+func WithEmitInitialLIB() Option {
+	return func(s *Stream) {
+		s.emitInitialLIB = true
+	}
+}
+
+// WithHandoffDedupWindow sets how many of the last blocks read from the merged
+// blocks files are not sent again if the live blocks start with them, when
+// the stream switches to the live blocks. Zero disables it. Defaults to
+// DefaultHandoffDedupWindow.
+func WithHandoffDedupWindow(n int) Option {
+	return func(s *Stream) {
+		s.handoffDedupWindow = n
+	}
+}
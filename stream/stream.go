@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/streamingfast/bstream"
 	"github.com/streamingfast/bstream/hub"
@@ -17,6 +18,7 @@ type Stream struct {
 	liveSourceFactory bstream.ForkableSourceFactory
 
 	currentHeadGetter func() uint64
+	blockGetter       func(num uint64, id string) *pbbstream.Block
 
 	startBlockNum int64
 	handler       bstream.Handler
@@ -33,6 +35,15 @@ type Stream struct {
 	finalBlocksOnly      bool
 	customStepTypeFilter *bstream.StepType
 
+	spanTracer bstream.Tracer
+
+	emitInitialLIB bool
+
+	handoffDedupWindow int
+
+	lastCursorLock sync.Mutex
+	lastCursor     *bstream.Cursor
+
 	logger *zap.Logger
 }
 
@@ -45,23 +56,34 @@ func New(
 	options ...Option) *Stream {
 
 	s := &Stream{
-		liveSourceFactory: hub,
-		currentHeadGetter: hub.HeadNum,
-		startBlockNum:     startBlockNum,
-		handler:           handler,
-		logger:            zap.NewNop(),
+		liveSourceFactory:  hub,
+		currentHeadGetter:  hub.HeadNum,
+		blockGetter:        hub.GetBlock,
+		startBlockNum:      startBlockNum,
+		handler:            handler,
+		handoffDedupWindow: DefaultHandoffDedupWindow,
+		logger:             zap.NewNop(),
 	}
 
 	for _, option := range options {
 		option(s)
 	}
 
+	if s.spanTracer != nil {
+		s.handler = bstream.NewTracedHandler("stream.handler", s.spanTracer, s.handler)
+		s.preprocessFunc = bstream.NewTracedPreprocessFunc("stream.preprocess", s.spanTracer, s.preprocessFunc)
+	}
+
 	var fileSourceOptions []bstream.FileSourceOption
 	if s.stopBlockNum != 0 {
 		fileSourceOptions = append(fileSourceOptions, bstream.FileSourceWithStopBlock(s.stopBlockNum)) // more efficient than using our own
 	}
 	if s.preprocessFunc != nil {
 		fileSourceOptions = append(fileSourceOptions, bstream.FileSourceWithConcurrentPreprocess(s.preprocessFunc, s.preprocessThreads))
+		if !s.cursor.IsEmpty() && !s.cursorIsTarget {
+			// blocks below the cursor are mostly read to resolve it, the ones sent are preprocessed by the stream Preprocessor
+			fileSourceOptions = append(fileSourceOptions, bstream.FileSourceWithPreprocessFromBlock(s.cursor.Block.Num()))
+		}
 	}
 	if s.blockIndexProvider != nil {
 		fileSourceOptions = append(fileSourceOptions, bstream.FileSourceWithBlockIndexProvider(s.blockIndexProvider))
@@ -93,8 +115,12 @@ func (s *Stream) Run(ctx context.Context) error {
 	}()
 
 	source.Run()
+	if bstream.SourceEnded(source) {
+		s.logger.Debug("source completed", zap.NamedError("reason", source.Err()))
+	} else {
+		s.logger.Debug("source shutting down", zap.Error(source.Err()))
+	}
 	if err := source.Err(); err != nil {
-		s.logger.Debug("source shutting down", zap.Error(err))
 		if errors.Is(err, bstream.ErrResolveCursor) {
 			return &ErrInvalidArg{message: err.Error()}
 		}
@@ -122,7 +148,10 @@ func (s *Stream) createSource() (bstream.Source, error) {
 
 	hasCursor := !s.cursor.IsEmpty()
 
-	h := s.handler
+	h := s.lastCursorHandler(s.handler)
+	if s.emitInitialLIB {
+		h = s.emitInitialLIBHandler(h)
+	}
 	if s.stopBlockNum != 0 {
 		h = stopBlockHandler(s.stopBlockNum, h)
 	}
@@ -151,10 +180,39 @@ func (s *Stream) createSource() (bstream.Source, error) {
 		s.cursor,
 		s.cursorIsTarget,
 		s.logger,
+		bstream.JoiningSourceWithHandoffDedupWindow(s.handoffDedupWindow),
 	), nil
 
 }
 
+// LastCursor returns the cursor of the last block the handler processed
+// successfully, an empty cursor before any block did. It can be called while
+// the stream runs, ex: to snapshot its progress on shutdown.
+func (s *Stream) LastCursor() *bstream.Cursor {
+	s.lastCursorLock.Lock()
+	defer s.lastCursorLock.Unlock()
+
+	if s.lastCursor == nil {
+		return bstream.EmptyCursor
+	}
+	return s.lastCursor
+}
+
+func (s *Stream) lastCursorHandler(h bstream.Handler) bstream.Handler {
+	return bstream.HandlerFunc(func(block *pbbstream.Block, obj interface{}) error {
+		if err := h.ProcessBlock(block, obj); err != nil {
+			return err
+		}
+
+		if cursorable, ok := obj.(bstream.Cursorable); ok {
+			s.lastCursorLock.Lock()
+			s.lastCursor = cursorable.Cursor()
+			s.lastCursorLock.Unlock()
+		}
+		return nil
+	})
+}
+
 func resolveNegativeStartBlockNum(startBlockNum int64, currentHeadGetter func() uint64) (uint64, error) {
 	if startBlockNum < 0 {
 		if currentHeadGetter == nil {
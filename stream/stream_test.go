@@ -0,0 +1,221 @@
+package stream
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/bstream/hub"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestHub returns a ready hub holding blocks 3 to 10, with LIB 4
+func newTestHub(t *testing.T) *hub.ForkableHub {
+	t.Helper()
+
+	lsf := bstream.NewTestSourceFactory()
+	obsf := bstream.NewTestSourceFactory()
+	fh := hub.NewForkableHub(lsf.NewSource, bstream.SourceFromNumFactory(obsf.SourceFromBlockNum), 10)
+	go fh.Run()
+	t.Cleanup(func() { fh.Shutdown(nil) })
+
+	ls := <-lsf.Created
+	go func() {
+		obs := <-obsf.Created
+		for _, blk := range []*pbbstream.Block{
+			bstream.TestBlockWithLIBNum("00000003", "00000002", 2),
+			bstream.TestBlockWithLIBNum("00000004", "00000003", 2),
+			bstream.TestBlockWithLIBNum("00000005", "00000004", 2),
+			bstream.TestBlockWithLIBNum("00000008", "00000005", 3),
+		} {
+			assert.NoError(t, obs.Push(blk, nil))
+		}
+		obs.Shutdown(io.EOF)
+	}()
+
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("00000009", "00000008", 3), nil))
+	require.NoError(t, ls.Push(bstream.TestBlockWithLIBNum("0000000a", "00000009", 4), nil))
+
+	select {
+	case <-fh.Initialized():
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for hub to be ready")
+	}
+	return fh
+}
+
+type streamedBlock struct {
+	id     string
+	step   bstream.StepType
+	cursor *bstream.Cursor
+}
+
+func runTestStream(t *testing.T, fh *hub.ForkableHub, startBlockNum int64, opts ...Option) ([]streamedBlock, error) {
+	t.Helper()
+
+	var out []streamedBlock
+	handler := bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		out = append(out, streamedBlock{
+			id:     blk.Id,
+			step:   obj.(bstream.Stepable).Step(),
+			cursor: obj.(bstream.Cursorable).Cursor(),
+		})
+		return nil
+	})
+
+	s := New(nil, dstore.NewMockStore(nil), fh, startBlockNum, handler, opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return out, s.Run(ctx)
+}
+
+func TestStream_WithEmitInitialLIB(t *testing.T) {
+	fh := newTestHub(t)
+
+	blocks, err := runTestStream(t, fh, 9, WithEmitInitialLIB(), WithStopBlock(10))
+	require.ErrorIs(t, err, ErrStopBlockReached)
+	require.NotEmpty(t, blocks)
+
+	first := blocks[0]
+	assert.Equal(t, bstream.StepIrreversible, first.step)
+	assert.Equal(t, first.cursor.LIB.ID(), first.id, "first event is the LIB")
+	assert.Equal(t, first.cursor.Block.ID(), first.id)
+	require.NoError(t, first.cursor.Validate())
+
+	var ids []string
+	for _, blk := range blocks[1:] {
+		assert.Equal(t, bstream.StepNew, blk.step)
+		assert.GreaterOrEqual(t, blk.cursor.LIB.Num(), first.cursor.LIB.Num(), "LIB never goes back")
+		ids = append(ids, blk.id)
+	}
+	assert.Equal(t, []string{"00000009", "0000000a"}, ids)
+
+	resumed, err := runTestStream(t, fh, 0, WithCursor(first.cursor), WithStopBlock(10))
+	require.ErrorIs(t, err, ErrStopBlockReached)
+	var resumedIDs []string
+	for _, blk := range resumed {
+		resumedIDs = append(resumedIDs, blk.id)
+	}
+	assert.Equal(t, []string{"00000005", "00000008", "00000009", "0000000a"}, resumedIDs, "resuming from the LIB event sends the blocks after it")
+}
+
+func TestStream_emitInitialLIBHandler_NoStep(t *testing.T) {
+	s := &Stream{blockGetter: func(num uint64, id string) *pbbstream.Block {
+		t.Fatal("no LIB to look up")
+		return nil
+	}}
+
+	var seen []interface{}
+	h := s.emitInitialLIBHandler(bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		seen = append(seen, obj)
+		return nil
+	}))
+
+	require.NoError(t, h.ProcessBlock(bstream.TestBlock("00000003", "00000002"), nil))
+	assert.Equal(t, []interface{}{nil}, seen)
+}
+
+func TestStream_LastCursor_Concurrent(t *testing.T) {
+	fh := newTestHub(t)
+
+	var lastSeen *bstream.Cursor
+	handler := bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		lastSeen = obj.(bstream.Cursorable).Cursor()
+		return nil
+	})
+	s := New(nil, dstore.NewMockStore(nil), fh, 5, handler, WithStopBlock(10))
+	assert.True(t, s.LastCursor().IsEmpty())
+
+	stop := make(chan struct{})
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if cursor := s.LastCursor(); !cursor.IsEmpty() {
+				assert.NoError(t, cursor.Validate())
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := s.Run(ctx)
+	close(stop)
+	<-readerDone
+
+	require.ErrorIs(t, err, ErrStopBlockReached)
+	assert.Equal(t, lastSeen, s.LastCursor())
+	assert.Equal(t, "0000000a", s.LastCursor().Block.ID())
+}
+
+type testStepObject bstream.StepType
+
+func (o testStepObject) Step() bstream.StepType               { return bstream.StepType(o) }
+func (o testStepObject) FinalBlockHeight() uint64             { return 0 }
+func (o testStepObject) ReorgJunctionBlock() bstream.BlockRef { return nil }
+
+func TestStream_HandoffDedup(t *testing.T) {
+	run := func(t *testing.T, opts ...Option) (received []string) {
+		fileSF := bstream.NewTestSourceFactory()
+		liveSF := bstream.NewTestSourceFactory()
+		liveSF.LowestBlkNum = 4
+
+		var liveSrc *bstream.TestSource
+		liveSF.FromBlockNumFunc = func(num uint64, h bstream.Handler) bstream.Source {
+			if num == 4 {
+				liveSrc = bstream.NewTestSource(h)
+				return liveSrc
+			}
+			return nil
+		}
+
+		handler := bstream.HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+			received = append(received, blk.Id)
+			return nil
+		})
+		s := New(nil, dstore.NewMockStore(nil), newTestHub(t), 2, handler, opts...)
+		s.fileSourceFactory = fileSF
+		s.liveSourceFactory = liveSF
+
+		done := make(chan error)
+		go func() { done <- s.Run(context.Background()) }()
+
+		fileSrc := <-fileSF.Created
+		require.NoError(t, fileSrc.Push(bstream.TestBlock("00000002a", "00000001a"), testStepObject(bstream.StepNewIrreversible)))
+		require.NoError(t, fileSrc.Push(bstream.TestBlock("00000003a", "00000002a"), testStepObject(bstream.StepNewIrreversible)))
+		require.Error(t, fileSrc.Push(bstream.TestBlock("00000004a", "00000003a"), testStepObject(bstream.StepNewIrreversible)))
+
+		// live blocks starting a bit before the join block
+		require.NoError(t, liveSrc.Push(bstream.TestBlock("00000003a", "00000002a"), testStepObject(bstream.StepNew)))
+		require.NoError(t, liveSrc.Push(bstream.TestBlock("00000004a", "00000003a"), testStepObject(bstream.StepNew)))
+		require.NoError(t, liveSrc.Push(bstream.TestBlock("00000005a", "00000004a"), testStepObject(bstream.StepNew)))
+		liveSrc.Shutdown(nil)
+
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for stream to end")
+		}
+		return received
+	}
+
+	t.Run("default", func(t *testing.T) {
+		assert.Equal(t, []string{"00000002a", "00000003a", "00000004a", "00000005a"}, run(t))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		assert.Equal(t, []string{"00000002a", "00000003a", "00000003a", "00000004a", "00000005a"}, run(t, WithHandoffDedupWindow(0)))
+	})
+}
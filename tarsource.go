@@ -0,0 +1,170 @@
+package bstream
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/streamingfast/shutter"
+	"go.uber.org/zap"
+)
+
+// TarArchiveSource streams the blocks of the merged blocks files and one-block
+// files packaged in a tar archive, without unpacking it to a store first.
+// Entries are read in archive order and their blocks sent in file order, so
+// the archive must be built in block order for the blocks to flow in order.
+//
+// The format of each entry is detected from its content: dbin or checksummed
+// blocks files, optionally gzip or zstd compressed. Entries in another format
+// are skipped. Entries named like one-block files are sent with a nil object,
+// the blocks of all other entries are considered final and carry a
+// StepNewIrreversible cursor, like the ones of a FileSource.
+//
+// The source shuts down with `io.EOF` once the whole archive was read.
+type TarArchiveSource struct {
+	*shutter.Shutter
+
+	reader  io.Reader
+	handler Handler
+	logger  *zap.Logger
+}
+
+func NewTarArchiveSource(r io.Reader, handler Handler, logger *zap.Logger) *TarArchiveSource {
+	return &TarArchiveSource{
+		Shutter: shutter.New(),
+		reader:  r,
+		handler: handler,
+		logger:  logger,
+	}
+}
+
+func (s *TarArchiveSource) Run() {
+	s.Shutdown(s.run())
+}
+
+func (s *TarArchiveSource) run() error {
+	archive := tar.NewReader(s.reader)
+	for {
+		if s.IsTerminating() {
+			return nil
+		}
+
+		header, err := archive.Next()
+		if err == io.EOF {
+			s.logger.Debug("tar archive source finished sending blocks")
+			return io.EOF
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := s.streamEntry(header.Name, archive); err != nil {
+			return fmt.Errorf("entry %q: %w", header.Name, err)
+		}
+	}
+}
+
+func (s *TarArchiveSource) streamEntry(name string, entry io.Reader) error {
+	content, closeContent, err := decompressedEntry(entry)
+	if err != nil {
+		return err
+	}
+	defer closeContent()
+
+	blockReader, err := detectedBlockReader(content)
+	if err != nil {
+		return err
+	}
+	if blockReader == nil {
+		s.logger.Debug("skipping tar entry not holding blocks", zap.String("name", name))
+		return nil
+	}
+
+	baseName, _, _ := strings.Cut(path.Base(name), ".")
+	_, _, _, _, _, err = ParseFilename(baseName)
+	oneBlockFile := err == nil
+
+	for {
+		if s.IsTerminating() {
+			return nil
+		}
+
+		blk, err := blockReader.Read()
+		if blk != nil {
+			var obj interface{}
+			if !oneBlockFile {
+				obj = &wrappedObject{
+					cursor: &Cursor{
+						Step:      StepNewIrreversible,
+						Block:     blk.AsRef(),
+						LIB:       blk.AsRef(),
+						HeadBlock: blk.AsRef(),
+					},
+				}
+			}
+			if err := s.handler.ProcessBlock(blk, obj); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("reading blocks: %w", err)
+		}
+	}
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	dbinMagic = []byte("dbin")
+)
+
+// decompressedEntry returns a reader over the entry content, transparently
+// decompressing gzip and zstd content, `closeFunc` releases the decompressor.
+func decompressedEntry(entry io.Reader) (content *bufio.Reader, closeFunc func(), err error) {
+	content = bufio.NewReader(entry)
+	magic, _ := content.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		reader, err := gzip.NewReader(content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gunzip: %w", err)
+		}
+		return bufio.NewReader(reader), func() { reader.Close() }, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("zstd: %w", err)
+		}
+		return bufio.NewReader(decoder), decoder.Close, nil
+	}
+	return content, func() {}, nil
+}
+
+// detectedBlockReader returns the block reader matching the content format,
+// or nil if the content is not a known blocks file format.
+func detectedBlockReader(content *bufio.Reader) (blockReader, error) {
+	magic, _ := content.Peek(len(dbinMagic))
+
+	switch {
+	case bytes.Equal(magic, dbinMagic):
+		return NewDBinBlockReader(content)
+	case bytes.Equal(magic, checksumFileMagic):
+		return NewChecksumBlockReader(content)
+	}
+	return nil, nil
+}
@@ -0,0 +1,51 @@
+package bstream
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTarArchiveSource(t *testing.T) {
+	oneBlock := TestBlockWithLIBNum("00000004a", "00000003a", 2)
+
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	compressedOneBlock := encoder.EncodeAll(testBlocks(oneBlock), nil)
+
+	archive := &bytes.Buffer{}
+	writer := tar.NewWriter(archive)
+	for _, entry := range []struct {
+		name    string
+		content []byte
+	}{
+		{"merged/0000000000", testBlocks(TestBlock("00000002a", "00000001a"), TestBlock("00000003a", "00000002a"))},
+		{"README", []byte("not blocks")},
+		{"one/" + BlockFileName(oneBlock) + ".dbin.zst", compressedOneBlock},
+	} {
+		require.NoError(t, writer.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}))
+		_, err := writer.Write(entry.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	var received []string
+	src := NewTarArchiveSource(archive, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		step := "none"
+		if obj != nil {
+			step = obj.(Cursorable).Cursor().Step.String()
+		}
+		received = append(received, blk.Id+":"+step)
+		return nil
+	}), zlog)
+	src.Run()
+
+	assert.Equal(t, io.EOF, src.Err())
+	assert.Equal(t, []string{"00000002a:new,irreversible", "00000003a:new,irreversible", "00000004a:none"}, received)
+}
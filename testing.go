@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
 	"testing"
 	"time"
 
@@ -57,6 +58,34 @@ func (t *TestBlockIndexProvider) BlocksInRange(lowBlockNum uint64, bundleSize ui
 	return out, nil
 }
 
+// TestClock is a Clock whose time only moves when set or advanced
+type TestClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func NewTestClock(now time.Time) *TestClock {
+	return &TestClock{now: now}
+}
+
+func (c *TestClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *TestClock) Set(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = now
+}
+
+func (c *TestClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
 func bRef(id string) BlockRef {
 	return NewBlockRefFromID(id)
 }
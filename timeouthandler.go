@@ -0,0 +1,41 @@
+package bstream
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+)
+
+// ErrHandlerTimeout is wrapped by the errors returned by a timeout handler
+// when the inner handler does not complete in time.
+var ErrHandlerTimeout = errors.New("handler timeout")
+
+// NewTimeoutHandler returns a handler failing with an error wrapping
+// ErrHandlerTimeout when `inner` takes more than `d` to process a block,
+// surfacing a hung downstream as an error instead of a stuck pipeline.
+//
+// ProcessBlock being synchronous, `inner` runs in its own goroutine and is
+// not interrupted on timeout: it may still be running, and may still
+// complete, after the timeout error was returned. `inner` must either be
+// cancellation-aware or the caller must tear the pipeline down on that error,
+// which is what sources do with handler errors.
+func NewTimeoutHandler(inner Handler, d time.Duration) Handler {
+	return HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- inner.ProcessBlock(blk, obj)
+		}()
+
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case err := <-done:
+			return err
+		case <-timer.C:
+			return fmt.Errorf("processing block %s took more than %s: %w", blk.AsRef(), d, ErrHandlerTimeout)
+		}
+	})
+}
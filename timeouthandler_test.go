@@ -0,0 +1,38 @@
+package bstream
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutHandler(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	handler := NewTimeoutHandler(HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		switch blk.Number {
+		case 2:
+			return fmt.Errorf("failing on purpose")
+		case 3:
+			<-release
+		}
+		return nil
+	}), 20*time.Millisecond)
+
+	require.NoError(t, handler.ProcessBlock(TestBlock("00000001a", "00000000a"), nil))
+
+	err := handler.ProcessBlock(TestBlock("00000002a", "00000001a"), nil)
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, ErrHandlerTimeout))
+
+	err = handler.ProcessBlock(TestBlock("00000003a", "00000002a"), nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrHandlerTimeout))
+	assert.Contains(t, err.Error(), "#3 (00000003a)")
+}
@@ -0,0 +1,59 @@
+package bstream
+
+import pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+
+// Tracer is the minimal span factory used to trace per-block processing.
+// Keeping it this small lets callers plug any tracing library, wrapping an
+// OpenTelemetry `trace.Tracer` only takes a few lines:
+//
+//	func (t otelTracer) StartSpan(name string, blk bstream.BlockRef, step bstream.StepType) bstream.Span {
+//		_, span := t.tracer.Start(context.Background(), name, trace.WithAttributes(
+//			attribute.Int64("block.num", int64(blk.Num())),
+//			attribute.String("block.step", step.String()),
+//		))
+//		return otelSpan{span}
+//	}
+//
+// `step` is 0 when the step is not known at this point of the pipeline.
+type Tracer interface {
+	StartSpan(name string, blk BlockRef, step StepType) Span
+}
+
+type Span interface {
+	End(err error)
+}
+
+// NewTracedHandler wraps `h` so that each block it processes is covered by a
+// span named `name`. It returns `h` untouched when `tracer` is nil.
+func NewTracedHandler(name string, tracer Tracer, h Handler) Handler {
+	if tracer == nil {
+		return h
+	}
+
+	return HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		var step StepType
+		if stepable, ok := obj.(Stepable); ok {
+			step = stepable.Step()
+		}
+
+		span := tracer.StartSpan(name, blk.AsRef(), step)
+		err := h.ProcessBlock(blk, obj)
+		span.End(err)
+		return err
+	})
+}
+
+// NewTracedPreprocessFunc wraps `f` so that each call is covered by a span
+// named `name`. It returns `f` untouched when `tracer` is nil.
+func NewTracedPreprocessFunc(name string, tracer Tracer, f PreprocessFunc) PreprocessFunc {
+	if tracer == nil || f == nil {
+		return f
+	}
+
+	return func(blk *pbbstream.Block) (interface{}, error) {
+		span := tracer.StartSpan(name, blk.AsRef(), 0)
+		obj, err := f(blk)
+		span.End(err)
+		return obj, err
+	}
+}
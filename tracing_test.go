@@ -0,0 +1,56 @@
+package bstream
+
+import (
+	"errors"
+	"testing"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSpan struct {
+	name  string
+	num   uint64
+	step  StepType
+	ended bool
+	err   error
+}
+
+func (s *testSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) StartSpan(name string, blk BlockRef, step StepType) Span {
+	span := &testSpan{name: name, num: blk.Num(), step: step}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func TestNewTracedHandler(t *testing.T) {
+	h := HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		return nil
+	})
+	assert.NotNil(t, NewTracedHandler("test", nil, h))
+
+	failure := errors.New("failure")
+	tracer := &testTracer{}
+	traced := NewTracedHandler("test", tracer, HandlerFunc(func(blk *pbbstream.Block, obj interface{}) error {
+		if blk.Number == 3 {
+			return failure
+		}
+		return nil
+	}))
+
+	assert.NoError(t, traced.ProcessBlock(TestBlock("00000002a", "00000001a"), &preprocessedForkableObject{step: StepNew}))
+	assert.Equal(t, failure, traced.ProcessBlock(TestBlock("00000003a", "00000002a"), nil))
+
+	assert.Equal(t, []*testSpan{
+		{name: "test", num: 2, step: StepNew, ended: true},
+		{name: "test", num: 3, ended: true, err: failure},
+	}, tracer.spans)
+}
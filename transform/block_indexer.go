@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/streamingfast/bstream"
@@ -127,6 +128,36 @@ func FindNextUnindexed(ctx context.Context, startBlockNum uint64, possibleIndexS
 	return
 }
 
+// DetectIndexSizes walks the index store and returns the sizes of the
+// `shortName` index files it holds, sorted in ascending order without
+// duplicates, or an empty slice if there are none. The result can be fed to
+// `FindNextUnindexed` instead of hardcoded sizes, keeping in mind that
+// `FindNextUnindexed` gives precedence to the first sizes of the list.
+func DetectIndexSizes(ctx context.Context, store dstore.Store, shortName string) ([]uint64, error) {
+	found := make(map[uint64]bool)
+	err := store.Walk(ctx, "", func(filename string) error {
+		size, _, short, err := parseIndexFilename(filename)
+		if err != nil {
+			zlog.Debug("skipping non-index file", zap.String("filename", filename))
+			return nil
+		}
+		if short == shortName {
+			found[size] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking index store: %w", err)
+	}
+
+	sizes := make([]uint64, 0, len(found))
+	for size := range found {
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	return sizes, nil
+}
+
 // String returns a summary of the current BlockIndexer
 func (i *BlockIndexer) String() string {
 	if i.currentIndex == nil {
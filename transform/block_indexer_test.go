@@ -75,6 +75,22 @@ func Test_FindNextUnindexed(t *testing.T) {
 	}
 }
 
+func TestDetectIndexSizes(t *testing.T) {
+	indexStore := dstore.NewMockStore(nil)
+	for _, name := range []string{"0000020000.10000.test.idx", "0000030000.1000.test.idx", "0000031000.1000.test.idx", "0000000000.100.other.idx", "0000000000.notanindex"} {
+		indexStore.SetFile(name, nil)
+	}
+
+	sizes, err := DetectIndexSizes(context.Background(), indexStore, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1000, 10000}, sizes)
+
+	sizes, err = DetectIndexSizes(context.Background(), indexStore, "missing")
+	require.NoError(t, err)
+	assert.NotNil(t, sizes)
+	assert.Len(t, sizes, 0)
+}
+
 func TestBlockIndexer_String(t *testing.T) {
 	indexStore := dstore.NewMockStore(func(base string, f io.Reader) error {
 		return nil
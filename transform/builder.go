@@ -26,6 +26,33 @@ func (r *Registry) PassthroughFromTransforms(anyTransforms []*anypb.Any) (Passth
 	return nil, nil
 }
 
+// ErrorPolicy defines how the PreprocessFunc built from transforms handles a failing transform
+type ErrorPolicy int
+
+const (
+	// ErrorPolicyAbort fails the preprocessing of the block on the first failing transform
+	ErrorPolicyAbort ErrorPolicy = iota
+
+	// ErrorPolicySkipFailed logs failing transforms and skips them: the next
+	// transform receives the last good output (nil if no transform succeeded
+	// yet) and the block passes through with the last good output. Only use it
+	// for non-critical transforms, the output of a block is then not the one
+	// that was asked for, and a consumer cannot tell from it that a transform
+	// was skipped. A transform expecting the output of the skipped one as its
+	// input may also fail or produce wrong results.
+	ErrorPolicySkipFailed
+)
+
+func (p ErrorPolicy) String() string {
+	switch p {
+	case ErrorPolicyAbort:
+		return "abort"
+	case ErrorPolicySkipFailed:
+		return "skip_failed"
+	}
+	return fmt.Sprintf("unknown(%d)", int(p))
+}
+
 // BuildFromTransforms returns a PreprocessFunc, an optional BlockIndexProvider, a human-readable description and an error
 // It will fail if it receives a transform of type Passthrough or a transform that does not match any interface
 func (r *Registry) BuildFromTransforms(anyTransforms []*anypb.Any) (
@@ -33,6 +60,16 @@ func (r *Registry) BuildFromTransforms(anyTransforms []*anypb.Any) (
 	bstream.BlockIndexProvider,
 	string,
 	error,
+) {
+	return r.BuildFromTransformsWithErrorPolicy(anyTransforms, ErrorPolicyAbort)
+}
+
+// BuildFromTransformsWithErrorPolicy is BuildFromTransforms with the given ErrorPolicy applied to failing transforms
+func (r *Registry) BuildFromTransformsWithErrorPolicy(anyTransforms []*anypb.Any, policy ErrorPolicy) (
+	bstream.PreprocessFunc,
+	bstream.BlockIndexProvider,
+	string,
+	error,
 ) {
 	if len(anyTransforms) == 0 {
 		return nil, nil, "", nil
@@ -78,11 +115,16 @@ func (r *Registry) BuildFromTransforms(anyTransforms []*anypb.Any) (
 
 		in = NewNilObj()
 		var out proto.Message
-		var err error
 		for idx, transform := range ppTransforms {
-			if out, err = transform.Transform(blk, in); err != nil {
-				return nil, fmt.Errorf("transform %d failed: %w", idx, err)
+			transformed, err := transform.Transform(blk, in)
+			if err != nil {
+				if policy != ErrorPolicySkipFailed {
+					return nil, fmt.Errorf("transform %d failed: %w", idx, err)
+				}
+				zlog.Warn("transform failed, skipping it", zap.Int("index", idx), zap.Stringer("block", blk.AsRef()), zap.Error(err))
+				continue
 			}
+			out = transformed
 			in = &InputObj{
 				_type: string(proto.MessageName(out)),
 				obj:   out,
@@ -0,0 +1,90 @@
+package transform
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// appendTransform appends its suffix to the string it receives, failing when the suffix is "fail"
+type appendTransform struct {
+	suffix string
+}
+
+func (t *appendTransform) String() string { return "append " + t.suffix }
+
+func (t *appendTransform) Transform(_ *pbbstream.Block, in Input) (Output, error) {
+	if t.suffix == "fail" {
+		return nil, fmt.Errorf("failing on purpose")
+	}
+
+	prefix := ""
+	if in.Obj() != nil {
+		prefix = in.Obj().(*wrapperspb.StringValue).Value
+	}
+	return wrapperspb.String(prefix + t.suffix), nil
+}
+
+func TestRegistry_BuildFromTransformsWithErrorPolicy(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(&Factory{
+		Obj: &wrapperspb.StringValue{},
+		NewFunc: func(message *anypb.Any) (Transform, error) {
+			config := &wrapperspb.StringValue{}
+			if err := message.UnmarshalTo(config); err != nil {
+				return nil, err
+			}
+			return &appendTransform{suffix: config.Value}, nil
+		},
+	})
+
+	transforms := func(suffixes ...string) (out []*anypb.Any) {
+		for _, suffix := range suffixes {
+			a, err := anypb.New(wrapperspb.String(suffix))
+			require.NoError(t, err)
+			out = append(out, a)
+		}
+		return
+	}
+	blk := bstream.TestBlock("00000001a", "00000000a")
+
+	tests := []struct {
+		name        string
+		suffixes    []string
+		policy      ErrorPolicy
+		expectedOut interface{}
+		expectedErr bool
+	}{
+		{"abort all good", []string{"a", "b"}, ErrorPolicyAbort, "ab", false},
+		{"abort on failure", []string{"a", "fail", "b"}, ErrorPolicyAbort, nil, true},
+		{"skip failed in the middle", []string{"a", "fail", "b"}, ErrorPolicySkipFailed, "ab", false},
+		{"skip failed last", []string{"a", "fail"}, ErrorPolicySkipFailed, "a", false},
+		{"skip failed only", []string{"fail"}, ErrorPolicySkipFailed, nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			preprocess, _, _, err := registry.BuildFromTransformsWithErrorPolicy(transforms(test.suffixes...), test.policy)
+			require.NoError(t, err)
+
+			out, err := preprocess(blk)
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if test.expectedOut == nil {
+				assert.Nil(t, out)
+				return
+			}
+			assert.Equal(t, test.expectedOut, out.(*wrapperspb.StringValue).Value)
+		})
+	}
+}
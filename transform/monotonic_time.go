@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// MonotonicTimeTransformFactory creates a MonotonicTimeTransform from a
+// `google.protobuf.Duration` message holding the epsilon, register it to use
+// the transform through `BuildFromTransforms`.
+var MonotonicTimeTransformFactory = &Factory{
+	Obj: &durationpb.Duration{},
+	NewFunc: func(message *anypb.Any) (Transform, error) {
+		epsilon := &durationpb.Duration{}
+		if err := message.UnmarshalTo(epsilon); err != nil {
+			return nil, fmt.Errorf("unmarshalling monotonic time epsilon: %w", err)
+		}
+		if err := epsilon.CheckValid(); err != nil {
+			return nil, fmt.Errorf("invalid monotonic time epsilon: %w", err)
+		}
+		return NewMonotonicTimeTransform(epsilon.AsDuration()), nil
+	},
+}
+
+// MonotonicTimeTransform re-times blocks so their timestamps always increase:
+// each block gets an effective time of at least the previous block effective
+// time plus epsilon. Its output is a `*pbbstream.Block` sharing the payload of
+// the original block, with the effective time as `Timestamp`. The original
+// block, with its original time, is still the one given to handlers along
+// with that output.
+//
+// The block itself is not re-timed, nor its original time attached to it: a
+// transform only gets a read-only block, shared with every other consumer of
+// the hub or the file source, and its output is the only thing it can add to
+// the block, attachments being set by sources. Consumers read the effective
+// time from the output and the original time from the block.
+//
+// The transform is stateful, the previous block is the last one it was
+// given: it must see blocks in order, so it requires a single preprocessing
+// thread, and blocks of a fork are re-timed against the last block seen, not
+// against their parent. Since it does not use its input, put it first when
+// chaining transforms.
+type MonotonicTimeTransform struct {
+	sync.Mutex
+
+	epsilon  time.Duration
+	previous time.Time
+}
+
+func NewMonotonicTimeTransform(epsilon time.Duration) *MonotonicTimeTransform {
+	return &MonotonicTimeTransform{
+		epsilon: epsilon,
+	}
+}
+
+func (t *MonotonicTimeTransform) String() string {
+	return fmt.Sprintf("monotonic_time_transform (epsilon: %s)", t.epsilon)
+}
+
+func (t *MonotonicTimeTransform) Transform(readOnlyBlk *pbbstream.Block, _ Input) (Output, error) {
+	if err := readOnlyBlk.Timestamp.CheckValid(); err != nil {
+		return nil, fmt.Errorf("invalid timestamp on block %s: %w", readOnlyBlk.AsRef(), err)
+	}
+	blkTime := readOnlyBlk.Timestamp.AsTime()
+
+	t.Lock()
+	effective := blkTime
+	if !t.previous.IsZero() {
+		if minimum := t.previous.Add(t.epsilon); effective.Before(minimum) {
+			effective = minimum
+		}
+	}
+	t.previous = effective
+	t.Unlock()
+
+	return &pbbstream.Block{
+		Number:    readOnlyBlk.Number,
+		Id:        readOnlyBlk.Id,
+		ParentId:  readOnlyBlk.ParentId,
+		Timestamp: timestamppb.New(effective),
+		LibNum:    readOnlyBlk.LibNum,
+		ParentNum: readOnlyBlk.ParentNum,
+		Payload:   readOnlyBlk.Payload,
+	}, nil
+}
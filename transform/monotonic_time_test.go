@@ -0,0 +1,78 @@
+package transform
+
+import (
+	"testing"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMonotonicTimeTransform(t *testing.T) {
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	blk := func(num uint64, offset time.Duration) *pbbstream.Block {
+		return &pbbstream.Block{Number: num, Id: "id", Timestamp: timestamppb.New(base.Add(offset))}
+	}
+
+	tests := []struct {
+		name     string
+		blocks   []*pbbstream.Block
+		expected []time.Duration
+	}{
+		{
+			name:     "already increasing",
+			blocks:   []*pbbstream.Block{blk(1, 0), blk(2, time.Second), blk(3, 2*time.Second)},
+			expected: []time.Duration{0, time.Second, 2 * time.Second},
+		},
+		{
+			name:     "equal times",
+			blocks:   []*pbbstream.Block{blk(1, 0), blk(2, 0), blk(3, 0)},
+			expected: []time.Duration{0, time.Millisecond, 2 * time.Millisecond},
+		},
+		{
+			name:     "time going backward then catching up",
+			blocks:   []*pbbstream.Block{blk(1, time.Second), blk(2, 0), blk(3, 5*time.Second)},
+			expected: []time.Duration{time.Second, time.Second + time.Millisecond, 5 * time.Second},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transform := NewMonotonicTimeTransform(time.Millisecond)
+			for i, b := range test.blocks {
+				original := b.Timestamp.AsTime()
+
+				out, err := transform.Transform(b, &NilObj{})
+				require.NoError(t, err)
+
+				retimed := out.(*pbbstream.Block)
+				assert.Equal(t, base.Add(test.expected[i]), retimed.Timestamp.AsTime(), "block #%d", b.Number)
+				assert.Equal(t, b.Number, retimed.Number)
+				assert.Equal(t, original, b.Timestamp.AsTime(), "original block must not be modified")
+			}
+		})
+	}
+}
+
+func TestMonotonicTimeTransformFactory(t *testing.T) {
+	config, err := anypb.New(durationpb.New(2 * time.Second))
+	require.NoError(t, err)
+
+	registry := NewRegistry()
+	registry.Register(MonotonicTimeTransformFactory)
+
+	preprocessFunc, _, desc, err := registry.BuildFromTransforms([]*anypb.Any{config})
+	require.NoError(t, err)
+	assert.Contains(t, desc, "epsilon: 2s")
+
+	ts := timestamppb.New(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	_, err = preprocessFunc(&pbbstream.Block{Number: 1, Id: "a", Timestamp: ts})
+	require.NoError(t, err)
+	out, err := preprocessFunc(&pbbstream.Block{Number: 2, Id: "b", Timestamp: ts})
+	require.NoError(t, err)
+	assert.Equal(t, ts.AsTime().Add(2*time.Second), out.(*pbbstream.Block).Timestamp.AsTime())
+}
@@ -0,0 +1,168 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/streamingfast/bstream"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+)
+
+// KeysExtractor returns the index keys of a block
+type KeysExtractor func(blk *pbbstream.Block) ([]string, error)
+
+// ParallelIndexer builds index files for a whole block range at once, each
+// index range being read from the merged blocks store and written to the
+// index store by its own worker. Index ranges are self-contained so workers
+// never share state and each index file is written by a single worker.
+type ParallelIndexer struct {
+	blocksStore    dstore.Store
+	indexStore     dstore.Store
+	indexSize      uint64
+	indexShortname string
+	workers        int
+	extractKeys    KeysExtractor
+	indexerOptions []Option
+}
+
+// NewParallelIndexer initializes a ParallelIndexer reading blocks from
+// `blocksStore` and writing `indexShortname` index files of `indexSize`
+// blocks to `indexStore`, using `workers` concurrent goroutines. The options
+// are applied to the BlockIndexer of each index range.
+func NewParallelIndexer(blocksStore, indexStore dstore.Store, indexSize uint64, indexShortname string, workers int, extractKeys KeysExtractor, opts ...Option) *ParallelIndexer {
+	if indexShortname == "" {
+		indexShortname = "default"
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &ParallelIndexer{
+		blocksStore:    blocksStore,
+		indexStore:     indexStore,
+		indexSize:      indexSize,
+		indexShortname: indexShortname,
+		workers:        workers,
+		extractKeys:    extractKeys,
+		indexerOptions: opts,
+	}
+}
+
+// IndexRange builds the index files covering [startBlockNum, stopBlockNum[,
+// both boundaries must be aligned on the index size. It stops at the first
+// failing index range and returns its error.
+func (p *ParallelIndexer) IndexRange(ctx context.Context, startBlockNum, stopBlockNum uint64) error {
+	if startBlockNum%p.indexSize != 0 || stopBlockNum%p.indexSize != 0 {
+		return fmt.Errorf("range [%d, %d[ is not aligned with index size %d", startBlockNum, stopBlockNum, p.indexSize)
+	}
+	if stopBlockNum <= startBlockNum {
+		return fmt.Errorf("invalid range [%d, %d[", startBlockNum, stopBlockNum)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lowBlockNums := make(chan uint64)
+	go func() {
+		defer close(lowBlockNums)
+		for low := startBlockNum; low < stopBlockNum; low += p.indexSize {
+			select {
+			case lowBlockNums <- low:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	var firstErr error
+	wg := sync.WaitGroup{}
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for low := range lowBlockNums {
+				if err := p.indexOne(ctx, low); err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf("indexing range starting at %d: %w", low, err)
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+func (p *ParallelIndexer) indexOne(ctx context.Context, lowBlockNum uint64) error {
+	indexer := NewBlockIndexer(p.indexStore, p.indexSize, p.indexShortname, p.indexerOptions...)
+	indexer.currentIndex = NewBlockIndex(lowBlockNum, p.indexSize)
+
+	highBlockNum := lowBlockNum + p.indexSize
+	bundleSize := bstream.GetMergedBlocksBundleSize
+	for base := lowBoundary(lowBlockNum, bundleSize); base < highBlockNum; base += bundleSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := p.readMergedFile(ctx, base, func(blk *pbbstream.Block) error {
+			if blk.Number < lowBlockNum || blk.Number >= highBlockNum {
+				return nil
+			}
+			keys, err := p.extractKeys(blk)
+			if err != nil {
+				return fmt.Errorf("extracting keys of block %s: %w", blk.AsRef(), err)
+			}
+			for _, key := range keys {
+				indexer.currentIndex.add(key, blk.Number)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	zlog.Debug("writing index range", zap.Uint64("low_block_num", lowBlockNum), zap.Uint64("index_size", p.indexSize), zap.String("index_shortname", p.indexShortname))
+	return indexer.writeIndex()
+}
+
+func (p *ParallelIndexer) readMergedFile(ctx context.Context, base uint64, f func(blk *pbbstream.Block) error) error {
+	filename := bstream.MergedFileNameForBlock(base)
+	reader, err := p.blocksStore.OpenObject(ctx, filename)
+	if err != nil {
+		return fmt.Errorf("opening merged blocks file %q: %w", filename, err)
+	}
+	defer reader.Close()
+
+	blockReader, err := bstream.NewDBinBlockReader(reader)
+	if err != nil {
+		return fmt.Errorf("reading merged blocks file %q: %w", filename, err)
+	}
+
+	for {
+		blk, err := blockReader.Read()
+		if blk != nil {
+			if err := f(blk); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("reading merged blocks file %q: %w", filename, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package transform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/streamingfast/bstream"
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMergedBlocksFile(t *testing.T, blocks ...*pbbstream.Block) []byte {
+	buf := &bytes.Buffer{}
+	writer, err := bstream.NewDBinBlockWriter(buf)
+	require.NoError(t, err)
+	for _, blk := range blocks {
+		require.NoError(t, writer.Write(blk))
+	}
+	return buf.Bytes()
+}
+
+func TestParallelIndexer_IndexRange(t *testing.T) {
+	bstream.GetProtocolFirstStreamableBlock = 0
+
+	blocksStore := dstore.NewMockStore(nil)
+	for _, base := range []uint64{0, 100, 200} {
+		blocksStore.SetFile(fmt.Sprintf("%010d", base), testMergedBlocksFile(t,
+			bstream.TestBlockWithNumbers(fmt.Sprintf("%08xa", base+1), fmt.Sprintf("%08xa", base), base+1, base),
+			bstream.TestBlockWithNumbers(fmt.Sprintf("%08xa", base+2), fmt.Sprintf("%08xa", base+1), base+2, base+1),
+		))
+	}
+
+	var lock sync.Mutex
+	results := make(map[string][]byte)
+	indexStore := dstore.NewMockStore(nil)
+	indexStore.WriteObjectFunc = func(_ context.Context, base string, f io.Reader) error {
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+
+		lock.Lock()
+		defer lock.Unlock()
+		require.NotContains(t, results, base, "index file written twice")
+		results[base] = content
+		return nil
+	}
+
+	extractKeys := func(blk *pbbstream.Block) ([]string, error) {
+		if blk.Number%2 == 0 {
+			return []string{"even"}, nil
+		}
+		return []string{"odd"}, nil
+	}
+
+	indexer := NewParallelIndexer(blocksStore, indexStore, 100, "test", 2, extractKeys)
+	require.NoError(t, indexer.IndexRange(context.Background(), 0, 300))
+
+	require.Len(t, results, 3)
+	for _, base := range []uint64{0, 100, 200} {
+		content, found := results[toIndexFilename(100, base, "test")]
+		require.True(t, found)
+
+		idx, err := ReadNewBlockIndex(io.NopCloser(bytes.NewReader(content)))
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{base + 1}, idx.Get("odd").ToArray())
+		assert.Equal(t, []uint64{base + 2}, idx.Get("even").ToArray())
+	}
+}
+
+func TestParallelIndexer_MissingMergedFile(t *testing.T) {
+	blocksStore := dstore.NewMockStore(nil)
+	blocksStore.SetFile("0000000000", testMergedBlocksFile(t, bstream.TestBlockWithNumbers("00000001a", "00000000a", 1, 0)))
+
+	indexStore := dstore.NewMockStore(func(base string, f io.Reader) error { return nil })
+	indexer := NewParallelIndexer(blocksStore, indexStore, 100, "test", 2, func(blk *pbbstream.Block) ([]string, error) {
+		return nil, nil
+	})
+
+	assert.Error(t, indexer.IndexRange(context.Background(), 0, 300))
+	assert.Error(t, indexer.IndexRange(context.Background(), 50, 300))
+}
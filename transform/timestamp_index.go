@@ -0,0 +1,120 @@
+package transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"go.uber.org/zap"
+)
+
+const timestampKeyPrefix = "ts:"
+
+// ErrNoBlockInTimeRange is returned by ResolveBlockRangeByTime when no indexed
+// block has a timestamp within the requested range
+var ErrNoBlockInTimeRange = errors.New("no block in time range")
+
+// TimestampKeys is the KeysExtractor of the timestamp index: each block is
+// indexed under its timestamp, at millisecond precision. Use it with a
+// ParallelIndexer to backfill the index, see ResolveBlockRangeByTime to query
+// it.
+func TimestampKeys(blk *pbbstream.Block) ([]string, error) {
+	if err := blk.Timestamp.CheckValid(); err != nil {
+		return nil, fmt.Errorf("invalid timestamp on block %s: %w", blk.AsRef(), err)
+	}
+	return []string{timestampKeyPrefix + strconv.FormatInt(blk.Timestamp.AsTime().UnixMilli(), 10)}, nil
+}
+
+// TimestampIndexTransform feeds the timestamp index of the blocks it sees to
+// a BlockIndexer, building the index while streaming. Its output is its input,
+// so it can be chained anywhere. Like the BlockIndexer, it must see blocks in
+// order: it requires a single preprocessing thread.
+type TimestampIndexTransform struct {
+	indexer *BlockIndexer
+}
+
+func NewTimestampIndexTransform(indexer *BlockIndexer) *TimestampIndexTransform {
+	return &TimestampIndexTransform{
+		indexer: indexer,
+	}
+}
+
+func (t *TimestampIndexTransform) String() string {
+	return fmt.Sprintf("timestamp_index_transform (%s)", t.indexer)
+}
+
+func (t *TimestampIndexTransform) Transform(readOnlyBlk *pbbstream.Block, in Input) (Output, error) {
+	keys, err := TimestampKeys(readOnlyBlk)
+	if err != nil {
+		return nil, err
+	}
+	t.indexer.Add(keys, readOnlyBlk.Number)
+	return in.Obj(), nil
+}
+
+// ResolveBlockRangeByTime returns the lowest and highest numbers of the blocks
+// whose timestamp is within [from, to], reading the `shortName` timestamp
+// index files of `store` instead of the blocks. Timestamps are not assumed to
+// be monotonic: a block outside of the range can sit between `lowNum` and
+// `highNum`, and the range may start or end in a neighbouring index file.
+// ErrNoBlockInTimeRange is returned when no indexed block matches.
+func ResolveBlockRangeByTime(ctx context.Context, store dstore.Store, shortName string, from, to time.Time) (lowNum, highNum uint64, err error) {
+	fromMilli := from.UnixMilli()
+	toMilli := to.UnixMilli()
+
+	var found bool
+	err = store.Walk(ctx, "", func(filename string) error {
+		_, _, short, err := parseIndexFilename(filename)
+		if err != nil {
+			zlog.Debug("skipping non-index file", zap.String("filename", filename))
+			return nil
+		}
+		if short != shortName {
+			return nil
+		}
+
+		reader, err := store.OpenObject(ctx, filename)
+		if err != nil {
+			return fmt.Errorf("opening index file %q: %w", filename, err)
+		}
+		idx, err := ReadNewBlockIndex(reader)
+		if err != nil {
+			return fmt.Errorf("reading index file %q: %w", filename, err)
+		}
+
+		for key, bitmap := range idx.kv {
+			milli, ok := strings.CutPrefix(key, timestampKeyPrefix)
+			if !ok || bitmap.IsEmpty() {
+				continue
+			}
+			ts, err := strconv.ParseInt(milli, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid timestamp key %q in index file %q: %w", key, filename, err)
+			}
+			if ts < fromMilli || ts > toMilli {
+				continue
+			}
+
+			if !found || bitmap.Minimum() < lowNum {
+				lowNum = bitmap.Minimum()
+			}
+			if !found || bitmap.Maximum() > highNum {
+				highNum = bitmap.Maximum()
+			}
+			found = true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("walking index store: %w", err)
+	}
+	if !found {
+		return 0, 0, ErrNoBlockInTimeRange
+	}
+	return lowNum, highNum, nil
+}
@@ -0,0 +1,80 @@
+package transform
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
+	"github.com/streamingfast/dstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestResolveBlockRangeByTime(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return start.Add(time.Duration(sec) * time.Second) }
+
+	results := make(map[string][]byte)
+	writeStore := dstore.NewMockStore(func(base string, f io.Reader) error {
+		content, err := io.ReadAll(f)
+		require.NoError(t, err)
+		results[base] = content
+		return nil
+	})
+
+	tr := NewTimestampIndexTransform(NewBlockIndexer(writeStore, 10, "ts"))
+	for num := 0; num <= 30; num++ {
+		sec := num
+		switch num { // out of order across the 10 and 20 bundle edges
+		case 9:
+			sec = 10
+		case 10:
+			sec = 9
+		case 19:
+			sec = 21
+		}
+
+		blk := &pbbstream.Block{Number: uint64(num), Timestamp: timestamppb.New(at(sec))}
+		out, err := tr.Transform(blk, NewNilObj())
+		require.NoError(t, err)
+		assert.Nil(t, out)
+	}
+
+	store := dstore.NewMockStore(nil)
+	for name, content := range results {
+		store.SetFile(name, content)
+	}
+	store.SetFile("0000000000.10.other.idx", nil)
+
+	tests := []struct {
+		name       string
+		from, to   time.Time
+		expectLow  uint64
+		expectHigh uint64
+		expectErr  error
+	}{
+		{"within a bundle", at(3), at(5), 3, 5, nil},
+		{"single block", at(9), at(9), 10, 10, nil},
+		{"swapped across edge", at(9), at(10), 9, 10, nil},
+		{"starts in previous bundle", at(10), at(12), 9, 12, nil},
+		{"ends in previous bundle", at(20), at(21), 19, 21, nil},
+		{"between timestamps", at(3).Add(time.Millisecond), at(4).Add(-time.Millisecond), 0, 0, ErrNoBlockInTimeRange},
+		{"after last written bundle", at(30), at(40), 0, 0, ErrNoBlockInTimeRange},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			low, high, err := ResolveBlockRangeByTime(context.Background(), store, "ts", test.from, test.to)
+			if test.expectErr != nil {
+				assert.ErrorIs(t, err, test.expectErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expectLow, low)
+			assert.Equal(t, test.expectHigh, high)
+		})
+	}
+}
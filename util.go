@@ -19,12 +19,36 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 
 	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
 )
 
 var ErrStopBlockReached = errors.New("stop block reached")
 
+// ErrLimitReached is the completion of a LimitedSource that sent all its blocks
+var ErrLimitReached = errors.New("block limit reached")
+
+// ErrStopTimeReached is the completion of a source stopping at a block time
+var ErrStopTimeReached = errors.New("stop time reached")
+
+// SourceEnded returns true when `src` is terminated and its shutdown is a
+// normal completion (see `IsNormalSourceEnd`) rather than an actual error. It
+// returns false while the source is still running.
+func SourceEnded(src Source) (normal bool) {
+	if !src.IsTerminated() {
+		return false
+	}
+	return IsNormalSourceEnd(src.Err())
+}
+
+// IsNormalSourceEnd classifies a source shutdown error: no error, `io.EOF`,
+// `ErrStopBlockReached`, `ErrLimitReached` and `ErrStopTimeReached` mean the
+// source was simply exhausted.
+func IsNormalSourceEnd(err error) bool {
+	return err == nil || errors.Is(err, io.EOF) || errors.Is(err, ErrStopBlockReached) || errors.Is(err, ErrLimitReached) || errors.Is(err, ErrStopTimeReached)
+}
+
 // DoForProtocol extra the worker (a lambda) that will be invoked based on the
 // received `kind` parameter. If the mapping exists, the worker is invoked and
 // the error returned with the call. If the mapping does not exist, an error
@@ -16,6 +16,8 @@ package bstream
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"testing"
 
 	pbbstream "github.com/streamingfast/bstream/pb/sf/bstream/v1"
@@ -77,3 +79,30 @@ func TestMustDoForProtocol(t *testing.T) {
 		})
 	})
 }
+
+func TestSourceEnded(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		expectNorm bool
+	}{
+		{"no error", nil, true},
+		{"eof", io.EOF, true},
+		{"stop block", ErrStopBlockReached, true},
+		{"wrapped stop block", fmt.Errorf("handler: %w", ErrStopBlockReached), true},
+		{"limit reached", ErrLimitReached, true},
+		{"stop time reached", ErrStopTimeReached, true},
+		{"actual error", errors.New("boom"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := NewTestSource(nil)
+			assert.False(t, SourceEnded(src), "running source has not ended")
+
+			src.Shutdown(test.err)
+			<-src.Terminated()
+			assert.Equal(t, test.expectNorm, SourceEnded(src))
+		})
+	}
+}